@@ -0,0 +1,37 @@
+// Package blocking answers whether users blocked each other. A block works both
+// ways: neither user can message the other directly, and neither can join a
+// group the other is a member of.
+package blocking
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection holds one document per blocker and blocked user.
+const Collection = "blocks"
+
+// Filter matches the blocks between userId and any of otherIds, whoever blocked whom.
+func Filter(userId primitive.ObjectID, otherIds ...primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"blockerId": userId, "blockedId": bson.M{"$in": otherIds}},
+		bson.M{"blockerId": bson.M{"$in": otherIds}, "blockedId": userId},
+	}}
+}
+
+// Between reports whether userId and any of otherIds blocked each other.
+func Between(ctx context.Context, db *mongo.Database, userId primitive.ObjectID, otherIds ...primitive.ObjectID) (bool, error) {
+	if len(otherIds) == 0 {
+		return false, nil
+	}
+
+	count, err := db.Collection(Collection).CountDocuments(ctx, Filter(userId, otherIds...))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,23 @@
+package blocking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilter(t *testing.T) {
+	userId := primitive.NewObjectID()
+	otherId := primitive.NewObjectID()
+
+	t.Run("Matches blocks in both directions", func(t *testing.T) {
+		filter := Filter(userId, otherId)
+
+		assert.Equal(t, bson.A{
+			bson.M{"blockerId": userId, "blockedId": bson.M{"$in": []primitive.ObjectID{otherId}}},
+			bson.M{"blockerId": bson.M{"$in": []primitive.ObjectID{otherId}}, "blockedId": userId},
+		}, filter["$or"])
+	})
+}
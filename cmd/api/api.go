@@ -1,15 +1,28 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"lite-chat-go/config"
+	"lite-chat-go/linkpreview"
 	"lite-chat-go/middlewares"
+	"lite-chat-go/service/admin"
+	"lite-chat-go/service/attachment"
 	"lite-chat-go/service/conversation"
 	"lite-chat-go/service/message"
+	"lite-chat-go/service/moderation"
+	"lite-chat-go/service/presence"
+	"lite-chat-go/service/schedule"
+	"lite-chat-go/service/socket"
+	"lite-chat-go/service/star"
 	"lite-chat-go/service/user"
+	"lite-chat-go/service/workspace"
+	"lite-chat-go/storage"
 	"lite-chat-go/utils"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -62,23 +75,118 @@ func (s *APIServer) Run() error {
 
 	//User route
 	userService := user.NewUserService(s.userCollection)
+	if err := userService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create block indexes: %w", err)
+	}
 	userRouter := router.PathPrefix("/user").Subrouter()
 	userService.RegisterRoutes(userRouter)
+	utils.SetAccountCheck(userService.Account)
+
+	//Admin route
+	adminService := admin.NewAdminService(s.userCollection, s.conversationCollection, s.messageCollection)
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminService.RegisterRoutes(adminRouter)
+
+	//Workspace route
+	workspaceService := workspace.NewWorkspaceService(s.userCollection.Database().Collection("workspaces"), s.userCollection)
+	if err := workspaceService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create workspace indexes: %w", err)
+	}
+	workspaceRouter := router.PathPrefix("/workspaces").Subrouter()
+	workspaceService.RegisterRoutes(workspaceRouter)
 
 	//Conversation route
-	conversationService := conversation.NewConversationService(s.conversationCollection)
+	conversationService := conversation.NewConversationService(s.conversationCollection, s.messageCollection)
+	if err := conversationService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create conversation indexes: %w", err)
+	}
 	conversationRouter := router.PathPrefix("/conversations").Subrouter()
 	conversationService.RegisterRoutes(conversationRouter)
+	inviteRouter := router.PathPrefix("/invites").Subrouter()
+	conversationService.RegisterInviteRoutes(inviteRouter)
 
 	//Message route
 	messageService := message.NewMessageService(s.messageCollection, s.conversationCollection, s.userCollection)
+	if err := messageService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create message indexes: %w", err)
+	}
+	messageService.SetLinkPreviewer(linkpreview.NewCachedFetcher(
+		linkpreview.NewHTTPFetcher(linkpreview.DefaultTimeout, linkpreview.DefaultMaxBytes),
+		time.Hour,
+	))
+	attachmentStore, err := storage.NewDiskStore(config.Envs.UploadDir)
+	if err != nil {
+		return fmt.Errorf("failed to open upload directory: %w", err)
+	}
+	messageService.SetAttachmentStore(attachmentStore)
 	messageRouter := router.PathPrefix("/messages").Subrouter()
 	messageService.RegisterRoutes(messageRouter)
+	go messageService.RunExpirySweeper(context.Background(), 30*time.Second)
+
+	//Scheduled message route
+	hostname, _ := os.Hostname()
+	scheduleService := schedule.NewScheduleService(
+		s.messageCollection.Database().Collection("scheduled_messages"),
+		messageService,
+		fmt.Sprintf("%s-%s", hostname, utils.RandomString(8)),
+	)
+	if err := scheduleService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create scheduled message indexes: %w", err)
+	}
+	messageService.SetScheduler(scheduleService)
+	scheduleService.RegisterRoutes(messageRouter)
+	go scheduleService.Run(context.Background(), 5*time.Second)
+
+	//Starred message route
+	starService := star.NewStarService(s.messageCollection.Database().Collection("stars"), s.messageCollection, s.conversationCollection)
+	if err := starService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create star indexes: %w", err)
+	}
+	starService.RegisterRoutes(messageRouter)
+
+	//Moderation route
+	moderationService := moderation.NewModerationService(
+		s.messageCollection.Database().Collection("reports"),
+		s.messageCollection,
+		s.conversationCollection,
+		s.userCollection,
+	)
+	if err := moderationService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create moderation indexes: %w", err)
+	}
+	reportRouter := router.PathPrefix("/reports").Subrouter()
+	moderationService.RegisterReportRoutes(reportRouter)
+	moderationRouter := router.PathPrefix("/moderation").Subrouter()
+	moderationService.RegisterRoutes(moderationRouter)
+
+	//Attachment route
+	attachmentService := attachment.NewAttachmentService(attachmentStore, s.messageCollection, s.conversationCollection)
+	attachmentRouter := router.PathPrefix("/attachments").Subrouter()
+	attachmentService.RegisterRoutes(attachmentRouter)
+
+	//Presence route
+	presenceService := presence.NewPresenceService(s.userCollection, s.conversationCollection, time.Duration(config.Envs.PresenceTTLInSeconds)*time.Second)
+	if err := presenceService.EnsureIndexes(context.Background()); err != nil {
+		return fmt.Errorf("failed to create presence indexes: %w", err)
+	}
+	presenceRouter := router.PathPrefix("/presence").Subrouter()
+	presenceService.RegisterRoutes(presenceRouter)
+	go presenceService.Run(context.Background(), 10*time.Second)
+
+	//Realtime route
+	socketService := socket.NewSocketService()
+	socketService.OnClientEvent("client-message-delivered", messageService.HandleDeliveredEvent)
+	socketService.OnClientEvent("client-presence", presenceService.HandleHeartbeatEvent)
+	socketService.OnClientEvent("client-typing", presenceService.HandleTypingEvent)
+	socketService.OnChannelEvent("channel_vacated", presenceService.HandleChannelVacated)
+	socketService.AddAuthorizer(conversationService.AuthorizeChannel)
+	socketRouter := router.PathPrefix("/realtime").Subrouter()
+	socketService.RegisterRoutes(socketRouter)
 
 	// CORS config
 	allowedOrigins := handlers.AllowedOrigins([]string{config.Envs.ClientBaseUrl})
-	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
-	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "Access-Control-Allow-Origin"})
+	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "Access-Control-Allow-Origin", "Idempotency-Key", "X-Socket-Id"})
 
 	// Apply CORS middleware
 	handler := handlers.CORS(allowedOrigins, allowedMethods, allowedHeaders)(mainRouter)
@@ -9,11 +9,12 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestAPIServer_HealthCheck(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
-		apiServer := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085")
+		apiServer := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085", zap.NewNop())
 
 		t.Run("Health check returns OK", func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/health", nil)
@@ -77,7 +78,7 @@ func TestNewAPIServer(t *testing.T) {
 			dbName := "testdb"
 			port := "8085"
 
-			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, dbName, port)
+			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, dbName, port, zap.NewNop())
 
 			assert.NotNil(t, server)
 			assert.Equal(t, testDB.UserCol, server.userCollection)
@@ -88,7 +89,7 @@ func TestNewAPIServer(t *testing.T) {
 		})
 
 		t.Run("Create API server with nil collections", func(t *testing.T) {
-			server := NewAPIServer(nil, nil, nil, "testdb", "8080")
+			server := NewAPIServer(nil, nil, nil, "testdb", "8080", zap.NewNop())
 
 			assert.NotNil(t, server)
 			assert.Nil(t, server.userCollection)
@@ -97,7 +98,7 @@ func TestNewAPIServer(t *testing.T) {
 		})
 
 		t.Run("Create API server with empty strings", func(t *testing.T) {
-			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "", "")
+			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "", "", zap.NewNop())
 
 			assert.NotNil(t, server)
 			assert.Equal(t, "", server.dbName)
@@ -105,7 +106,7 @@ func TestNewAPIServer(t *testing.T) {
 		})
 
 		t.Run("API server struct validation", func(t *testing.T) {
-			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085")
+			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085", zap.NewNop())
 
 			// Verify all fields are accessible
 			assert.NotNil(t, server.userCollection)
@@ -121,7 +122,7 @@ func TestAPIServer_Integration(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
 		
 		t.Run("API server components integration", func(t *testing.T) {
-			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085")
+			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085", zap.NewNop())
 			
 			// Test that server can handle health check
 			req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
@@ -139,8 +140,8 @@ func TestAPIServer_Integration(t *testing.T) {
 		})
 
 		t.Run("Multiple API server instances", func(t *testing.T) {
-			server1 := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb1", "8081")
-			server2 := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb2", "8082")
+			server1 := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb1", "8081", zap.NewNop())
+			server2 := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb2", "8082", zap.NewNop())
 
 			assert.NotEqual(t, server1.dbName, server2.dbName)
 			assert.NotEqual(t, server1.port, server2.port)
@@ -156,7 +157,7 @@ func TestAPIServer_ErrorHandling(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
 		
 		t.Run("Health check with context cancellation", func(t *testing.T) {
-			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085")
+			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085", zap.NewNop())
 
 			req := httptest.NewRequest(http.MethodGet, "/health", nil)
 			
@@ -174,7 +175,7 @@ func TestAPIServer_ErrorHandling(t *testing.T) {
 		})
 
 		t.Run("Health check with nil request body", func(t *testing.T) {
-			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085")
+			server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085", zap.NewNop())
 
 			req := httptest.NewRequest(http.MethodGet, "/health", nil)
 			w := httptest.NewRecorder()
@@ -198,7 +199,7 @@ func BenchmarkAPIServer_HealthCheck(b *testing.B) {
 	testDB, _ := testutils.SetupTestDB()
 	defer testDB.Cleanup()
 
-	server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085")
+	server := NewAPIServer(testDB.UserCol, testDB.ConvCol, testDB.MsgCol, "testdb", "8085", zap.NewNop())
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
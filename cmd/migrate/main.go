@@ -0,0 +1,434 @@
+// Command migrate runs the one-off data migrations. Each migration only touches
+// documents that still need it, so running the command again is safe.
+//
+// With -admin it also promotes the account with that email to admin, which is
+// how the first admin of an installation is created.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"lite-chat-go/config"
+	"lite-chat-go/models"
+	"lite-chat-go/richtext"
+	"lite-chat-go/service/conversation"
+	"lite-chat-go/service/moderation"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const batchSize = 500
+
+type migration struct {
+	name string
+	run  func(ctx context.Context, db *mongo.Database) (int64, error)
+}
+
+var migrations = []migration{
+	{"backfill message conversationId", backfillConversationIDs},
+	{"backfill direct conversation pairKey", backfillPairKeys},
+	{"backfill message plainText and entities", backfillPlainText},
+	{"backfill report pending flag", backfillPendingReports},
+	{"backfill moderation log workspaceId", backfillLogWorkspaces},
+	{"backfill default workspace members", backfillDefaultMembers},
+}
+
+func main() {
+	admin := flag.String("admin", "", "email of an account to promote to admin")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.Envs.MongoUrl))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database(config.Envs.Database)
+	for _, m := range migrations {
+		updated, err := m.run(ctx, db)
+		if err != nil {
+			log.Fatalf("%s: %v", m.name, err)
+		}
+		log.Printf("%s: %d documents updated", m.name, updated)
+	}
+
+	if *admin != "" {
+		if err := promoteAdmin(ctx, db, *admin); err != nil {
+			log.Fatalf("promote %s: %v", *admin, err)
+		}
+		log.Printf("%s is now an admin", *admin)
+	}
+}
+
+// promoteAdmin gives the account with email the admin role. Tokens pick the
+// role up on their next request.
+func promoteAdmin(ctx context.Context, db *mongo.Database, email string) error {
+	result, err := db.Collection("users").UpdateOne(ctx,
+		bson.M{"email": email},
+		bson.M{"$set": bson.M{"role": types.RoleAdmin, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("no account with this email")
+	}
+	return nil
+}
+
+// backfillConversationIDs sets conversationId on messages created before it was
+// stored on the message, looking the conversation up by its messages array.
+func backfillConversationIDs(ctx context.Context, db *mongo.Database) (int64, error) {
+	messages := db.Collection("messages")
+	conversations := db.Collection("conversations")
+
+	cursor, err := messages.Find(ctx,
+		bson.M{"conversationId": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	flush := func(batch []primitive.ObjectID) error {
+		pending := make(map[primitive.ObjectID]bool, len(batch))
+		for _, id := range batch {
+			pending[id] = true
+		}
+
+		cursor, err := conversations.Find(ctx,
+			bson.M{"messages": bson.M{"$in": batch}},
+			options.Find().SetProjection(bson.M{"_id": 1, "messages": 1}),
+		)
+		if err != nil {
+			return err
+		}
+
+		var owners []models.Conversation
+		if err := cursor.All(ctx, &owners); err != nil {
+			return err
+		}
+
+		for _, owner := range owners {
+			var ids []primitive.ObjectID
+			for _, id := range owner.Messages {
+				if pending[id] {
+					ids = append(ids, id)
+				}
+			}
+
+			result, err := messages.UpdateMany(ctx,
+				bson.M{"_id": bson.M{"$in": ids}, "conversationId": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"conversationId": owner.ID}},
+			)
+			if err != nil {
+				return err
+			}
+			updated += result.ModifiedCount
+		}
+		return nil
+	}
+
+	batch := make([]primitive.ObjectID, 0, batchSize)
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			return updated, err
+		}
+
+		batch = append(batch, message.ID)
+		if len(batch) == batchSize {
+			if err := flush(batch); err != nil {
+				return updated, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, nil
+}
+
+// backfillPairKeys keys the direct conversations created before pairKey existed,
+// oldest first. When two users already have duplicate direct conversations only
+// the oldest gets the key, the others are logged so they can be merged by hand.
+func backfillPairKeys(ctx context.Context, db *mongo.Database) (int64, error) {
+	conversations := db.Collection("conversations")
+
+	// The unique index has to exist before any key is written to catch duplicates
+	if _, err := conversations.Indexes().CreateOne(ctx, conversation.DirectPairIndex()); err != nil {
+		return 0, err
+	}
+
+	cursor, err := conversations.Find(ctx,
+		bson.M{"type": bson.M{"$exists": false}, "pairKey": bson.M{"$exists": false}, "participants": bson.M{"$size": 2}},
+		options.Find().
+			SetProjection(bson.M{"_id": 1, "participants": 1}).
+			SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	for cursor.Next(ctx) {
+		var direct models.Conversation
+		if err := cursor.Decode(&direct); err != nil {
+			return updated, err
+		}
+
+		pairKey := models.DirectPairKey(direct.Participants[0], direct.Participants[1])
+		_, err := conversations.UpdateByID(ctx, direct.ID, bson.M{"$set": bson.M{"pairKey": pairKey}})
+		if mongo.IsDuplicateKeyError(err) {
+			log.Printf("conversation %s duplicates the direct conversation %s, left without a pairKey", direct.ID.Hex(), pairKey)
+			continue
+		} else if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
+
+// backfillPlainText parses messages stored before rich text into the plain text
+// search runs against and their formatting entities.
+func backfillPlainText(ctx context.Context, db *mongo.Database) (int64, error) {
+	messages := db.Collection("messages")
+
+	cursor, err := messages.Find(ctx,
+		bson.M{"plainText": bson.M{"$exists": false}, "message": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 1, "message": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	flush := func(batch []mongo.WriteModel) error {
+		result, err := messages.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += result.ModifiedCount
+		return nil
+	}
+
+	batch := make([]mongo.WriteModel, 0, batchSize)
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			return updated, err
+		}
+
+		// An empty plainText is still written so the message isn't picked up again
+		plain, entities := richtext.Parse(message.Message)
+		set := bson.M{"plainText": plain}
+		if len(entities) > 0 {
+			set["entities"] = entities
+		}
+
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": message.ID, "plainText": bson.M{"$exists": false}}).
+			SetUpdate(bson.M{"$set": set}))
+		if len(batch) == batchSize {
+			if err := flush(batch); err != nil {
+				return updated, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, nil
+}
+
+// backfillPendingReports flags reports that aren't resolved yet so the unique
+// pending index covers them. Of several pending reports by the same reporter on
+// the same target only the oldest is flagged.
+func backfillPendingReports(ctx context.Context, db *mongo.Database) (int64, error) {
+	reports := db.Collection("reports")
+
+	if _, err := reports.Indexes().CreateOne(ctx, moderation.PendingReportIndex()); err != nil {
+		return 0, err
+	}
+
+	cursor, err := reports.Find(ctx,
+		bson.M{"status": bson.M{"$ne": models.ReportStatusResolved}, "pending": bson.M{"$exists": false}},
+		options.Find().
+			SetProjection(bson.M{"_id": 1}).
+			SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	for cursor.Next(ctx) {
+		var report models.Report
+		if err := cursor.Decode(&report); err != nil {
+			return updated, err
+		}
+
+		_, err := reports.UpdateByID(ctx, report.ID, bson.M{"$set": bson.M{"pending": true}})
+		if mongo.IsDuplicateKeyError(err) {
+			log.Printf("report %s duplicates an older pending report, left unflagged", report.ID.Hex())
+			continue
+		} else if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
+
+// backfillLogWorkspaces copies the workspace of each report onto its audit trail
+// entries written before the log recorded it.
+func backfillLogWorkspaces(ctx context.Context, db *mongo.Database) (int64, error) {
+	logEntries := db.Collection("moderation_log")
+
+	cursor, err := db.Collection("reports").Find(ctx,
+		bson.M{"workspaceId": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 1, "workspaceId": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	flush := func(batch []mongo.WriteModel) error {
+		result, err := logEntries.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += result.ModifiedCount
+		return nil
+	}
+
+	batch := make([]mongo.WriteModel, 0, batchSize)
+	for cursor.Next(ctx) {
+		var report models.Report
+		if err := cursor.Decode(&report); err != nil {
+			return updated, err
+		}
+
+		batch = append(batch, mongo.NewUpdateManyModel().
+			SetFilter(bson.M{"reportId": report.ID, "workspaceId": bson.M{"$exists": false}}).
+			SetUpdate(bson.M{"$set": bson.M{"workspaceId": report.WorkspaceID}}))
+		if len(batch) == batchSize {
+			if err := flush(batch); err != nil {
+				return updated, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, nil
+}
+
+// backfillDefaultMembers records default workspace membership for users who
+// signed up before it was recorded. Users who already belong to a named
+// workspace are left out of the default one, they stay reachable through the
+// workspaces they share.
+func backfillDefaultMembers(ctx context.Context, db *mongo.Database) (int64, error) {
+	members := db.Collection(tenant.MemberCollection)
+
+	memberIds, err := members.Distinct(ctx, "userId", bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	if memberIds == nil {
+		memberIds = bson.A{}
+	}
+
+	cursor, err := db.Collection("users").Find(ctx,
+		bson.M{"_id": bson.M{"$nin": memberIds}},
+		options.Find().SetProjection(bson.M{"_id": 1, "createdAt": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	flush := func(batch []mongo.WriteModel) error {
+		result, err := members.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += result.UpsertedCount
+		return nil
+	}
+
+	batch := make([]mongo.WriteModel, 0, batchSize)
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return updated, err
+		}
+
+		joinedAt := user.CreatedAt
+		if joinedAt.IsZero() {
+			joinedAt = time.Now()
+		}
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"workspaceId": bson.M{"$exists": false}, "userId": user.ID}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"userId": user.ID, "joinedAt": joinedAt}}).
+			SetUpsert(true))
+		if len(batch) == batchSize {
+			if err := flush(batch); err != nil {
+				return updated, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, nil
+}
@@ -26,6 +26,8 @@ type Config struct {
 	BaseUrl                string
 	ClientBaseUrl          string
 	Environment            string
+	PresenceTTLInSeconds   int64
+	UploadDir              string
 }
 
 var Envs = initConfig()
@@ -51,6 +53,8 @@ func initConfig() Config {
 		BaseUrl:                getEnv("BASE_URL", ""),
 		ClientBaseUrl:          getEnv("CLIENT_BASE_URL", ""),
 		Environment:            getEnv("ENVIRONMENT", "development"),
+		PresenceTTLInSeconds:   getEnvInt("PRESENCE_TTL", 60),
+		UploadDir:              getEnv("UPLOAD_DIR", "uploads"),
 	}
 
 }
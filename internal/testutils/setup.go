@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"lite-chat-go/models"
+	"lite-chat-go/tenant"
 	"lite-chat-go/utils"
 	"log"
 	"os"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tryvium-travels/memongo"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -29,7 +31,11 @@ type TestDB struct {
 
 // SetupTestDB creates an in-memory MongoDB instance for testing
 func SetupTestDB() (*TestDB, error) {
-	mongoServer, err := memongo.Start("6.0.5")
+	// A single-node replica set is needed for multi-document transactions
+	mongoServer, err := memongo.StartWithOptions(&memongo.Options{
+		MongoVersion:     "6.0.5",
+		ShouldUseReplica: true,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to start memongo: %w", err)
 	}
@@ -112,6 +118,11 @@ func (tdb *TestDB) CreateTestUser(email, username, fullname string) (*models.Use
 		return nil, err
 	}
 
+	// Like a sign up, the user joins the default workspace
+	if err := tenant.JoinDefault(context.Background(), tdb.Database, user.ID); err != nil {
+		return nil, err
+	}
+
 	return user, nil
 }
 
@@ -122,7 +133,9 @@ func (tdb *TestDB) CreateTestMessage(senderID, receiverID primitive.ObjectID, me
 		SenderID:   senderID,
 		ReceiverID: receiverID,
 		Message:    message,
+		PlainText:  message,
 		IsRead:     false,
+		Status:     models.MessageStatusSent,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
@@ -150,6 +163,17 @@ func (tdb *TestDB) CreateTestConversation(participants []primitive.ObjectID, mes
 		return nil, err
 	}
 
+	if len(messageIDs) > 0 {
+		_, err = tdb.MsgCol.UpdateMany(
+			context.Background(),
+			bson.M{"_id": bson.M{"$in": messageIDs}},
+			bson.M{"$set": bson.M{"conversationId": conv.ID}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return conv, nil
 }
 
@@ -0,0 +1,85 @@
+package linkpreview
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"sync"
+	"time"
+)
+
+const maxCacheEntries = 1000
+
+type cacheEntry struct {
+	preview   *models.LinkPreview
+	err       error
+	expiresAt time.Time
+}
+
+// CachedFetcher remembers results by URL. Failures are cached for a shorter
+// time so a broken link isn't fetched again for every message.
+type CachedFetcher struct {
+	fetcher  Fetcher
+	ttl      time.Duration
+	errorTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewCachedFetcher(fetcher Fetcher, ttl time.Duration) *CachedFetcher {
+	return &CachedFetcher{
+		fetcher:  fetcher,
+		ttl:      ttl,
+		errorTTL: ttl / 10,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+func (c *CachedFetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[rawURL]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return copyPreview(entry.preview), entry.err
+	}
+
+	preview, err := c.fetcher.Fetch(ctx, rawURL)
+	if ctx.Err() != nil {
+		// Our own deadline, not the link's fault
+		return nil, err
+	}
+
+	ttl := c.ttl
+	if err != nil {
+		ttl = c.errorTTL
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= maxCacheEntries {
+		c.evictExpired(now)
+	}
+	if len(c.entries) < maxCacheEntries {
+		c.entries[rawURL] = cacheEntry{preview: preview, err: err, expiresAt: now.Add(ttl)}
+	}
+	c.mu.Unlock()
+
+	return copyPreview(preview), err
+}
+
+func (c *CachedFetcher) evictExpired(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func copyPreview(preview *models.LinkPreview) *models.LinkPreview {
+	if preview == nil {
+		return nil
+	}
+	p := *preview
+	return &p
+}
@@ -0,0 +1,63 @@
+package linkpreview
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"sync"
+	"time"
+)
+
+// FakeFetcher serves canned previews for tests and records what was requested.
+type FakeFetcher struct {
+	mu       sync.Mutex
+	previews map[string]models.LinkPreview
+	errs     map[string]error
+	calls    []string
+}
+
+func NewFakeFetcher() *FakeFetcher {
+	return &FakeFetcher{
+		previews: make(map[string]models.LinkPreview),
+		errs:     make(map[string]error),
+	}
+}
+
+func (f *FakeFetcher) Set(rawURL string, preview models.LinkPreview) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.previews[rawURL] = preview
+}
+
+func (f *FakeFetcher) SetError(rawURL string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[rawURL] = err
+}
+
+// Calls returns the URLs fetched so far, in order.
+func (f *FakeFetcher) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *FakeFetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, rawURL)
+
+	if err, ok := f.errs[rawURL]; ok {
+		return nil, err
+	}
+
+	preview, ok := f.previews[rawURL]
+	if !ok {
+		return nil, ErrNotHTML
+	}
+
+	preview.URL = rawURL
+	if preview.FetchedAt.IsZero() {
+		preview.FetchedAt = time.Now()
+	}
+	return &preview, nil
+}
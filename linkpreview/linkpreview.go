@@ -0,0 +1,292 @@
+// Package linkpreview fetches title and OpenGraph metadata for links posted in
+// messages. Fetching is behind the Fetcher interface so tests never touch the network.
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lite-chat-go/models"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultMaxBytes = 512 << 10
+
+	maxRedirects   = 3
+	maxFieldLength = 300
+)
+
+var (
+	ErrUnsupportedURL = errors.New("linkpreview: only http and https links on ports 80 and 443 are fetched")
+	ErrBlockedAddress = errors.New("linkpreview: address is not publicly routable")
+	ErrNotHTML        = errors.New("linkpreview: response is not html")
+)
+
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error)
+}
+
+// HTTPFetcher fetches pages over the network. Every connection is checked after
+// DNS resolution, so redirects and rebinding can't reach private addresses.
+type HTTPFetcher struct {
+	client    *http.Client
+	maxBytes  int64
+	isBlocked func(ip net.IP) bool
+}
+
+func NewHTTPFetcher(timeout time.Duration, maxBytes int64) *HTTPFetcher {
+	f := &HTTPFetcher{
+		maxBytes:  maxBytes,
+		isBlocked: IsBlockedIP,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || f.isBlocked(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// A proxy would move the connection check onto the proxy's address
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("linkpreview: stopped after %d redirects", maxRedirects)
+			}
+			return checkURL(req.URL)
+		},
+	}
+
+	return f
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkURL(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	preview, err := f.fetchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	preview.URL = rawURL
+
+	return preview, nil
+}
+
+func (f *HTTPFetcher) fetchRequest(req *http.Request) (*models.LinkPreview, error) {
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "LiteChatLinkPreview/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, ErrBlockedAddress
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("linkpreview: unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	preview := parseHTML(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL)
+	preview.URL = req.URL.String()
+	preview.FetchedAt = time.Now()
+
+	return preview, nil
+}
+
+// IsBlockedIP reports whether ip is loopback, private, link-local or otherwise
+// not a public unicast address.
+func IsBlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+
+	for _, block := range reservedBlocks {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var reservedBlocks = func() []*net.IPNet {
+	var blocks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"64:ff9b::/96",
+	} {
+		_, block, _ := net.ParseCIDR(cidr)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}()
+
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return ErrUnsupportedURL
+	}
+
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return ErrUnsupportedURL
+	}
+
+	return nil
+}
+
+// parseHTML reads title and OpenGraph tags from the document head.
+func parseHTML(r io.Reader, base *url.URL) *models.LinkPreview {
+	preview := &models.LinkPreview{}
+	var title, description string
+
+	tokenizer := html.NewTokenizer(r)
+loop:
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break loop
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		switch token.Data {
+		case "body":
+			// Everything we read lives in the head
+			break loop
+		case "title":
+			if tokenizer.Next() == html.TextToken && title == "" {
+				title = string(tokenizer.Text())
+			}
+		case "meta":
+			key, content := metaAttributes(token)
+			switch key {
+			case "og:title":
+				preview.Title = content
+			case "og:description":
+				preview.Description = content
+			case "og:site_name":
+				preview.SiteName = content
+			case "og:image", "og:image:url":
+				if preview.ImageURL == "" {
+					preview.ImageURL = resolveImage(base, content)
+				}
+			case "description":
+				description = content
+			}
+		}
+	}
+
+	if preview.Title == "" {
+		preview.Title = title
+	}
+	if preview.Description == "" {
+		preview.Description = description
+	}
+
+	preview.Title = clean(preview.Title)
+	preview.Description = clean(preview.Description)
+	preview.SiteName = clean(preview.SiteName)
+
+	return preview
+}
+
+func metaAttributes(token html.Token) (string, string) {
+	var key, content string
+	for _, attr := range token.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	return key, content
+}
+
+// resolveImage only keeps images the client can load over http(s).
+func resolveImage(base *url.URL, raw string) string {
+	ref, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+
+	return resolved.String()
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+func clean(s string) string {
+	s = strings.TrimSpace(whitespace.ReplaceAllString(s, " "))
+
+	runes := []rune(s)
+	if len(runes) > maxFieldLength {
+		return strings.TrimSpace(string(runes[:maxFieldLength])) + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,27 @@
+package linkpreview
+
+import (
+	"lite-chat-go/models"
+	"regexp"
+	"strings"
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// FirstURL picks the link a message should be previewed for: the first link
+// entity, otherwise the first bare http(s) URL in the plain text.
+func FirstURL(message models.Message) string {
+	for _, entity := range message.Entities {
+		if entity.Type == models.TextEntityLink && strings.HasPrefix(entity.URL, "http") {
+			return entity.URL
+		}
+	}
+
+	text := message.PlainText
+	if text == "" {
+		text = message.Message
+	}
+
+	// Trailing punctuation usually ends the sentence, not the URL
+	return strings.TrimRight(urlPattern.FindString(text), ".,;:!?)]}'")
+}
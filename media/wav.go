@@ -0,0 +1,181 @@
+// Package media inspects uploaded audio so clients can render voice notes
+// without downloading them first.
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xFFFE
+)
+
+var (
+	ErrNotWAV            = errors.New("media: not a RIFF/WAVE file")
+	ErrUnsupportedFormat = errors.New("media: only PCM and float WAV audio is supported")
+	ErrNoAudioData       = errors.New("media: WAV file has no audio data")
+)
+
+// WAV is a parsed RIFF/WAVE file holding PCM or IEEE float samples.
+type WAV struct {
+	Format        uint16
+	Channels      int
+	SampleRate    int
+	BitsPerSample int
+	data          []byte
+	blockAlign    int
+}
+
+// ParseWAV reads the fmt and data chunks of a WAV file.
+func ParseWAV(b []byte) (*WAV, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	var w WAV
+	var haveFormat bool
+
+	for pos := 12; pos+8 <= len(b); {
+		id := string(b[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(b[pos+4 : pos+8]))
+		body := pos + 8
+		end := body + size
+		// Streamed files often leave the size unset, clamp to what we have
+		if size < 0 || end > len(b) {
+			end = len(b)
+		}
+
+		switch id {
+		case "fmt ":
+			if end-body < 16 {
+				return nil, ErrNotWAV
+			}
+			chunk := b[body:end]
+			w.Format = binary.LittleEndian.Uint16(chunk[0:2])
+			w.Channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			w.SampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			w.blockAlign = int(binary.LittleEndian.Uint16(chunk[12:14]))
+			w.BitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+			if w.Format == formatExtensible && len(chunk) >= 26 {
+				w.Format = binary.LittleEndian.Uint16(chunk[24:26])
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return nil, ErrNotWAV
+			}
+			w.data = b[body:end]
+		}
+
+		if w.data != nil {
+			break
+		}
+
+		// Chunks are word aligned
+		pos = end + size%2
+	}
+
+	if !haveFormat {
+		return nil, ErrNotWAV
+	}
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	if w.Frames() == 0 {
+		return nil, ErrNoAudioData
+	}
+
+	return &w, nil
+}
+
+func (w *WAV) validate() error {
+	if w.Channels < 1 || w.SampleRate < 1 {
+		return ErrUnsupportedFormat
+	}
+
+	switch {
+	case w.Format == formatPCM && (w.BitsPerSample == 8 || w.BitsPerSample == 16 || w.BitsPerSample == 24 || w.BitsPerSample == 32):
+	case w.Format == formatFloat && w.BitsPerSample == 32:
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	if w.blockAlign != w.Channels*w.BitsPerSample/8 {
+		return ErrUnsupportedFormat
+	}
+
+	return nil
+}
+
+// Frames is the number of samples per channel.
+func (w *WAV) Frames() int {
+	return len(w.data) / w.blockAlign
+}
+
+func (w *WAV) Duration() time.Duration {
+	return time.Duration(w.Frames()) * time.Second / time.Duration(w.SampleRate)
+}
+
+// Waveform downsamples the audio into buckets peak levels between 0 and 100,
+// scaled so the loudest bucket is 100.
+func (w *WAV) Waveform(buckets int) []int {
+	frames := w.Frames()
+	if buckets > frames {
+		buckets = frames
+	}
+
+	peaks := make([]float64, buckets)
+	bytesPerSample := w.BitsPerSample / 8
+	var loudest float64
+
+	for frame := 0; frame < frames; frame++ {
+		bucket := frame * buckets / frames
+		offset := frame * w.blockAlign
+
+		for channel := 0; channel < w.Channels; channel++ {
+			level := math.Abs(w.sample(w.data[offset+channel*bytesPerSample:]))
+			if level > peaks[bucket] {
+				peaks[bucket] = level
+			}
+		}
+
+		if peaks[bucket] > loudest {
+			loudest = peaks[bucket]
+		}
+	}
+
+	waveform := make([]int, buckets)
+	if loudest == 0 {
+		return waveform
+	}
+
+	for i, peak := range peaks {
+		waveform[i] = int(math.Round(peak / loudest * 100))
+	}
+
+	return waveform
+}
+
+// sample decodes one sample to the range [-1, 1].
+func (w *WAV) sample(b []byte) float64 {
+	switch {
+	case w.Format == formatFloat:
+		v := float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		return math.Max(-1, math.Min(1, v))
+	case w.BitsPerSample == 8:
+		// 8-bit PCM is unsigned
+		return (float64(b[0]) - 128) / 128
+	case w.BitsPerSample == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case w.BitsPerSample == 24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / 8388608
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+}
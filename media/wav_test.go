@@ -0,0 +1,108 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildWAV encodes 16-bit mono PCM samples into a WAV file.
+func buildWAV(sampleRate int, samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(s))
+	}
+
+	b := []byte("RIFF\x00\x00\x00\x00WAVE")
+	b = append(b, "fmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, formatPCM)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, uint32(sampleRate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(sampleRate*2))
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	// An unrelated chunk with an odd size exercises the padding rule
+	b = append(b, "LIST"...)
+	b = binary.LittleEndian.AppendUint32(b, 3)
+	b = append(b, 'a', 'b', 'c', 0)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(b)-8))
+
+	return b
+}
+
+func TestParseWAV(t *testing.T) {
+	t.Run("Duration and format", func(t *testing.T) {
+		wav, err := ParseWAV(buildWAV(8000, make([]int16, 12000)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, wav.Channels)
+		assert.Equal(t, 8000, wav.SampleRate)
+		assert.Equal(t, 16, wav.BitsPerSample)
+		assert.Equal(t, 1500*time.Millisecond, wav.Duration())
+	})
+
+	t.Run("Not a WAV file", func(t *testing.T) {
+		_, err := ParseWAV([]byte("ID3\x03\x00 definitely an mp3"))
+
+		assert.ErrorIs(t, err, ErrNotWAV)
+	})
+
+	t.Run("Empty data chunk", func(t *testing.T) {
+		_, err := ParseWAV(buildWAV(8000, nil))
+
+		assert.ErrorIs(t, err, ErrNoAudioData)
+	})
+
+	t.Run("Compressed WAV is unsupported", func(t *testing.T) {
+		b := buildWAV(8000, make([]int16, 10))
+		binary.LittleEndian.PutUint16(b[20:22], 0x55) // MP3 in a WAV container
+
+		_, err := ParseWAV(b)
+
+		assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	})
+
+	t.Run("Truncated data chunk is clamped", func(t *testing.T) {
+		b := buildWAV(8000, make([]int16, 800))
+
+		wav, err := ParseWAV(b[:len(b)-800])
+
+		assert.NoError(t, err)
+		assert.Equal(t, 400, wav.Frames())
+	})
+}
+
+func TestWaveform(t *testing.T) {
+	t.Run("Peaks are scaled to the loudest bucket", func(t *testing.T) {
+		// Four equal segments: silence, quarter, half and full volume
+		samples := make([]int16, 400)
+		for i := range samples {
+			samples[i] = int16(float64(i/100) / 3 * math.MaxInt16)
+			if i%2 == 1 {
+				samples[i] = -samples[i]
+			}
+		}
+		wav, _ := ParseWAV(buildWAV(8000, samples))
+
+		assert.Equal(t, []int{0, 33, 67, 100}, wav.Waveform(4))
+	})
+
+	t.Run("Silence is flat", func(t *testing.T) {
+		wav, _ := ParseWAV(buildWAV(8000, make([]int16, 1000)))
+
+		assert.Equal(t, make([]int, 64), wav.Waveform(64))
+	})
+
+	t.Run("Fewer frames than buckets", func(t *testing.T) {
+		wav, _ := ParseWAV(buildWAV(8000, []int16{100, -200, 300}))
+
+		assert.Len(t, wav.Waveform(64), 3)
+	})
+}
@@ -0,0 +1,54 @@
+// Package membership answers which conversations a user can read: the ones
+// they take part in, and the channels they subscribe to without taking part.
+package membership
+
+import (
+	"context"
+	"lite-chat-go/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SubscriptionCollection holds one document per channel and subscriber.
+const SubscriptionCollection = "channel_subscriptions"
+
+// Filter matches every conversation userId takes part in or subscribes to.
+// Callers add their own conditions and the tenant scope to the result.
+func Filter(ctx context.Context, db *mongo.Database, userId primitive.ObjectID) (bson.M, error) {
+	channelIds, err := db.Collection(SubscriptionCollection).Distinct(ctx, "channelId", bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	return filter(userId, channelIds), nil
+}
+
+func filter(userId primitive.ObjectID, channelIds []interface{}) bson.M {
+	if len(channelIds) == 0 {
+		return bson.M{"participants": userId}
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{"participants": userId},
+		bson.M{"_id": bson.M{"$in": channelIds}},
+	}}
+}
+
+// IsSubscribed reports whether userId subscribes to the channel.
+func IsSubscribed(ctx context.Context, db *mongo.Database, channelId primitive.ObjectID, userId primitive.ObjectID) (bool, error) {
+	count, err := db.Collection(SubscriptionCollection).CountDocuments(ctx, bson.M{"channelId": channelId, "userId": userId})
+	return count > 0, err
+}
+
+// IsMember reports whether userId can read the conversation.
+func IsMember(ctx context.Context, db *mongo.Database, conversation *models.Conversation, userId primitive.ObjectID) (bool, error) {
+	if conversation.IsParticipant(userId) {
+		return true, nil
+	}
+	if !conversation.IsChannel() {
+		return false, nil
+	}
+	return IsSubscribed(ctx, db, conversation.ID, userId)
+}
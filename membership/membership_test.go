@@ -0,0 +1,26 @@
+package membership
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilter(t *testing.T) {
+	userId := primitive.NewObjectID()
+
+	t.Run("Participants only without subscriptions", func(t *testing.T) {
+		assert.Equal(t, bson.M{"participants": userId}, filter(userId, nil))
+	})
+
+	t.Run("Subscribed channels next to the participants", func(t *testing.T) {
+		channelId := primitive.NewObjectID()
+
+		assert.Equal(t, bson.M{"$or": bson.A{
+			bson.M{"participants": userId},
+			bson.M{"_id": bson.M{"$in": []interface{}{channelId}}},
+		}}, filter(userId, []interface{}{channelId}))
+	})
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"lite-chat-go/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserAccount is a user as administrators see it, without credentials or
+// provider tokens.
+type UserAccount struct {
+	ID            primitive.ObjectID `bson:"_id" json:"_id"`
+	Fullname      string             `bson:"fullname" json:"fullname"`
+	Username      string             `bson:"username" json:"username"`
+	Email         string             `bson:"email" json:"email"`
+	Avatar        string             `bson:"avatar" json:"avatar"`
+	Role          types.Role         `bson:"role,omitempty" json:"role"`
+	IsActive      bool               `bson:"isActive" json:"isActive"`
+	EmailVerified bool               `bson:"IsEmailVerified" json:"IsEmailVerified"`
+	Provider      *AuthProvider      `bson:"provider,omitempty" json:"provider,omitempty"`
+	LastSeenAt    *time.Time         `bson:"lastSeenAt,omitempty" json:"lastSeenAt,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+type UserAccountListResponse struct {
+	Results []UserAccount `json:"results"`
+	Page    int           `json:"page"`
+	Limit   int           `json:"limit"`
+	HasMore bool          `json:"hasMore"`
+}
+
+type UpdateRolePayload struct {
+	Role types.Role `json:"role" validate:"required"`
+}
+
+type ResetPasswordPayload struct {
+	Password string `json:"password" validate:"required,min=3,max=130"`
+}
+
+type SystemStats struct {
+	Users            int64 `json:"users"`
+	ActiveUsers      int64 `json:"activeUsers"`
+	DeactivatedUsers int64 `json:"deactivatedUsers"`
+	Moderators       int64 `json:"moderators"`
+	Admins           int64 `json:"admins"`
+	Conversations    int64 `json:"conversations"`
+	Groups           int64 `json:"groups"`
+	Channels         int64 `json:"channels"`
+	Messages         int64 `json:"messages"`
+	MessagesLastDay  int64 `json:"messagesLastDay"`
+	Workspaces       int64 `json:"workspaces"`
+}
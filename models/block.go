@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Block keeps BlockedID from messaging BlockerID directly and the two of them
+// out of each other's groups.
+type Block struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	BlockerID primitive.ObjectID `bson:"blockerId" json:"blockerId"`
+	BlockedID primitive.ObjectID `bson:"blockedId" json:"blockedId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChannelSubscription makes a user a read-only member of a channel.
+type ChannelSubscription struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	ChannelID primitive.ObjectID `bson:"channelId" json:"channelId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type CreateChannelPayload struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	Public      bool   `json:"public"`
+}
+
+// ChannelSummary is a channel as listed in the directory.
+type ChannelSummary struct {
+	ID              primitive.ObjectID `bson:"_id" json:"_id"`
+	Name            string             `bson:"name" json:"name"`
+	Description     string             `bson:"description,omitempty" json:"description,omitempty"`
+	SubscriberCount int64              `bson:"subscriberCount" json:"subscriberCount"`
+}
+
+type ChannelDirectoryResponse struct {
+	Results []ChannelSummary `json:"results"`
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+	HasMore bool             `json:"hasMore"`
+}
@@ -6,18 +6,180 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ConversationType is empty for direct messages.
+type ConversationType string
+
+const (
+	ConversationTypeGroup   ConversationType = "group"
+	ConversationTypeChannel ConversationType = "channel"
+)
+
+const MaxGroupMembers = 256
+
+// Conversation is a direct message, group or channel. Channel participants are
+// the owner and admins, subscribers are kept in their own collection.
 type Conversation struct {
-	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"_id"`
-	Participants []primitive.ObjectID `bson:"participants,omitempty" json:"participants"`
-	Messages     []primitive.ObjectID `bson:"messages,omitempty" json:"messages"`
-	CreatedAt    time.Time            `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt    time.Time            `bson:"updatedAt,omitempty" json:"updatedAt"`
+	ID              primitive.ObjectID   `bson:"_id,omitempty" json:"_id"`
+	WorkspaceID     primitive.ObjectID   `bson:"workspaceId,omitempty" json:"-"`
+	Type            ConversationType     `bson:"type,omitempty" json:"type,omitempty"`
+	PairKey         string               `bson:"pairKey,omitempty" json:"-"`
+	Name            string               `bson:"name,omitempty" json:"name,omitempty"`
+	OwnerID         *primitive.ObjectID  `bson:"ownerId,omitempty" json:"ownerId,omitempty"`
+	Admins          []primitive.ObjectID `bson:"admins,omitempty" json:"admins,omitempty"`
+	Description     string               `bson:"description,omitempty" json:"description,omitempty"`
+	Public          bool                 `bson:"public,omitempty" json:"public,omitempty"`
+	SubscriberCount int64                `bson:"subscriberCount,omitempty" json:"subscriberCount,omitempty"`
+	Participants    []primitive.ObjectID `bson:"participants,omitempty" json:"participants"`
+	Messages        []primitive.ObjectID `bson:"messages,omitempty" json:"messages"`
+	MessageTimer    int64                `bson:"messageTimer,omitempty" json:"messageTimer"`
+	Pinned          []PinnedMessage      `bson:"pinnedMessages,omitempty" json:"pinnedMessages,omitempty"`
+	CreatedAt       time.Time            `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt       time.Time            `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
 type ConversationWithSingleParticipant struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
-	Participant UserPublic         `bson:"participants,omitempty" json:"participants"`
-	Messages    []Message          `bson:"messages,omitempty" json:"messages"`
-	CreatedAt   time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt   time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	ID          primitive.ObjectID    `bson:"_id,omitempty" json:"_id"`
+	Type        ConversationType      `bson:"type,omitempty" json:"type,omitempty"`
+	Name        string                `bson:"name,omitempty" json:"name,omitempty"`
+	Participant UserPublic            `bson:"participants,omitempty" json:"participants"`
+	LastMessage *LastMessagePreview   `bson:"lastMessage,omitempty" json:"lastMessage"`
+	UnreadCount int64                 `bson:"unreadCount" json:"unreadCount"`
+	Draft       *DraftPreview         `bson:"draft,omitempty" json:"draft,omitempty"`
+	Settings    *ConversationSettings `bson:"settings,omitempty" json:"settings,omitempty"`
+	CreatedAt   time.Time             `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt   time.Time             `bson:"updatedAt,omitempty" json:"updatedAt"`
+}
+
+// ConversationDetail is a single conversation as seen by one of its participants.
+type ConversationDetail struct {
+	ID              primitive.ObjectID   `json:"_id"`
+	Type            ConversationType     `json:"type,omitempty"`
+	Name            string               `json:"name,omitempty"`
+	OwnerID         *primitive.ObjectID  `json:"ownerId,omitempty"`
+	Admins          []primitive.ObjectID `json:"admins,omitempty"`
+	Description     string               `json:"description,omitempty"`
+	Public          bool                 `json:"public,omitempty"`
+	SubscriberCount int64                `json:"subscriberCount,omitempty"`
+	Subscribed      bool                 `json:"subscribed,omitempty"`
+	Participants    []UserPublic         `json:"participants"`
+	MessageTimer    int64                `json:"messageTimer"`
+	PinnedMessages  []PinnedMessage      `json:"pinnedMessages"`
+	UnreadCount     int64                `json:"unreadCount"`
+	Settings        ConversationSettings `json:"settings"`
+	CreatedAt       time.Time            `json:"createdAt"`
+	UpdatedAt       time.Time            `json:"updatedAt"`
+}
+
+type CreateGroupPayload struct {
+	Name      string   `json:"name" validate:"required,max=100"`
+	MemberIDs []string `json:"memberIds" validate:"max=255,dive,required"`
+}
+
+type RenameConversationPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type CreateConversationPayload struct {
+	UserID string `json:"userId" validate:"required"`
+}
+
+// DirectPairKey identifies the direct conversation of two users regardless of
+// who opened it. It is unique per workspace.
+func DirectPairKey(a primitive.ObjectID, b primitive.ObjectID) string {
+	if b.Hex() < a.Hex() {
+		a, b = b, a
+	}
+	return a.Hex() + ":" + b.Hex()
+}
+
+func (c *Conversation) IsGroup() bool {
+	return c.Type == ConversationTypeGroup
+}
+
+func (c *Conversation) IsChannel() bool {
+	return c.Type == ConversationTypeChannel
+}
+
+func (c *Conversation) IsParticipant(userId primitive.ObjectID) bool {
+	for _, participant := range c.Participants {
+		if participant == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// CanPost reports whether userId may send messages. Channel subscribers only read.
+func (c *Conversation) CanPost(userId primitive.ObjectID) bool {
+	if c.IsChannel() {
+		return c.IsAdmin(userId)
+	}
+	return c.IsParticipant(userId)
+}
+
+func (c *Conversation) IsAdmin(userId primitive.ObjectID) bool {
+	for _, admin := range c.Admins {
+		if admin == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// LastMessagePreview is the trimmed down latest message shown in the conversation list.
+type LastMessagePreview struct {
+	ID        primitive.ObjectID `bson:"_id" json:"_id"`
+	SenderID  primitive.ObjectID `bson:"senderId" json:"senderId"`
+	Snippet   string             `bson:"snippet" json:"snippet"`
+	Type      MessageType        `bson:"type,omitempty" json:"type,omitempty"`
+	Kind      MessageKind        `bson:"kind,omitempty" json:"kind,omitempty"`
+	Status    MessageStatus      `bson:"status,omitempty" json:"status,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type ConversationListResponse struct {
+	Results    []ConversationWithSingleParticipant `json:"results"`
+	NextCursor string                              `json:"nextCursor,omitempty"`
+	HasMore    bool                                `json:"hasMore"`
+}
+
+type ConversationMessagesResponse struct {
+	Results []Message `json:"results"`
+	Page    int       `json:"page"`
+	Limit   int       `json:"limit"`
+	HasMore bool      `json:"hasMore"`
+}
+
+type PinnedMessage struct {
+	MessageID primitive.ObjectID `bson:"messageId" json:"messageId"`
+	PinnedBy  primitive.ObjectID `bson:"pinnedBy" json:"pinnedBy"`
+	PinnedAt  time.Time          `bson:"pinnedAt" json:"pinnedAt"`
+}
+
+type PinnedMessageDetail struct {
+	PinnedMessage `bson:",inline"`
+	Message       Message `json:"message"`
+}
+
+type PinMessagePayload struct {
+	MessageID string `json:"messageId" validate:"required"`
+}
+
+// PinEvent is pushed to every participant when a message is pinned or unpinned.
+type PinEvent struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	MessageID      primitive.ObjectID `json:"messageId"`
+	UserID         primitive.ObjectID `json:"userId"`
+	Pinned         bool               `json:"pinned"`
+}
+
+// MessageTimers maps the allowed disappearing-message timers (in seconds) to their label.
+var MessageTimers = map[int64]string{
+	3600:   "1 hour",
+	86400:  "1 day",
+	604800: "7 days",
+}
+
+type ConversationTimerPayload struct {
+	Seconds *int64 `json:"seconds" validate:"required,oneof=0 3600 86400 604800"`
 }
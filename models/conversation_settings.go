@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const MaxPinnedConversations = 5
+
+// ConversationSettings is one user's view of a conversation, kept out of the
+// shared Conversation document. LastReadAt is the member's read position in a
+// group, direct messages track reads on the message itself.
+type ConversationSettings struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID         primitive.ObjectID `bson:"userId" json:"-"`
+	ConversationID primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	Muted          bool               `bson:"muted" json:"muted"`
+	MutedUntil     *time.Time         `bson:"mutedUntil,omitempty" json:"mutedUntil,omitempty"`
+	Archived       bool               `bson:"archived" json:"archived"`
+	Pinned         bool               `bson:"pinned" json:"pinned"`
+	PinOrder       int                `bson:"pinOrder" json:"pinOrder"`
+	ClearedAt      *time.Time         `bson:"clearedAt,omitempty" json:"clearedAt,omitempty"`
+	LastReadAt     *time.Time         `bson:"lastReadAt,omitempty" json:"lastReadAt,omitempty"`
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// IsMuted treats a mute without an end time as indefinite.
+func (s *ConversationSettings) IsMuted(now time.Time) bool {
+	return s.Muted && (s.MutedUntil == nil || now.Before(*s.MutedUntil))
+}
+
+type ConversationSettingsPayload struct {
+	Muted      *bool      `json:"muted"`
+	MutedUntil *time.Time `json:"mutedUntil"`
+	Archived   *bool      `json:"archived"`
+	Pinned     *bool      `json:"pinned"`
+}
+
+type PinnedConversationsPayload struct {
+	ConversationIDs []string `json:"conversationIds" validate:"max=5,dive,required"`
+}
+
+// MessageNotification is pushed to recipients who haven't muted the conversation.
+type MessageNotification struct {
+	MessageID      primitive.ObjectID `json:"messageId"`
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	SenderID       primitive.ObjectID `json:"senderId"`
+	Preview        string             `json:"preview"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Draft is a user's unsent text in a conversation, shared by all their devices.
+type Draft struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID         primitive.ObjectID `bson:"userId" json:"userId"`
+	ConversationID primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	Text           string             `bson:"text" json:"text"`
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+type DraftPreview struct {
+	Text      string    `bson:"text" json:"text"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+type DraftPayload struct {
+	Text string `json:"text" validate:"required,max=4096"`
+}
+
+// DraftEvent is pushed to the user's other sessions. An empty Text means the draft was cleared.
+type DraftEvent struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	Text           string             `json:"text"`
+	UpdatedAt      time.Time          `json:"updatedAt"`
+}
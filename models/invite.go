@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GroupInvite is a shareable link token that lets anyone holding it join a group
+// or subscribe to a private channel.
+type GroupInvite struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Token          string             `bson:"token" json:"token"`
+	ConversationID primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	CreatedBy      primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	ExpiresAt      *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	MaxUses        int                `bson:"maxUses,omitempty" json:"maxUses,omitempty"`
+	Uses           int                `bson:"uses" json:"uses"`
+	RevokedAt      *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+func (i *GroupInvite) IsUsable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+type CreateInvitePayload struct {
+	ExpiresInSeconds int64 `json:"expiresInSeconds" validate:"omitempty,min=60,max=2592000"`
+	MaxUses          int   `json:"maxUses" validate:"omitempty,min=1,max=1000"`
+}
+
+// InvitePreview is what someone sees before joining through a link.
+type InvitePreview struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	Type           ConversationType   `json:"type"`
+	Name           string             `json:"name"`
+	MemberCount    int64              `json:"memberCount"`
+	ExpiresAt      *time.Time         `json:"expiresAt,omitempty"`
+	IsMember       bool               `json:"isMember"`
+}
@@ -1,26 +1,269 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type MessageStatus string
+
+const (
+	MessageStatusSent      MessageStatus = "sent"
+	MessageStatusDelivered MessageStatus = "delivered"
+	MessageStatusRead      MessageStatus = "read"
+)
+
+// MessageKind tells who produced a message. System messages record conversation
+// events and never count as unread.
+type MessageKind string
+
+const (
+	MessageKindUser   MessageKind = "user"
+	MessageKindSystem MessageKind = "system"
+	MessageKindBot    MessageKind = "bot"
+)
+
+// MessageType is the content of a message, plain text when empty.
+type MessageType string
+
+const (
+	MessageTypeText  MessageType = "text"
+	MessageTypePoll  MessageType = "poll"
+	MessageTypeAudio MessageType = "audio"
+)
+
+type SystemEventType string
+
+const (
+	SystemEventTimerChanged SystemEventType = "timer_changed"
+	SystemEventGroupCreated SystemEventType = "group_created"
+	SystemEventMemberJoined SystemEventType = "member_joined"
+	SystemEventMemberLeft   SystemEventType = "member_left"
+	SystemEventRenamed      SystemEventType = "renamed"
+	SystemEventCallMissed   SystemEventType = "call_missed"
+)
+
+// SystemEvent describes what a system message records. Only the fields of its
+// type are set.
+type SystemEvent struct {
+	Type         SystemEventType    `bson:"type" json:"type"`
+	ActorID      primitive.ObjectID `bson:"actorId" json:"actorId"`
+	Timer        *int64             `bson:"timer,omitempty" json:"timer,omitempty"`
+	Name         string             `bson:"name,omitempty" json:"name,omitempty"`
+	PreviousName string             `bson:"previousName,omitempty" json:"previousName,omitempty"`
+	ViaInvite    bool               `bson:"viaInvite,omitempty" json:"viaInvite,omitempty"`
+	CallType     string             `bson:"callType,omitempty" json:"callType,omitempty"`
+}
+
+// Text renders the event the way every client shows it. actor is the display
+// name of ActorID.
+func (e *SystemEvent) Text(actor string) string {
+	if actor == "" {
+		actor = "Someone"
+	}
+
+	switch e.Type {
+	case SystemEventTimerChanged:
+		if e.Timer == nil || *e.Timer == 0 {
+			return fmt.Sprintf("%s turned off disappearing messages", actor)
+		}
+		return fmt.Sprintf("%s set disappearing messages to %s", actor, MessageTimers[*e.Timer])
+	case SystemEventGroupCreated:
+		return fmt.Sprintf("Group \"%s\" created", e.Name)
+	case SystemEventMemberJoined:
+		if e.ViaInvite {
+			return fmt.Sprintf("%s joined using an invite link", actor)
+		}
+		return fmt.Sprintf("%s joined", actor)
+	case SystemEventMemberLeft:
+		return fmt.Sprintf("%s left", actor)
+	case SystemEventRenamed:
+		return fmt.Sprintf("%s changed the name to \"%s\"", actor, e.Name)
+	case SystemEventCallMissed:
+		if e.CallType == "" {
+			return fmt.Sprintf("Missed call from %s", actor)
+		}
+		return fmt.Sprintf("Missed %s call from %s", e.CallType, actor)
+	}
+	return ""
+}
+
 type Message struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
-	SenderID   primitive.ObjectID `bson:"senderId,omitempty" json:"senderId"`
-	ReceiverID primitive.ObjectID `bson:"receiverId,omitempty" json:"receiverId"`
-	Message    string             `bson:"message,omitempty" json:"message"`
-	IsRead     bool               `bson:"isRead" json:"isRead"`
-	CreatedAt  time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt  time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	ConversationID  primitive.ObjectID `bson:"conversationId,omitempty" json:"conversationId"`
+	WorkspaceID     primitive.ObjectID `bson:"workspaceId,omitempty" json:"-"`
+	SenderID        primitive.ObjectID `bson:"senderId,omitempty" json:"senderId"`
+	ReceiverID      primitive.ObjectID `bson:"receiverId,omitempty" json:"receiverId"`
+	Message         string             `bson:"message,omitempty" json:"message"`
+	PlainText       string             `bson:"plainText,omitempty" json:"plainText,omitempty"`
+	Entities        []TextEntity       `bson:"entities,omitempty" json:"entities,omitempty"`
+	ClientMessageID string             `bson:"clientMessageId,omitempty" json:"clientMessageId,omitempty"`
+	IsRead          bool               `bson:"isRead" json:"isRead"`
+	Status          MessageStatus      `bson:"status,omitempty" json:"status"`
+	DeliveredAt     *time.Time         `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+	ReadAt          *time.Time         `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	ExpiresAt       *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	Kind            MessageKind        `bson:"kind,omitempty" json:"kind,omitempty"`
+	Type            MessageType        `bson:"type,omitempty" json:"type,omitempty"`
+	Poll            *Poll              `bson:"poll,omitempty" json:"poll,omitempty"`
+	Attachments     []Attachment       `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	System          *SystemEvent       `bson:"system,omitempty" json:"system,omitempty"`
+	Mentions        []Mention          `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	Preview         *LinkPreview       `bson:"preview,omitempty" json:"preview,omitempty"`
+	Forwarded       bool               `bson:"forwarded,omitempty" json:"forwarded,omitempty"`
+	ForwardedFrom   *ForwardOrigin     `bson:"forwardedFrom,omitempty" json:"forwardedFrom,omitempty"`
+	CreatedAt       time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt       time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
+// MessagePayload addresses a message to a user, or to a group or channel by conversationId.
 type MessagePayload struct {
-	UserId  string `json:"userId" validate:"required"`
-	Message string `json:"message" validate:"required"`
+	UserId          string     `json:"userId" validate:"required_without=ConversationID"`
+	ConversationID  string     `json:"conversationId"`
+	Message         string     `json:"message" validate:"required,max=4096"`
+	ClientMessageID string     `json:"clientMessageId"`
+	ScheduledAt     *time.Time `json:"scheduledAt"`
+}
+
+type TextEntityType string
+
+const (
+	TextEntityBold   TextEntityType = "bold"
+	TextEntityItalic TextEntityType = "italic"
+	TextEntityCode   TextEntityType = "code"
+	TextEntityLink   TextEntityType = "link"
+)
+
+// TextEntity is a formatting range over PlainText, in UTF-16 code units.
+type TextEntity struct {
+	Type   TextEntityType `bson:"type" json:"type"`
+	Offset int            `bson:"offset" json:"offset"`
+	Length int            `bson:"length" json:"length"`
+	URL    string         `bson:"url,omitempty" json:"url,omitempty"`
+}
+
+// Attachment references an uploaded file. Audio attachments also carry what a
+// client needs to draw the voice note bubble.
+type Attachment struct {
+	Key         string `bson:"key" json:"key"`
+	URL         string `bson:"url" json:"url"`
+	ContentType string `bson:"contentType" json:"contentType"`
+	Size        int64  `bson:"size" json:"size"`
+	DurationMs  int64  `bson:"durationMs,omitempty" json:"durationMs,omitempty"`
+	Waveform    []int  `bson:"waveform,omitempty" json:"waveform,omitempty"`
+}
+
+// LinkPreview is the OpenGraph/title metadata fetched for the first link in a message.
+type LinkPreview struct {
+	URL         string    `bson:"url" json:"url"`
+	Title       string    `bson:"title,omitempty" json:"title,omitempty"`
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	ImageURL    string    `bson:"imageUrl,omitempty" json:"imageUrl,omitempty"`
+	SiteName    string    `bson:"siteName,omitempty" json:"siteName,omitempty"`
+	FetchedAt   time.Time `bson:"fetchedAt" json:"fetchedAt"`
+}
+
+// LinkPreviewEvent is pushed to participants once a preview has been attached.
+type LinkPreviewEvent struct {
+	MessageID      primitive.ObjectID `json:"messageId"`
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	Preview        LinkPreview        `json:"preview"`
+}
+
+// Mention is a resolved @username in the message's plain text. Offset and Length are
+// in UTF-16 code units so clients can slice the text directly.
+type Mention struct {
+	UserID   primitive.ObjectID `bson:"userId" json:"userId"`
+	Username string             `bson:"username" json:"username"`
+	Offset   int                `bson:"offset" json:"offset"`
+	Length   int                `bson:"length" json:"length"`
+}
+
+// MentionEvent is pushed to a mentioned participant on top of the normal message event.
+type MentionEvent struct {
+	MessageID      primitive.ObjectID `json:"messageId"`
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	SenderID       primitive.ObjectID `json:"senderId"`
+	Preview        string             `json:"preview"`
+}
+
+type MentionsResponse struct {
+	Results []Message `json:"results"`
+	Page    int       `json:"page"`
+	Limit   int       `json:"limit"`
+	HasMore bool      `json:"hasMore"`
+}
+
+// ForwardOrigin points a forwarded copy back at the message it was first copied from.
+type ForwardOrigin struct {
+	MessageID      primitive.ObjectID `bson:"messageId" json:"messageId"`
+	ConversationID primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	SenderID       primitive.ObjectID `bson:"senderId" json:"senderId"`
+}
+
+type ForwardMessagePayload struct {
+	MessageIDs      []string `json:"messageIds" validate:"required,min=1,max=20,dive,required"`
+	ConversationIDs []string `json:"conversationIds" validate:"required,min=1,max=10,dive,required"`
+	HideOrigin      bool     `json:"hideOrigin"`
 }
 
 type UpdateMessagePayload struct {
 	MessageID string `json:"messageId" validate:"required"`
 }
+
+// MessagesExpired tells participants which disappearing messages were removed.
+type MessagesExpired struct {
+	ConversationID primitive.ObjectID   `json:"conversationId"`
+	MessageIDs     []primitive.ObjectID `json:"messageIds"`
+}
+
+type MarkConversationReadPayload struct {
+	ConversationID string `json:"conversationId" validate:"required"`
+	MessageID      string `json:"messageId" validate:"required"`
+}
+
+// ReadReceipt is pushed to the other participants when messages are marked read.
+type ReadReceipt struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	ReaderID       primitive.ObjectID `json:"readerId"`
+	MessageID      primitive.ObjectID `json:"messageId"`
+	ReadAt         time.Time          `json:"readAt"`
+	Count          int64              `json:"count"`
+}
+
+type MarkDeliveredPayload struct {
+	MessageIDs []string `json:"messageIds" validate:"required,min=1,max=100,dive,required"`
+}
+
+// DeliveryReceipt is pushed to a sender once the recipient's client acknowledged their messages.
+type DeliveryReceipt struct {
+	MessageIDs  []primitive.ObjectID `json:"messageIds"`
+	RecipientID primitive.ObjectID   `json:"recipientId"`
+	DeliveredAt time.Time            `json:"deliveredAt"`
+}
+
+type UnreadCount struct {
+	Total int64 `json:"total"`
+}
+
+// HighlightRange marks a matched term inside a search snippet using byte offsets.
+type HighlightRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type MessageSearchResult struct {
+	Message    Message          `json:"message"`
+	Snippet    string           `json:"snippet"`
+	Highlights []HighlightRange `json:"highlights"`
+	Score      float64          `json:"score"`
+}
+
+type MessageSearchResponse struct {
+	Results []MessageSearchResult `json:"results"`
+	Page    int                   `json:"page"`
+	Limit   int                   `json:"limit"`
+	HasMore bool                  `json:"hasMore"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Poll struct {
+	Question       string       `bson:"question" json:"question"`
+	Options        []PollOption `bson:"options" json:"options"`
+	MultipleChoice bool         `bson:"multipleChoice" json:"multipleChoice"`
+	ClosesAt       *time.Time   `bson:"closesAt,omitempty" json:"closesAt,omitempty"`
+	ClosedAt       *time.Time   `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
+	TotalVoters    int          `bson:"totalVoters" json:"totalVoters"`
+}
+
+// PollOption IDs are the option's position, so counts can be updated in place.
+type PollOption struct {
+	ID        int    `bson:"id" json:"id"`
+	Text      string `bson:"text" json:"text"`
+	VoteCount int    `bson:"voteCount" json:"voteCount"`
+}
+
+// IsClosed reports whether the poll was closed by hand or reached its close time.
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !now.Before(*p.ClosesAt))
+}
+
+// PollVote is one user's current selection, stored in the poll_votes collection.
+type PollVote struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	MessageID primitive.ObjectID `bson:"messageId" json:"messageId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	OptionIDs []int              `bson:"optionIds" json:"optionIds"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+type CreatePollPayload struct {
+	UserId         string     `json:"userId" validate:"required_without=ConversationID"`
+	ConversationID string     `json:"conversationId"`
+	Question       string     `json:"question" validate:"required,max=300"`
+	Options        []string   `json:"options" validate:"required,min=2,max=10,dive,required,max=100"`
+	MultipleChoice bool       `json:"multipleChoice"`
+	ClosesAt       *time.Time `json:"closesAt"`
+}
+
+type PollVotePayload struct {
+	OptionIDs []int `json:"optionIds" validate:"required,min=1"`
+}
+
+// PollResult is returned to the voter and pushed to participants after a vote.
+type PollResult struct {
+	MessageID      primitive.ObjectID `json:"messageId"`
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	Poll           Poll               `json:"poll"`
+	MyVotes        []int              `json:"myVotes,omitempty"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+type Presence struct {
+	UserID     primitive.ObjectID `json:"userId"`
+	Status     PresenceStatus     `json:"status"`
+	LastSeenAt *time.Time         `json:"lastSeenAt,omitempty"`
+}
+
+type PresenceHeartbeatPayload struct {
+	Status PresenceStatus `json:"status" validate:"omitempty,oneof=online away offline"`
+}
+
+type PresenceSettingsPayload struct {
+	HideLastSeen *bool `json:"hideLastSeen" validate:"required"`
+}
+
+type TypingPayload struct {
+	ConversationID string `json:"conversationId" validate:"required"`
+	Typing         bool   `json:"typing"`
+}
+
+// TypingEvent carries an expiry so clients can clear the indicator if the stop signal is lost.
+type TypingEvent struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	UserID         primitive.ObjectID `json:"userId"`
+	Typing         bool               `json:"typing"`
+	ExpiresAt      time.Time          `json:"expiresAt"`
+}
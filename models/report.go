@@ -0,0 +1,135 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReportTargetType string
+
+const (
+	ReportTargetMessage ReportTargetType = "message"
+	ReportTargetUser    ReportTargetType = "user"
+)
+
+type ReportReason string
+
+const (
+	ReportReasonSpam          ReportReason = "spam"
+	ReportReasonHarassment    ReportReason = "harassment"
+	ReportReasonHateSpeech    ReportReason = "hate_speech"
+	ReportReasonViolence      ReportReason = "violence"
+	ReportReasonSexualContent ReportReason = "sexual_content"
+	ReportReasonImpersonation ReportReason = "impersonation"
+	ReportReasonOther         ReportReason = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen     ReportStatus = "open"
+	ReportStatusClaimed  ReportStatus = "claimed"
+	ReportStatusResolved ReportStatus = "resolved"
+)
+
+// ModerationAction is what a moderator did with a report. The last three resolve it.
+type ModerationAction string
+
+const (
+	ModerationActionClaim         ModerationAction = "claim"
+	ModerationActionRelease       ModerationAction = "release"
+	ModerationActionDismiss       ModerationAction = "dismiss"
+	ModerationActionDeleteMessage ModerationAction = "delete_message"
+	// ModerationActionSuspendUser deactivates the account everywhere, not only
+	// in the report's workspace, so only admins take it.
+	ModerationActionSuspendUser ModerationAction = "suspend_user"
+)
+
+// ReportSnapshot keeps the reported content as it was when reported, so it
+// survives the author editing or deleting it.
+type ReportSnapshot struct {
+	Message *Message   `bson:"message,omitempty" json:"message,omitempty"`
+	User    UserPublic `bson:"user" json:"user"`
+}
+
+// Report flags a message or a user for moderators. ReportedUserID is the
+// message's sender for message reports.
+type Report struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"_id"`
+	WorkspaceID    primitive.ObjectID  `bson:"workspaceId,omitempty" json:"workspaceId,omitempty"`
+	TargetType     ReportTargetType    `bson:"targetType" json:"targetType"`
+	TargetID       primitive.ObjectID  `bson:"targetId" json:"targetId"`
+	ReportedUserID primitive.ObjectID  `bson:"reportedUserId" json:"reportedUserId"`
+	ConversationID *primitive.ObjectID `bson:"conversationId,omitempty" json:"conversationId,omitempty"`
+	ReporterID     primitive.ObjectID  `bson:"reporterId" json:"reporterId"`
+	Reason         ReportReason        `bson:"reason" json:"reason"`
+	Details        string              `bson:"details,omitempty" json:"details,omitempty"`
+	Snapshot       ReportSnapshot      `bson:"snapshot" json:"snapshot"`
+	Status         ReportStatus        `bson:"status" json:"status"`
+	// Pending is set until the report is resolved, so a partial unique index
+	// allows one unresolved report per reporter and target.
+	Pending    bool                `bson:"pending,omitempty" json:"-"`
+	ClaimedBy  *primitive.ObjectID `bson:"claimedBy,omitempty" json:"claimedBy,omitempty"`
+	ClaimedAt  *time.Time          `bson:"claimedAt,omitempty" json:"claimedAt,omitempty"`
+	Resolution ModerationAction    `bson:"resolution,omitempty" json:"resolution,omitempty"`
+	ResolvedBy *primitive.ObjectID `bson:"resolvedBy,omitempty" json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time          `bson:"resolvedAt,omitempty" json:"resolvedAt,omitempty"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Involves reports whether userId filed the report or is the one reported.
+func (r *Report) Involves(userId primitive.ObjectID) bool {
+	return r.ReporterID == userId || r.ReportedUserID == userId
+}
+
+// ModerationLogEntry is one moderator decision in the audit trail. Entries are
+// never updated or removed.
+type ModerationLogEntry struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	WorkspaceID  primitive.ObjectID `bson:"workspaceId,omitempty" json:"workspaceId,omitempty"`
+	ReportID     primitive.ObjectID `bson:"reportId" json:"reportId"`
+	ModeratorID  primitive.ObjectID `bson:"moderatorId" json:"moderatorId"`
+	Action       ModerationAction   `bson:"action" json:"action"`
+	TargetUserID primitive.ObjectID `bson:"targetUserId" json:"targetUserId"`
+	Note         string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type CreateReportPayload struct {
+	TargetType ReportTargetType `json:"targetType" validate:"required,oneof=message user"`
+	TargetID   string           `json:"targetId" validate:"required"`
+	Reason     ReportReason     `json:"reason" validate:"required,oneof=spam harassment hate_speech violence sexual_content impersonation other"`
+	Details    string           `json:"details" validate:"max=1000"`
+}
+
+type ResolveReportPayload struct {
+	Action ModerationAction `json:"action" validate:"required,oneof=dismiss delete_message suspend_user"`
+	Note   string           `json:"note" validate:"max=1000"`
+}
+
+type ReportDetail struct {
+	Report  Report               `json:"report"`
+	History []ModerationLogEntry `json:"history"`
+}
+
+type ReportListResponse struct {
+	Results []Report `json:"results"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	HasMore bool     `json:"hasMore"`
+}
+
+type ModerationLogResponse struct {
+	Results []ModerationLogEntry `json:"results"`
+	Page    int                  `json:"page"`
+	Limit   int                  `json:"limit"`
+	HasMore bool                 `json:"hasMore"`
+}
+
+// MessageRemoved tells a conversation a moderator deleted one of its messages.
+type MessageRemoved struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	MessageID      primitive.ObjectID `json:"messageId"`
+}
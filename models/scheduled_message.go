@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledMessagePending   ScheduledMessageStatus = "pending"
+	ScheduledMessageSent      ScheduledMessageStatus = "sent"
+	ScheduledMessageCancelled ScheduledMessageStatus = "cancelled"
+	ScheduledMessageFailed    ScheduledMessageStatus = "failed"
+)
+
+type ScheduledMessage struct {
+	ID             primitive.ObjectID     `bson:"_id,omitempty" json:"_id"`
+	WorkspaceID    primitive.ObjectID     `bson:"workspaceId,omitempty" json:"-"`
+	SenderID       primitive.ObjectID     `bson:"senderId" json:"senderId"`
+	ReceiverID     primitive.ObjectID     `bson:"receiverId,omitempty" json:"receiverId"`
+	ConversationID primitive.ObjectID     `bson:"conversationId,omitempty" json:"conversationId,omitempty"`
+	Message        string                 `bson:"message" json:"message"`
+	ScheduledAt    time.Time              `bson:"scheduledAt" json:"scheduledAt"`
+	Status         ScheduledMessageStatus `bson:"status" json:"status"`
+	Attempts       int                    `bson:"attempts" json:"attempts"`
+	LastError      string                 `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	MessageID      *primitive.ObjectID    `bson:"messageId,omitempty" json:"messageId,omitempty"`
+	LeaseOwner     string                 `bson:"leaseOwner,omitempty" json:"-"`
+	LeaseExpiresAt *time.Time             `bson:"leaseExpiresAt,omitempty" json:"-"`
+	CreatedAt      time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time              `bson:"updatedAt" json:"updatedAt"`
+}
+
+type UpdateScheduledMessagePayload struct {
+	Message     *string    `json:"message" validate:"omitempty,min=1,max=4096"`
+	ScheduledAt *time.Time `json:"scheduledAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Star is a per-user bookmark on a message.
+type Star struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID         primitive.ObjectID `bson:"userId" json:"userId"`
+	MessageID      primitive.ObjectID `bson:"messageId" json:"messageId"`
+	ConversationID primitive.ObjectID `bson:"conversationId" json:"conversationId"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type StarredMessage struct {
+	StarredAt time.Time `json:"starredAt"`
+	Message   Message   `json:"message"`
+}
+
+type StarredMessagesResponse struct {
+	Results []StarredMessage `json:"results"`
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+	HasMore bool             `json:"hasMore"`
+}
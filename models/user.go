@@ -1,6 +1,7 @@
 package models
 
 import (
+	"lite-chat-go/types"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -26,8 +27,13 @@ type User struct {
 	AccessToken   *string            `bson:"accessToken,omitempty" json:"accessToken"`
 	Provider      *AuthProvider      `bson:"provider,omitempty" json:"provider"`
 	IsActive      bool               `bson:"isActive,omitempty" json:"isActive"`
+	Role          types.Role         `bson:"role,omitempty" json:"role,omitempty"`
+	LastSeenAt    *time.Time         `bson:"lastSeenAt,omitempty" json:"lastSeenAt,omitempty"`
+	HideLastSeen  bool               `bson:"hideLastSeen,omitempty" json:"hideLastSeen"`
 	CreatedAt     time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
 	UpdatedAt     time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	// TokenVersion goes up when the password is reset, revoking earlier tokens
+	TokenVersion int64 `bson:"tokenVersion,omitempty" json:"-"`
 }
 
 type UserRegisterPayload struct {
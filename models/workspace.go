@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Workspace is a team sharing the deployment. Its users, conversations and
+// messages are invisible from other workspaces.
+type Workspace struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name      string             `bson:"name" json:"name"`
+	OwnerID   primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+type WorkspaceMember struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	WorkspaceID primitive.ObjectID `bson:"workspaceId,omitempty" json:"workspaceId"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	JoinedAt    time.Time          `bson:"joinedAt" json:"joinedAt"`
+}
+
+type CreateWorkspacePayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type AddWorkspaceMemberPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// SwitchWorkspacePayload picks the workspace of the next token, an empty
+// workspaceId going back to the default workspace.
+type SwitchWorkspacePayload struct {
+	WorkspaceID string `json:"workspaceId"`
+}
+
+type WorkspaceToken struct {
+	Token       string              `json:"token"`
+	WorkspaceID *primitive.ObjectID `json:"workspaceId,omitempty"`
+}
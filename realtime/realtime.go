@@ -0,0 +1,94 @@
+package realtime
+
+import (
+	"lite-chat-go/config"
+	"log"
+	"strings"
+
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+// BroadcastChannel is the shared channel every client subscribes to.
+const BroadcastChannel = "lite-chat"
+
+const userChannelPrefix = "private-user-"
+
+const conversationChannelPrefix = "private-conversation-"
+
+// Publisher is the subset of the Pusher client the services rely on.
+type Publisher interface {
+	Trigger(channel string, eventName string, data interface{}) error
+	// TriggerExcept skips the connection with socketId, so the device that
+	// caused an event doesn't receive its own echo.
+	TriggerExcept(channel string, eventName string, data interface{}, socketId string) error
+}
+
+// Pusher is also used directly for channel authorization and webhook verification.
+var Pusher = &pusher.Client{
+	AppID:   config.Envs.PusherAppID,
+	Key:     config.Envs.PusherKey,
+	Secret:  config.Envs.PusherSecret,
+	Cluster: config.Envs.PusherCluster,
+	Secure:  true,
+}
+
+type pusherPublisher struct {
+	*pusher.Client
+}
+
+func (p pusherPublisher) TriggerExcept(channel string, eventName string, data interface{}, socketId string) error {
+	_, err := p.TriggerWithParams(channel, eventName, data, pusher.TriggerParams{SocketID: &socketId})
+	return err
+}
+
+var Client Publisher = pusherPublisher{Pusher}
+
+// UserChannel is the private channel carrying events addressed to a single user.
+func UserChannel(userId string) string {
+	return userChannelPrefix + userId
+}
+
+// UserIDFromChannel returns the owner of a channel built by UserChannel.
+func UserIDFromChannel(channel string) (string, bool) {
+	if !strings.HasPrefix(channel, userChannelPrefix) {
+		return "", false
+	}
+
+	userId := strings.TrimPrefix(channel, userChannelPrefix)
+	return userId, userId != ""
+}
+
+// ConversationChannel is the private channel a channel's subscribers listen on, so
+// a post is published once however many subscribers there are.
+func ConversationChannel(conversationId string) string {
+	return conversationChannelPrefix + conversationId
+}
+
+// ConversationIDFromChannel returns the conversation of a channel built by ConversationChannel.
+func ConversationIDFromChannel(channel string) (string, bool) {
+	if !strings.HasPrefix(channel, conversationChannelPrefix) {
+		return "", false
+	}
+
+	conversationId := strings.TrimPrefix(channel, conversationChannelPrefix)
+	return conversationId, conversationId != ""
+}
+
+// Publish sends an event and only logs failures, realtime delivery is best effort.
+func Publish(channel string, eventName string, data interface{}) {
+	if err := Client.Trigger(channel, eventName, data); err != nil {
+		log.Printf("failed to publish %s on %s: %v", eventName, channel, err)
+	}
+}
+
+// PublishExcept is Publish without the connection socketId, when one is given.
+func PublishExcept(channel string, eventName string, data interface{}, socketId string) {
+	if socketId == "" {
+		Publish(channel, eventName, data)
+		return
+	}
+
+	if err := Client.TriggerExcept(channel, eventName, data, socketId); err != nil {
+		log.Printf("failed to publish %s on %s: %v", eventName, channel, err)
+	}
+}
@@ -0,0 +1,66 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	recorder, restore := UseRecorder()
+	defer restore()
+
+	Publish(UserChannel("abc"), "message-read", map[string]string{"id": "1"})
+	Publish(BroadcastChannel, "upcoming-message", nil)
+
+	events := recorder.Events("message-read")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "private-user-abc", events[0].Channel)
+	assert.Len(t, recorder.Events("upcoming-message"), 1)
+}
+
+func TestPublishExcept(t *testing.T) {
+	recorder, restore := UseRecorder()
+	defer restore()
+
+	PublishExcept(UserChannel("abc"), "draft-updated", nil, "123.456")
+	PublishExcept(UserChannel("abc"), "draft-updated", nil, "")
+
+	events := recorder.Events("draft-updated")
+	assert.Len(t, events, 2)
+	assert.Equal(t, "123.456", events[0].ExceptSocketID)
+	assert.Empty(t, events[1].ExceptSocketID)
+}
+
+func TestUseRecorderRestoresClient(t *testing.T) {
+	previous := Client
+	_, restore := UseRecorder()
+	assert.NotEqual(t, previous, Client)
+
+	restore()
+	assert.Equal(t, previous, Client)
+}
+
+func TestUserIDFromChannel(t *testing.T) {
+	userId, ok := UserIDFromChannel(UserChannel("abc"))
+	assert.True(t, ok)
+	assert.Equal(t, "abc", userId)
+
+	_, ok = UserIDFromChannel(BroadcastChannel)
+	assert.False(t, ok)
+
+	_, ok = UserIDFromChannel("private-user-")
+	assert.False(t, ok)
+}
+
+func TestConversationIDFromChannel(t *testing.T) {
+	conversationId, ok := ConversationIDFromChannel(ConversationChannel("abc"))
+	assert.True(t, ok)
+	assert.Equal(t, "abc", conversationId)
+
+	_, ok = ConversationIDFromChannel(UserChannel("abc"))
+	assert.False(t, ok)
+
+	_, ok = ConversationIDFromChannel("private-conversation-")
+	assert.False(t, ok)
+}
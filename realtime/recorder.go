@@ -0,0 +1,51 @@
+package realtime
+
+import "sync"
+
+type Event struct {
+	Channel        string
+	Name           string
+	Data           interface{}
+	ExceptSocketID string
+}
+
+// Recorder is an in-memory Publisher used by tests to assert on emitted events.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *Recorder) Trigger(channel string, eventName string, data interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Event{Channel: channel, Name: eventName, Data: data})
+	return nil
+}
+
+func (r *Recorder) TriggerExcept(channel string, eventName string, data interface{}, socketId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Event{Channel: channel, Name: eventName, Data: data, ExceptSocketID: socketId})
+	return nil
+}
+
+func (r *Recorder) Events(eventName string) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]Event, 0)
+	for _, e := range r.events {
+		if e.Name == eventName {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// UseRecorder swaps the package client for a Recorder and returns a restore func.
+func UseRecorder() (*Recorder, func()) {
+	previous := Client
+	recorder := &Recorder{}
+	Client = recorder
+	return recorder, func() { Client = previous }
+}
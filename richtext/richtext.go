@@ -0,0 +1,294 @@
+// Package richtext parses the markdown subset supported in message bodies into
+// plain text plus entities. Clients render the plain text and style ranges from
+// the entities, so no markup from the sender is ever interpreted as HTML.
+package richtext
+
+import (
+	"lite-chat-go/models"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxDepth      = 3
+	maxEntities   = 100
+	maxLinkLength = 2048
+)
+
+// Characters that lose their formatting meaning when preceded by a backslash.
+const escapable = "\\`*_[]()"
+
+var safeSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+type parser struct {
+	out      strings.Builder
+	offset   int
+	entities []models.TextEntity
+}
+
+// Parse converts raw into its plain-text fallback and the formatting entities
+// over that text. Supported: **bold**, *italic* or _italic_, `code` and
+// [label](url) with http, https or mailto targets. Offsets are UTF-16 based.
+func Parse(raw string) (string, []models.TextEntity) {
+	p := &parser{}
+	p.inline(raw, 0)
+
+	// Outer entities first when two start at the same place
+	sort.SliceStable(p.entities, func(i, j int) bool {
+		if p.entities[i].Offset != p.entities[j].Offset {
+			return p.entities[i].Offset < p.entities[j].Offset
+		}
+		return p.entities[i].Length > p.entities[j].Length
+	})
+
+	if len(p.entities) > maxEntities {
+		p.entities = p.entities[:maxEntities]
+	}
+
+	return p.out.String(), p.entities
+}
+
+// PlainText is the text used for search and notification previews.
+func PlainText(raw string) string {
+	plain, _ := Parse(raw)
+	return plain
+}
+
+// closers remembers, per delimiter, where the last search in one string ended.
+// Openers are visited left to right, so an opener before that closer gets the
+// same answer without rescanning. Without it a run of unmatched openers like
+// "[[[[" rescans to the end of the text for each one.
+type closers struct {
+	src   string
+	found map[string]int
+}
+
+func newClosers(src string) *closers {
+	return &closers{src: src, found: make(map[string]int)}
+}
+
+func (c *closers) find(from int, delim string) int {
+	if end, ok := c.found[delim]; ok && (end < 0 || from <= end) {
+		return end
+	}
+
+	end := findClosing(c.src, from, delim)
+	c.found[delim] = end
+	return end
+}
+
+// index is strings.IndexByte from from onwards, returning an absolute index.
+func (c *closers) index(from int, b byte) int {
+	key := string(b)
+	if end, ok := c.found[key]; ok && (end < 0 || from <= end) {
+		return end
+	}
+
+	end := strings.IndexByte(c.src[from:], b)
+	if end >= 0 {
+		end += from
+	}
+	c.found[key] = end
+	return end
+}
+
+func (p *parser) inline(src string, depth int) {
+	closing := newClosers(src)
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == '\\' && i+1 < len(src) && strings.IndexByte(escapable, src[i+1]) >= 0:
+			p.write(src[i+1 : i+2])
+			i += 2
+			continue
+
+		case c == '`':
+			// Code spans are literal, nothing inside them is parsed
+			if end := strings.IndexByte(src[i+1:], '`'); end > 0 {
+				code := src[i+1 : i+1+end]
+				p.wrap(models.TextEntityCode, "", func() { p.write(code) })
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(src[i:], "**") && depth < maxDepth:
+			if end := closing.find(i+2, "**"); end > 0 && isContent(src[i+2:end]) {
+				inner := src[i+2 : end]
+				p.wrap(models.TextEntityBold, "", func() { p.inline(inner, depth+1) })
+				i = end + 2
+				continue
+			}
+
+		case (c == '*' || c == '_') && depth < maxDepth && opensItalic(src, i):
+			if end := closing.find(i+1, string(c)); end > 0 && isContent(src[i+1:end]) && closesItalic(src, end) {
+				inner := src[i+1 : end]
+				p.wrap(models.TextEntityItalic, "", func() { p.inline(inner, depth+1) })
+				i = end + 1
+				continue
+			}
+
+		case c == '[' && depth < maxDepth:
+			if label, target, n, ok := parseLink(closing, i); ok {
+				// Unsafe targets are dropped, the label is kept as plain text
+				if safe, ok := sanitizeURL(target); ok {
+					p.wrap(models.TextEntityLink, safe, func() { p.inline(label, depth+1) })
+				} else {
+					p.inline(label, depth+1)
+				}
+				i += n
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(src[i:])
+		p.write(src[i : i+size])
+		i += size
+	}
+}
+
+func (p *parser) write(s string) {
+	p.out.WriteString(s)
+	p.offset += UTF16Len(s)
+}
+
+func (p *parser) wrap(kind models.TextEntityType, target string, fn func()) {
+	start := p.offset
+	fn()
+	if length := p.offset - start; length > 0 {
+		p.entities = append(p.entities, models.TextEntity{
+			Type:   kind,
+			Offset: start,
+			Length: length,
+			URL:    target,
+		})
+	}
+}
+
+// findClosing returns the index of delim in src at or after from, skipping
+// escapes, code spans and, for single-character delimiters, doubled ones.
+func findClosing(src string, from int, delim string) int {
+	for j := from; j < len(src); {
+		switch {
+		case src[j] == '\\' && j+1 < len(src):
+			j += 2
+			continue
+		case src[j] == '`':
+			if end := strings.IndexByte(src[j+1:], '`'); end >= 0 {
+				j += end + 2
+				continue
+			}
+		case strings.HasPrefix(src[j:], delim):
+			next := j + len(delim)
+			if len(delim) == 1 && next < len(src) && src[next] == delim[0] {
+				j += 2
+				continue
+			}
+			// In a longer run like "***" the closing delimiter is the last one
+			if len(delim) > 1 && next < len(src) && src[next] == delim[0] {
+				j++
+				continue
+			}
+			return j
+		}
+		j++
+	}
+
+	return -1
+}
+
+// parseLink reads a [label](url) starting at the '[' at i.
+func parseLink(closing *closers, i int) (label string, target string, n int, ok bool) {
+	src := closing.src
+
+	closeLabel := closing.find(i+1, "]")
+	if closeLabel <= i+1 || closeLabel+1 >= len(src) || src[closeLabel+1] != '(' {
+		return "", "", 0, false
+	}
+
+	closeTarget := closing.index(closeLabel+2, ')')
+	if closeTarget < 0 {
+		return "", "", 0, false
+	}
+
+	target = strings.TrimSpace(src[closeLabel+2 : closeTarget])
+	if target == "" || strings.ContainsAny(target, " \t\n") {
+		return "", "", 0, false
+	}
+
+	return src[i+1 : closeLabel], target, closeTarget + 1 - i, true
+}
+
+func sanitizeURL(raw string) (string, bool) {
+	if len(raw) > maxLinkLength {
+		return "", false
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || !safeSchemes[strings.ToLower(parsed.Scheme)] {
+		return "", false
+	}
+
+	if parsed.Scheme != "mailto" && parsed.Host == "" {
+		return "", false
+	}
+
+	return parsed.String(), true
+}
+
+// opensItalic rejects a leading space and, for underscores, snake_case words.
+func opensItalic(src string, i int) bool {
+	if i+1 >= len(src) || src[i+1] == ' ' {
+		return false
+	}
+
+	if src[i] == '_' && i > 0 {
+		r, _ := utf8.DecodeLastRuneInString(src[:i])
+		return !isWordRune(r)
+	}
+
+	return true
+}
+
+func closesItalic(src string, end int) bool {
+	if src[end] == '_' && end+1 < len(src) {
+		r, _ := utf8.DecodeRuneInString(src[end+1:])
+		return !isWordRune(r)
+	}
+
+	return true
+}
+
+func isContent(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+	return !unicode.IsSpace(first) && !unicode.IsSpace(last)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// UTF16Len is the length of s as counted by JavaScript clients.
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,145 @@
+package richtext
+
+import (
+	"lite-chat-go/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Plain text is untouched", func(t *testing.T) {
+		plain, entities := Parse("just words, 2 * 3 = 6")
+
+		assert.Equal(t, "just words, 2 * 3 = 6", plain)
+		assert.Empty(t, entities)
+	})
+
+	t.Run("Bold, italic and code", func(t *testing.T) {
+		plain, entities := Parse("**bold** and *it* or _it_ with `x := 1`")
+
+		assert.Equal(t, "bold and it or it with x := 1", plain)
+		assert.Equal(t, []models.TextEntity{
+			{Type: models.TextEntityBold, Offset: 0, Length: 4},
+			{Type: models.TextEntityItalic, Offset: 9, Length: 2},
+			{Type: models.TextEntityItalic, Offset: 15, Length: 2},
+			{Type: models.TextEntityCode, Offset: 23, Length: 6},
+		}, entities)
+	})
+
+	t.Run("Nested formatting lists the outer entity first", func(t *testing.T) {
+		plain, entities := Parse("**very *important***")
+
+		assert.Equal(t, "very important", plain)
+		assert.Equal(t, []models.TextEntity{
+			{Type: models.TextEntityBold, Offset: 0, Length: 14},
+			{Type: models.TextEntityItalic, Offset: 5, Length: 9},
+		}, entities)
+	})
+
+	t.Run("Code spans are literal", func(t *testing.T) {
+		plain, entities := Parse("`**not bold**`")
+
+		assert.Equal(t, "**not bold**", plain)
+		assert.Equal(t, []models.TextEntity{{Type: models.TextEntityCode, Offset: 0, Length: 12}}, entities)
+	})
+
+	t.Run("Safe links keep their target", func(t *testing.T) {
+		plain, entities := Parse("see [the docs](https://example.com/a?b=c)")
+
+		assert.Equal(t, "see the docs", plain)
+		assert.Equal(t, []models.TextEntity{
+			{Type: models.TextEntityLink, Offset: 4, Length: 8, URL: "https://example.com/a?b=c"},
+		}, entities)
+	})
+
+	t.Run("Unsafe links are reduced to their label", func(t *testing.T) {
+		for _, raw := range []string{
+			"[click](javascript:alert(1))",
+			"[click](data:text/html;base64,xyz)",
+			"[click](/relative)",
+		} {
+			plain, entities := Parse(raw)
+
+			assert.Equal(t, "click", plain[:5], raw)
+			assert.Empty(t, entities, raw)
+		}
+	})
+
+	t.Run("Snake case and unmatched markers stay literal", func(t *testing.T) {
+		plain, entities := Parse("use snake_case_names and a lone * or **")
+
+		assert.Equal(t, "use snake_case_names and a lone * or **", plain)
+		assert.Empty(t, entities)
+	})
+
+	t.Run("Escapes", func(t *testing.T) {
+		plain, entities := Parse(`\*not italic\* and \[x\](y)`)
+
+		assert.Equal(t, "*not italic* and [x](y)", plain)
+		assert.Empty(t, entities)
+	})
+
+	t.Run("HTML is carried as text", func(t *testing.T) {
+		plain, entities := Parse("**<script>alert(1)</script>**")
+
+		assert.Equal(t, "<script>alert(1)</script>", plain)
+		assert.Len(t, entities, 1)
+	})
+
+	t.Run("Offsets are in UTF-16 code units", func(t *testing.T) {
+		plain, entities := Parse("😀 **hi**")
+
+		assert.Equal(t, "😀 hi", plain)
+		assert.Equal(t, 3, entities[0].Offset)
+		assert.Equal(t, 2, entities[0].Length)
+	})
+}
+
+// pathological are inputs full of openers without a usable closer, which used
+// to rescan the rest of the text once per opener.
+var pathological = map[string]string{
+	"brackets":      strings.Repeat("[", 100000),
+	"brackets+1":    strings.Repeat("[", 100000) + "]",
+	"open links":    strings.Repeat("[a](", 25000),
+	"bold":          strings.Repeat("** ", 33000),
+	"underscores":   strings.Repeat("_ _", 33000),
+	"code in links": strings.Repeat("[`", 50000),
+}
+
+func TestParsePathological(t *testing.T) {
+	for name, input := range pathological {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			Parse(input)
+
+			// Linear parsing takes milliseconds, the quadratic scan took minutes
+			assert.Less(t, time.Since(start), 2*time.Second)
+		})
+	}
+
+	t.Run("Openers without a closer stay literal", func(t *testing.T) {
+		plain, entities := Parse("[[a](https://example.com) **b** [c")
+
+		assert.Equal(t, "[a b [c", plain)
+		assert.Len(t, entities, 2)
+	})
+}
+
+func BenchmarkParse(b *testing.B) {
+	for name, input := range pathological {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Parse(input)
+			}
+		})
+	}
+}
+
+func TestUTF16Len(t *testing.T) {
+	assert.Equal(t, 0, UTF16Len(""))
+	assert.Equal(t, 5, UTF16Len("héllo"))
+	assert.Equal(t, 2, UTF16Len("😀"))
+}
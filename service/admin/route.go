@@ -0,0 +1,325 @@
+package admin
+
+import (
+	"encoding/json"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AdminService struct {
+	userCollection         *mongo.Collection
+	conversationCollection *mongo.Collection
+	messageCollection      *mongo.Collection
+}
+
+func NewAdminService(userCollection *mongo.Collection, conversationCollection *mongo.Collection, messageCollection *mongo.Collection) *AdminService {
+	return &AdminService{
+		userCollection:         userCollection,
+		conversationCollection: conversationCollection,
+		messageCollection:      messageCollection,
+	}
+}
+
+// RegisterRoutes mounts the admin API. Every route is limited to admins.
+func (s *AdminService) RegisterRoutes(router *mux.Router) {
+	admin := func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return utils.WithJwtAuth(utils.WithRole(handlerFunc, types.RoleAdmin))
+	}
+
+	router.HandleFunc("/users", admin(s.listUsers)).Methods(http.MethodGet)
+	router.HandleFunc("/users/{id}", admin(s.getUser)).Methods(http.MethodGet)
+	router.HandleFunc("/users/{id}/role", admin(s.updateRole)).Methods(http.MethodPut)
+	router.HandleFunc("/users/{id}/deactivate", admin(s.deactivateUser)).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/activate", admin(s.activateUser)).Methods(http.MethodPost)
+	router.HandleFunc("/users/{id}/password", admin(s.resetPassword)).Methods(http.MethodPut)
+	router.HandleFunc("/stats", admin(s.stats)).Methods(http.MethodGet)
+}
+
+// listUsers pages through every account, newest first. q matches username,
+// email or full name, role and active narrow the list further.
+func (s *AdminService) listUsers(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	params := r.URL.Query()
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+	if q := strings.TrimSpace(params.Get("q")); q != "" {
+		pattern := regexp.QuoteMeta(q)
+		filter["$or"] = bson.A{
+			bson.M{"username": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"email": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"fullname": bson.M{"$regex": pattern, "$options": "i"}},
+		}
+	}
+	if role := types.Role(params.Get("role")); role != "" {
+		if !role.Valid() {
+			utils.WriteError(w, http.StatusBadRequest, "Role not valid")
+			return
+		}
+		if role == types.RoleUser {
+			filter["role"] = bson.M{"$in": bson.A{nil, types.RoleUser}}
+		} else {
+			filter["role"] = role
+		}
+	}
+	if active := params.Get("active"); active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "active must be true or false")
+			return
+		}
+		if isActive {
+			filter["isActive"] = true
+		} else {
+			filter["isActive"] = bson.M{"$ne": true}
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := s.userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	users := []models.UserAccount{}
+	if err := cursor.All(ctx, &users); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.UserAccountListResponse{
+			Results: users,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
+
+func (s *AdminService) getUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.findUser(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    user,
+	})
+}
+
+func (s *AdminService) updateRole(w http.ResponseWriter, r *http.Request) {
+	var payload models.UpdateRolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !payload.Role.Valid() {
+		utils.WriteError(w, http.StatusBadRequest, "Role not valid")
+		return
+	}
+
+	s.updateUser(w, r, bson.M{"role": payload.Role}, "Role updated")
+}
+
+// deactivateUser locks an account out. Its existing tokens stop working on the
+// next request, see utils.SetAccountCheck.
+func (s *AdminService) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	s.updateUser(w, r, bson.M{"isActive": false}, "User deactivated")
+}
+
+func (s *AdminService) activateUser(w http.ResponseWriter, r *http.Request) {
+	s.updateUser(w, r, bson.M{"isActive": true}, "User activated")
+}
+
+// resetPassword sets a new password chosen by the admin, which also lets
+// accounts created through a provider sign in with email. Tokens issued before
+// the reset stop working, see utils.SetAccountCheck.
+func (s *AdminService) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.ResetPasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "User ID not valid")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := s.userCollection.UpdateByID(ctx, userIdObject, bson.M{
+		"$set": bson.M{"password": hashedPassword, "updatedAt": time.Now()},
+		"$inc": bson.M{"tokenVersion": 1},
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Password reset",
+		Status:  http.StatusOK,
+	})
+}
+
+func (s *AdminService) stats(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var stats models.SystemStats
+	workspaceCollection := s.userCollection.Database().Collection("workspaces")
+	counts := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+		into       *int64
+	}{
+		{s.userCollection, bson.M{}, &stats.Users},
+		{s.userCollection, bson.M{"isActive": true}, &stats.ActiveUsers},
+		{s.userCollection, bson.M{"isActive": bson.M{"$ne": true}}, &stats.DeactivatedUsers},
+		{s.userCollection, bson.M{"role": types.RoleModerator}, &stats.Moderators},
+		{s.userCollection, bson.M{"role": types.RoleAdmin}, &stats.Admins},
+		{s.conversationCollection, bson.M{}, &stats.Conversations},
+		{s.conversationCollection, bson.M{"type": models.ConversationTypeGroup}, &stats.Groups},
+		{s.conversationCollection, bson.M{"type": models.ConversationTypeChannel}, &stats.Channels},
+		{s.messageCollection, bson.M{}, &stats.Messages},
+		{s.messageCollection, bson.M{"createdAt": bson.M{"$gte": time.Now().Add(-24 * time.Hour)}}, &stats.MessagesLastDay},
+		{workspaceCollection, bson.M{}, &stats.Workspaces},
+	}
+
+	for _, c := range counts {
+		n, err := c.collection.CountDocuments(ctx, c.filter)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		*c.into = n
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    stats,
+	})
+}
+
+// updateUser applies set to the {id} user and answers with the updated account.
+// Admins can't change their own role or active state, so the last admin can't
+// lock everyone out.
+func (s *AdminService) updateUser(w http.ResponseWriter, r *http.Request, set bson.M, message string) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "User ID not valid")
+		return
+	}
+
+	if userIdObject.Hex() == ctx.Value(types.ContextKeyUserID).(string) {
+		utils.WriteError(w, http.StatusBadRequest, "You can't change your own account")
+		return
+	}
+
+	set["updatedAt"] = time.Now()
+
+	var user models.UserAccount
+	err = s.userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userIdObject},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: message,
+		Status:  http.StatusOK,
+		Data:    user,
+	})
+}
+
+func (s *AdminService) findUser(w http.ResponseWriter, r *http.Request) (*models.UserAccount, bool) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "User ID not valid")
+		return nil, false
+	}
+
+	var user models.UserAccount
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": userIdObject}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return nil, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	return &user, true
+}
@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAdminService(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		adminService := NewAdminService(testDB.UserCol, testDB.ConvCol, testDB.MsgCol)
+
+		admin, _ := testDB.CreateTestUser("admin@example.com", "admin", "Admin")
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		testDB.UserCol.UpdateByID(context.Background(), admin.ID, bson.M{"$set": bson.M{"role": types.RoleAdmin}})
+
+		router := mux.NewRouter()
+		adminService.RegisterRoutes(router)
+
+		do := func(user *models.User, role types.Role, method, path, body string) *httptest.ResponseRecorder {
+			token, _ := utils.GenerateJWTWithClaims(utils.Claims{ID: user.ID.Hex(), Email: user.Email, Role: role})
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		listUsers := func(query string) models.UserAccountListResponse {
+			var response struct {
+				Data models.UserAccountListResponse `json:"data"`
+			}
+			json.Unmarshal(do(admin, types.RoleAdmin, http.MethodGet, "/users"+query, "").Body.Bytes(), &response)
+			return response.Data
+		}
+
+		t.Run("Only admins get in", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(user1, types.RoleUser, http.MethodGet, "/users", "").Code)
+			assert.Equal(t, http.StatusForbidden, do(user1, types.RoleModerator, http.MethodGet, "/stats", "").Code)
+			assert.Equal(t, http.StatusOK, do(admin, types.RoleAdmin, http.MethodGet, "/users", "").Code)
+		})
+
+		t.Run("List and search users", func(t *testing.T) {
+			assert.Len(t, listUsers("").Results, 3)
+
+			page := listUsers("?q=user&limit=1")
+			assert.Len(t, page.Results, 1)
+			assert.True(t, page.HasMore)
+
+			admins := listUsers("?role=admin")
+			assert.Len(t, admins.Results, 1)
+			assert.Equal(t, admin.ID, admins.Results[0].ID)
+			assert.Len(t, listUsers("?role=user").Results, 2)
+
+			// Regex characters are matched literally
+			assert.Empty(t, listUsers("?q=.*").Results)
+
+			assert.Equal(t, http.StatusBadRequest, do(admin, types.RoleAdmin, http.MethodGet, "/users?role=owner", "").Code)
+		})
+
+		t.Run("Change roles", func(t *testing.T) {
+			w := do(admin, types.RoleAdmin, http.MethodPut, "/users/"+user1.ID.Hex()+"/role", `{"role": "moderator"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Len(t, listUsers("?role=moderator").Results, 1)
+
+			w = do(admin, types.RoleAdmin, http.MethodPut, "/users/"+user1.ID.Hex()+"/role", `{"role": "owner"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			w = do(admin, types.RoleAdmin, http.MethodPut, "/users/"+admin.ID.Hex()+"/role", `{"role": "user"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Deactivate and reactivate", func(t *testing.T) {
+			utils.SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (utils.Account, error) {
+				id, _ := primitive.ObjectIDFromHex(userId)
+				var user models.User
+				err := testDB.UserCol.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+				return utils.Account{Active: user.IsActive, Role: user.Role, Member: true, TokenVersion: user.TokenVersion}, err
+			})
+			defer utils.SetAccountCheck(nil)
+
+			w := do(admin, types.RoleAdmin, http.MethodPost, "/users/"+user2.ID.Hex()+"/deactivate", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Len(t, listUsers("?active=false").Results, 1)
+
+			// An admin token of a deactivated account stops working too
+			assert.Equal(t, http.StatusForbidden, do(user2, types.RoleAdmin, http.MethodGet, "/stats", "").Code)
+
+			w = do(admin, types.RoleAdmin, http.MethodPost, "/users/"+user2.ID.Hex()+"/activate", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, listUsers("?active=false").Results)
+
+			w = do(admin, types.RoleAdmin, http.MethodPost, "/users/"+admin.ID.Hex()+"/deactivate", "")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			w = do(admin, types.RoleAdmin, http.MethodPost, "/users/"+primitive.NewObjectID().Hex()+"/deactivate", "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Role changes apply to existing tokens", func(t *testing.T) {
+			utils.SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (utils.Account, error) {
+				id, _ := primitive.ObjectIDFromHex(userId)
+				var user models.User
+				err := testDB.UserCol.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+				return utils.Account{Active: user.IsActive, Role: user.Role, Member: true, TokenVersion: user.TokenVersion}, err
+			})
+			defer utils.SetAccountCheck(nil)
+
+			w := do(admin, types.RoleAdmin, http.MethodPut, "/users/"+user2.ID.Hex()+"/role", `{"role": "admin"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, http.StatusOK, do(user2, types.RoleUser, http.MethodGet, "/stats", "").Code)
+
+			w = do(admin, types.RoleAdmin, http.MethodPut, "/users/"+user2.ID.Hex()+"/role", `{"role": "user"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, http.StatusForbidden, do(user2, types.RoleAdmin, http.MethodGet, "/stats", "").Code)
+		})
+
+		t.Run("Reset a password", func(t *testing.T) {
+			w := do(admin, types.RoleAdmin, http.MethodPut, "/users/"+user1.ID.Hex()+"/password", `{"password": "n3w-secret"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var user models.User
+			testDB.UserCol.FindOne(context.Background(), bson.M{"_id": user1.ID}).Decode(&user)
+			assert.True(t, utils.CheckPasswordHash("n3w-secret", *user.Password))
+
+			w = do(admin, types.RoleAdmin, http.MethodPut, "/users/"+user1.ID.Hex()+"/password", `{}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Resetting a password revokes earlier tokens", func(t *testing.T) {
+			utils.SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (utils.Account, error) {
+				id, _ := primitive.ObjectIDFromHex(userId)
+				var user models.User
+				err := testDB.UserCol.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+				return utils.Account{Active: user.IsActive, Role: user.Role, Member: true, TokenVersion: user.TokenVersion}, err
+			})
+			defer utils.SetAccountCheck(nil)
+
+			w := do(admin, types.RoleAdmin, http.MethodPut, "/users/"+admin.ID.Hex()+"/password", `{"password": "n3w-secret"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, http.StatusForbidden, do(admin, types.RoleAdmin, http.MethodGet, "/stats", "").Code)
+
+			// A token issued after the reset carries the new version
+			token, _ := utils.GenerateJWTWithClaims(utils.Claims{ID: admin.ID.Hex(), Email: admin.Email, Role: types.RoleAdmin, TokenVersion: 1})
+			req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+
+		t.Run("System stats", func(t *testing.T) {
+			message, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "hello")
+			testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, []primitive.ObjectID{message.ID})
+
+			var response struct {
+				Data models.SystemStats `json:"data"`
+			}
+			w := do(admin, types.RoleAdmin, http.MethodGet, "/stats", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Equal(t, int64(3), response.Data.Users)
+			assert.Equal(t, int64(3), response.Data.ActiveUsers)
+			assert.Equal(t, int64(1), response.Data.Admins)
+			assert.Equal(t, int64(1), response.Data.Moderators)
+			assert.Equal(t, int64(1), response.Data.Conversations)
+			assert.Equal(t, int64(1), response.Data.Messages)
+		})
+	})
+}
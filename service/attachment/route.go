@@ -0,0 +1,145 @@
+package attachment
+
+import (
+	"context"
+	"io"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/storage"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AttachmentService struct {
+	store                  storage.Store
+	messageCollection      *mongo.Collection
+	conversationCollection *mongo.Collection
+}
+
+func NewAttachmentService(store storage.Store, messageCollection *mongo.Collection, conversationCollection *mongo.Collection) *AttachmentService {
+	return &AttachmentService{
+		store:                  store,
+		messageCollection:      messageCollection,
+		conversationCollection: conversationCollection,
+	}
+}
+
+func (s *AttachmentService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/{key}", utils.WithJwtAuth(s.download)).Methods(http.MethodGet)
+}
+
+func (s *AttachmentService) download(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	if !storage.ValidKey(key) {
+		utils.WriteError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	// Staff can also open attachments kept as evidence by a report
+	attachment, err := s.fromMessages(ctx, userIdObject, key)
+	if err == mongo.ErrNoDocuments && isStaff(ctx) {
+		attachment, err = s.fromReports(ctx, key)
+	}
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Attachment not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	file, err := s.store.Open(ctx, key)
+	if err == storage.ErrNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Attachment not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
+
+// fromMessages finds key on a message userId can read, which includes forwarded
+// copies in other conversations.
+func (s *AttachmentService) fromMessages(ctx context.Context, userId primitive.ObjectID, key string) (*models.Attachment, error) {
+	conversationIds, err := s.messageCollection.Distinct(ctx, "conversationId", bson.M{"attachments.key": key})
+	if err != nil {
+		return nil, err
+	}
+	if conversationIds == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	conversationFilter, err := membership.Filter(ctx, s.conversationCollection.Database(), userId)
+	if err != nil {
+		return nil, err
+	}
+	conversationFilter["_id"] = bson.M{"$in": conversationIds}
+
+	count, err := s.conversationCollection.CountDocuments(ctx, conversationFilter)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var message models.Message
+	if err := s.messageCollection.FindOne(ctx, bson.M{"attachments.key": key}).Decode(&message); err != nil {
+		return nil, err
+	}
+	return findAttachment(message.Attachments, key)
+}
+
+// fromReports finds key in the snapshot of a report of the request's workspace.
+// Files stay in the store when their message is deleted, so moderators can
+// still open the evidence.
+func (s *AttachmentService) fromReports(ctx context.Context, key string) (*models.Attachment, error) {
+	var report models.Report
+	err := s.reportCollection().FindOne(ctx, tenant.Scope(ctx, bson.M{"snapshot.message.attachments.key": key})).Decode(&report)
+	if err != nil {
+		return nil, err
+	}
+	return findAttachment(report.Snapshot.Message.Attachments, key)
+}
+
+func (s *AttachmentService) reportCollection() *mongo.Collection {
+	return s.messageCollection.Database().Collection("reports")
+}
+
+func findAttachment(attachments []models.Attachment, key string) (*models.Attachment, error) {
+	for _, attachment := range attachments {
+		if attachment.Key == key {
+			return &attachment, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func isStaff(ctx context.Context) bool {
+	role := ctx.Value(types.ContextKeyRole)
+	return role == types.RoleModerator || role == types.RoleAdmin
+}
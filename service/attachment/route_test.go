@@ -0,0 +1,126 @@
+package attachment
+
+import (
+	"context"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/storage"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAttachmentService_Download(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		store := storage.NewMemoryStore()
+		attachmentService := NewAttachmentService(store, testDB.MsgCol, testDB.ConvCol)
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		key := primitive.NewObjectID().Hex() + ".ogg"
+		store.Save(context.Background(), key, strings.NewReader("OggS audio"))
+
+		msg, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "")
+		testDB.MsgCol.UpdateByID(context.Background(), msg.ID, bson.M{"$set": bson.M{
+			"attachments": []models.Attachment{{Key: key, ContentType: "audio/ogg", Size: 10}},
+		}})
+		testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, []primitive.ObjectID{msg.ID})
+
+		router := mux.NewRouter()
+		router.HandleFunc("/{key}", attachmentService.download).Methods(http.MethodGet)
+
+		download := func(userID primitive.ObjectID, key string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/"+key, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		t.Run("Participant downloads the file", func(t *testing.T) {
+			w := download(user2.ID, key)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "audio/ogg", w.Header().Get("Content-Type"))
+			assert.Equal(t, "OggS audio", w.Body.String())
+		})
+
+		t.Run("Non participant", func(t *testing.T) {
+			w := download(user3.ID, key)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Channel subscriber downloads the file", func(t *testing.T) {
+			posted := primitive.NewObjectID().Hex() + ".ogg"
+			store.Save(context.Background(), posted, strings.NewReader("OggS post"))
+
+			post, _ := testDB.CreateTestMessage(user1.ID, primitive.NilObjectID, "")
+			testDB.MsgCol.UpdateByID(context.Background(), post.ID, bson.M{"$set": bson.M{
+				"attachments": []models.Attachment{{Key: posted, ContentType: "audio/ogg", Size: 9}},
+			}})
+			channel, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID}, []primitive.ObjectID{post.ID})
+			testDB.ConvCol.UpdateByID(context.Background(), channel.ID, bson.M{"$set": bson.M{"type": models.ConversationTypeChannel}})
+			testDB.Database.Collection(membership.SubscriptionCollection).InsertOne(context.Background(), models.ChannelSubscription{
+				ID:        primitive.NewObjectID(),
+				ChannelID: channel.ID,
+				UserID:    user3.ID,
+				CreatedAt: time.Now(),
+			})
+
+			assert.Equal(t, http.StatusOK, download(user3.ID, posted).Code)
+			assert.Equal(t, http.StatusNotFound, download(user2.ID, posted).Code)
+		})
+
+		t.Run("Staff open attachments kept by a report", func(t *testing.T) {
+			moderator, _ := testDB.CreateTestUser("moderator@example.com", "moderator", "Moderator")
+			asStaff := func(role types.Role, key string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/"+key, nil)
+				ctx := context.WithValue(req.Context(), types.ContextKeyUserID, moderator.ID.Hex())
+				ctx = context.WithValue(ctx, types.ContextKeyRole, role)
+				req = req.WithContext(ctx)
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			evidence := primitive.NewObjectID().Hex() + ".ogg"
+			store.Save(context.Background(), evidence, strings.NewReader("OggS evidence"))
+			testDB.Database.Collection("reports").InsertOne(context.Background(), models.Report{
+				ID:         primitive.NewObjectID(),
+				TargetType: models.ReportTargetMessage,
+				Snapshot: models.ReportSnapshot{Message: &models.Message{
+					Attachments: []models.Attachment{{Key: evidence, ContentType: "audio/ogg", Size: 13}},
+				}},
+			})
+
+			// The reported message itself is gone
+			w := asStaff(types.RoleModerator, evidence)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "OggS evidence", w.Body.String())
+
+			assert.Equal(t, http.StatusNotFound, asStaff(types.RoleUser, evidence).Code)
+			assert.Equal(t, http.StatusNotFound, asStaff(types.RoleModerator, key).Code)
+		})
+
+		t.Run("Invalid key", func(t *testing.T) {
+			w := download(user1.ID, "..%2Fsecret")
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	})
+}
@@ -0,0 +1,329 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *ConversationService) subscriptionCollection() *mongo.Collection {
+	return s.conversationCollection.Database().Collection(membership.SubscriptionCollection)
+}
+
+// createChannel starts a channel owned by the caller. Only the owner and admins
+// post, everyone else subscribes.
+func (s *ConversationService) createChannel(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.CreateChannelPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Channel name is required")
+		return
+	}
+
+	now := time.Now()
+	conversation := models.Conversation{
+		ID:           primitive.NewObjectID(),
+		WorkspaceID:  tenant.FromContext(ctx),
+		Type:         models.ConversationTypeChannel,
+		Name:         name,
+		Description:  strings.TrimSpace(payload.Description),
+		Public:       payload.Public,
+		OwnerID:      &userIdObject,
+		Admins:       []primitive.ObjectID{userIdObject},
+		Participants: []primitive.ObjectID{userIdObject},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if _, err := s.conversationCollection.InsertOne(ctx, conversation); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	detail, err := s.conversationDetail(ctx, &conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Channel created",
+		Status:  http.StatusCreated,
+		Data:    detail,
+	})
+}
+
+// searchChannels lists public channels, most subscribed first.
+func (s *ConversationService) searchChannels(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	query := r.URL.Query()
+	page, limit, err := utils.ParsePagination(query.Get("page"), query.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := tenant.Scope(ctx, bson.M{"type": models.ConversationTypeChannel, "public": true})
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "subscriberCount", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1)).
+		SetProjection(bson.M{"name": 1, "description": 1, "subscriberCount": 1})
+
+	cursor, err := s.conversationCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	channels := make([]models.ChannelSummary, 0, limit+1)
+	if err := cursor.All(ctx, &channels); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := len(channels) > limit
+	if hasMore {
+		channels = channels[:limit]
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.ChannelDirectoryResponse{
+			Results: channels,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
+
+func (s *ConversationService) subscribeChannel(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	channel, userIdObject, ok := s.findChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if !channel.Public && !channel.IsParticipant(userIdObject) {
+		// Private channels are joined through an invite link
+		subscribed, err := s.isSubscribed(ctx, channel.ID, userIdObject)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !subscribed {
+			utils.WriteError(w, http.StatusForbidden, "This channel is private")
+			return
+		}
+	}
+
+	if !channel.IsParticipant(userIdObject) {
+		err := s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+			return s.addSubscriber(sc, channel.ID, userIdObject, time.Now())
+		})
+		if err != nil && err != errAlreadyMember {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	s.writeChannel(ctx, w, channel.ID, userIdObject, "Subscribed")
+}
+
+func (s *ConversationService) unsubscribeChannel(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	channel, userIdObject, ok := s.findChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if channel.IsParticipant(userIdObject) {
+		utils.WriteError(w, http.StatusBadRequest, "Channel admins can't unsubscribe")
+		return
+	}
+
+	err := s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		result, err := s.subscriptionCollection().DeleteOne(sc, bson.M{"channelId": channel.ID, "userId": userIdObject})
+		if err != nil || result.DeletedCount == 0 {
+			return err
+		}
+
+		_, err = s.conversationCollection.UpdateByID(sc, channel.ID, bson.M{"$inc": bson.M{"subscriberCount": -1}})
+		return err
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeChannel(ctx, w, channel.ID, userIdObject, "Unsubscribed")
+}
+
+func (s *ConversationService) writeChannel(ctx context.Context, w http.ResponseWriter, channelId primitive.ObjectID, userId primitive.ObjectID, message string) {
+	var channel models.Conversation
+	if err := s.conversationCollection.FindOne(ctx, bson.M{"_id": channelId}).Decode(&channel); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	detail, err := s.conversationDetail(ctx, &channel, userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: message,
+		Status:  http.StatusOK,
+		Data:    detail,
+	})
+}
+
+// findChannel loads the {id} channel without requiring the caller to be a member.
+func (s *ConversationService) findChannel(w http.ResponseWriter, r *http.Request) (*models.Conversation, primitive.ObjectID, bool) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return nil, primitive.NilObjectID, false
+	}
+
+	conversationIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+		return nil, primitive.NilObjectID, false
+	}
+
+	var channel models.Conversation
+	err = s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": conversationIdObject, "type": models.ConversationTypeChannel})).Decode(&channel)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Channel not found")
+		return nil, primitive.NilObjectID, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, primitive.NilObjectID, false
+	}
+
+	return &channel, userIdObject, true
+}
+
+// addSubscriber records the subscription and bumps the count. A second
+// subscription by the same user hits the unique index and changes nothing.
+func (s *ConversationService) addSubscriber(ctx context.Context, channelId primitive.ObjectID, userId primitive.ObjectID, now time.Time) error {
+	_, err := s.subscriptionCollection().InsertOne(ctx, models.ChannelSubscription{
+		ChannelID: channelId,
+		UserID:    userId,
+		CreatedAt: now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return errAlreadyMember
+	} else if err != nil {
+		return err
+	}
+
+	_, err = s.conversationCollection.UpdateByID(ctx, channelId, bson.M{"$inc": bson.M{"subscriberCount": 1}})
+	return err
+}
+
+func (s *ConversationService) isSubscribed(ctx context.Context, channelId primitive.ObjectID, userId primitive.ObjectID) (bool, error) {
+	return membership.IsSubscribed(ctx, s.conversationCollection.Database(), channelId, userId)
+}
+
+// inTransaction runs fn so its writes land together, like a subscription and the
+// channel's subscriber count.
+func (s *ConversationService) inTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := s.conversationCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// isMember treats channel subscribers as members next to the participants.
+func (s *ConversationService) isMember(ctx context.Context, conversation *models.Conversation, userId primitive.ObjectID) (bool, error) {
+	return membership.IsMember(ctx, s.conversationCollection.Database(), conversation, userId)
+}
+
+// membershipFilter matches every conversation the user takes part in or subscribes to.
+func (s *ConversationService) membershipFilter(ctx context.Context, userId primitive.ObjectID) (bson.M, error) {
+	return membership.Filter(ctx, s.conversationCollection.Database(), userId)
+}
+
+// AuthorizeChannel lets members subscribe to a conversation's realtime channel.
+func (s *ConversationService) AuthorizeChannel(ctx context.Context, userId string, channel string) (bool, error) {
+	conversationId, ok := realtime.ConversationIDFromChannel(channel)
+	if !ok {
+		return false, nil
+	}
+
+	conversationIdObject, err := primitive.ObjectIDFromHex(conversationId)
+	if err != nil {
+		return false, nil
+	}
+
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return false, nil
+	}
+
+	var conversation models.Conversation
+	err = s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": conversationIdObject})).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return s.isMember(ctx, &conversation, userIdObject)
+}
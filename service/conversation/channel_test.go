@@ -0,0 +1,158 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_Channels(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Channel Owner")
+		reader, _ := testDB.CreateTestUser("reader@example.com", "reader", "Channel Reader")
+		outsider, _ := testDB.CreateTestUser("outsider@example.com", "outsider", "Outsider")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", conversationService.getConversation).Methods(http.MethodGet)
+		router.HandleFunc("/channels", conversationService.searchChannels).Methods(http.MethodGet)
+		router.HandleFunc("/channels", conversationService.createChannel).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/messages", conversationService.listMessages).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/pins", conversationService.pinMessage).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/subscribe", conversationService.subscribeChannel).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/subscribe", conversationService.unsubscribeChannel).Methods(http.MethodDelete)
+		router.HandleFunc("/{id}/invites", conversationService.createInvite).Methods(http.MethodPost)
+		router.HandleFunc("/invites/{token}/join", conversationService.joinInvite).Methods(http.MethodPost)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		decodeDetail := func(w *httptest.ResponseRecorder) models.ConversationDetail {
+			var response struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data
+		}
+
+		var public, private models.ConversationDetail
+
+		t.Run("Create channels", func(t *testing.T) {
+			w := do(owner.ID, http.MethodPost, "/channels", `{"name": "Release notes", "description": "What shipped", "public": true}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			public = decodeDetail(w)
+			assert.Equal(t, models.ConversationTypeChannel, public.Type)
+			assert.True(t, public.Public)
+			assert.Equal(t, []primitive.ObjectID{owner.ID}, public.Admins)
+
+			w = do(owner.ID, http.MethodPost, "/channels", `{"name": "Release candidates"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			private = decodeDetail(w)
+			assert.False(t, private.Public)
+		})
+
+		t.Run("Directory lists public channels only", func(t *testing.T) {
+			w := do(reader.ID, http.MethodGet, "/channels?q=release", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ChannelDirectoryResponse `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 1)
+			assert.Equal(t, public.ID, response.Data.Results[0].ID)
+		})
+
+		t.Run("Subscribe to a public channel", func(t *testing.T) {
+			w := do(reader.ID, http.MethodPost, "/"+public.ID.Hex()+"/subscribe", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			detail := decodeDetail(w)
+			assert.True(t, detail.Subscribed)
+			assert.Equal(t, int64(1), detail.SubscriberCount)
+
+			// Subscribing twice doesn't count twice
+			detail = decodeDetail(do(reader.ID, http.MethodPost, "/"+public.ID.Hex()+"/subscribe", ""))
+			assert.Equal(t, int64(1), detail.SubscriberCount)
+		})
+
+		t.Run("Subscribed channels show up in the conversation list", func(t *testing.T) {
+			w := do(reader.ID, http.MethodGet, "/", "")
+
+			var response struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 1)
+			assert.Equal(t, public.ID, response.Data.Results[0].ID)
+		})
+
+		t.Run("Subscribers read but can't manage", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(reader.ID, http.MethodGet, "/"+public.ID.Hex()+"/messages", "").Code)
+			assert.Equal(t, http.StatusForbidden, do(outsider.ID, http.MethodGet, "/"+public.ID.Hex()+"/messages", "").Code)
+
+			message, _ := testDB.CreateTestMessage(owner.ID, primitive.NilObjectID, "v1.2 is out")
+			w := do(reader.ID, http.MethodPost, "/"+public.ID.Hex()+"/pins", `{"messageId": "`+message.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Only subscribers may listen on the realtime channel", func(t *testing.T) {
+			channel := realtime.ConversationChannel(public.ID.Hex())
+
+			ok, err := conversationService.AuthorizeChannel(context.Background(), reader.ID.Hex(), channel)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = conversationService.AuthorizeChannel(context.Background(), outsider.ID.Hex(), channel)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+
+		t.Run("Private channels need an invite", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(outsider.ID, http.MethodPost, "/"+private.ID.Hex()+"/subscribe", "").Code)
+
+			w := do(owner.ID, http.MethodPost, "/"+private.ID.Hex()+"/invites", `{}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			var invite struct {
+				Data models.GroupInvite `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &invite)
+
+			w = do(outsider.ID, http.MethodPost, "/invites/"+invite.Data.Token+"/join", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			ok, _ := conversationService.AuthorizeChannel(context.Background(), outsider.ID.Hex(), realtime.ConversationChannel(private.ID.Hex()))
+			assert.True(t, ok)
+		})
+
+		t.Run("Unsubscribe", func(t *testing.T) {
+			w := do(reader.ID, http.MethodDelete, "/"+public.ID.Hex()+"/subscribe", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			detail := decodeDetail(w)
+			assert.False(t, detail.Subscribed)
+			assert.Equal(t, int64(0), detail.SubscriberCount)
+
+			assert.Equal(t, http.StatusBadRequest, do(owner.ID, http.MethodDelete, "/"+public.ID.Hex()+"/subscribe", "").Code)
+		})
+	})
+}
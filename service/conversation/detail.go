@@ -0,0 +1,202 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *ConversationService) userCollection() *mongo.Collection {
+	return s.conversationCollection.Database().Collection("users")
+}
+
+func (s *ConversationService) getConversationDetails(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	detail, err := s.conversationDetail(ctx, conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    detail,
+	})
+}
+
+// createConversation opens the direct conversation with another user, creating
+// it when it doesn't exist yet. No message is sent.
+func (s *ConversationService) createConversation(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.CreateConversationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	otherIdObject, err := primitive.ObjectIDFromHex(payload.UserID)
+	if err != nil || otherIdObject == userIdObject {
+		utils.WriteError(w, http.StatusBadRequest, "User id not valid")
+		return
+	}
+
+	count, err := s.userCollection().CountDocuments(ctx, bson.M{"_id": otherIdObject})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	inWorkspace, err := tenant.AreMembers(ctx, s.conversationCollection.Database(), userIdObject, otherIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count == 0 || !inWorkspace {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// The same two users have a separate direct chat in every workspace they share
+	status := http.StatusOK
+	filter := tenant.Scope(ctx, bson.M{"participants": bson.M{"$all": bson.A{userIdObject, otherIdObject}}, "type": bson.M{"$exists": false}})
+	var conversation models.Conversation
+	err = s.conversationCollection.FindOne(ctx, filter).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		now := time.Now()
+		conversation = models.Conversation{
+			ID:           primitive.NewObjectID(),
+			WorkspaceID:  tenant.FromContext(ctx),
+			PairKey:      models.DirectPairKey(userIdObject, otherIdObject),
+			Participants: []primitive.ObjectID{userIdObject, otherIdObject},
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		_, err = s.conversationCollection.InsertOne(ctx, conversation)
+		if mongo.IsDuplicateKeyError(err) {
+			// The other user opened it at the same time, use theirs
+			err = s.conversationCollection.FindOne(ctx, filter).Decode(&conversation)
+		} else if err == nil {
+			status = http.StatusCreated
+		}
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	detail, err := s.conversationDetail(ctx, &conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, status, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  status,
+		Data:    detail,
+	})
+}
+
+func (s *ConversationService) conversationDetail(ctx context.Context, conversation *models.Conversation, userId primitive.ObjectID) (*models.ConversationDetail, error) {
+	cursor, err := s.userCollection().Find(ctx, bson.M{"_id": bson.M{"$in": conversation.Participants}})
+	if err != nil {
+		return nil, err
+	}
+
+	participants := make([]models.UserPublic, 0, len(conversation.Participants))
+	if err := cursor.All(ctx, &participants); err != nil {
+		return nil, err
+	}
+
+	settings, err := s.findSettings(ctx, userId, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	unreadFilter := bson.M{
+		"conversationId": conversation.ID,
+		"receiverId":     userId,
+		"isRead":         false,
+		"kind":           bson.M{"$ne": models.MessageKindSystem},
+	}
+	createdAfter := settings.ClearedAt
+	if conversation.IsGroup() {
+		// Group members have a read position instead of per-message flags
+		delete(unreadFilter, "receiverId")
+		delete(unreadFilter, "isRead")
+		unreadFilter["senderId"] = bson.M{"$ne": userId}
+		if settings.LastReadAt != nil && (createdAfter == nil || settings.LastReadAt.After(*createdAfter)) {
+			createdAfter = settings.LastReadAt
+		}
+	}
+	if createdAfter != nil {
+		unreadFilter["createdAt"] = bson.M{"$gt": createdAfter}
+	}
+
+	unread, err := s.messageCollection.CountDocuments(ctx, unreadFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := false
+	if conversation.IsChannel() && !conversation.IsParticipant(userId) {
+		if subscribed, err = s.isSubscribed(ctx, conversation.ID, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	pinned := conversation.Pinned
+	if pinned == nil {
+		pinned = []models.PinnedMessage{}
+	}
+
+	return &models.ConversationDetail{
+		ID:              conversation.ID,
+		Type:            conversation.Type,
+		Name:            conversation.Name,
+		OwnerID:         conversation.OwnerID,
+		Admins:          conversation.Admins,
+		Description:     conversation.Description,
+		Public:          conversation.Public,
+		SubscriberCount: conversation.SubscriberCount,
+		Subscribed:      subscribed,
+		Participants:    participants,
+		MessageTimer:    conversation.MessageTimer,
+		PinnedMessages:  pinned,
+		UnreadCount:     unread,
+		Settings:        settings,
+		CreatedAt:       conversation.CreatedAt,
+		UpdatedAt:       conversation.UpdatedAt,
+	}, nil
+}
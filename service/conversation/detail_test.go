@@ -0,0 +1,143 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_Details(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", conversationService.createConversation).Methods(http.MethodPost)
+		router.HandleFunc("/{id}", conversationService.getConversationDetails).Methods(http.MethodGet)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		decode := func(w *httptest.ResponseRecorder) models.ConversationDetail {
+			var response struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data
+		}
+
+		var created models.ConversationDetail
+
+		t.Run("Create opens a new conversation without a message", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPost, "/", `{"userId": "`+user2.ID.Hex()+`"}`)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			created = decode(w)
+			assert.Len(t, created.Participants, 2)
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"conversationId": created.ID})
+			assert.Equal(t, int64(0), count)
+		})
+
+		t.Run("Create returns the existing conversation", func(t *testing.T) {
+			w := do(user2.ID, http.MethodPost, "/", `{"userId": "`+user1.ID.Hex()+`"}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, created.ID, decode(w).ID)
+
+			count, _ := testDB.ConvCol.CountDocuments(context.Background(), bson.M{})
+			assert.Equal(t, int64(1), count)
+		})
+
+		t.Run("Opening the same conversation concurrently creates it once", func(t *testing.T) {
+			var wg sync.WaitGroup
+			codes := make([]int, 10)
+			for i := range codes {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if i%2 == 0 {
+						codes[i] = do(user1.ID, http.MethodPost, "/", `{"userId": "`+user3.ID.Hex()+`"}`).Code
+					} else {
+						codes[i] = do(user3.ID, http.MethodPost, "/", `{"userId": "`+user1.ID.Hex()+`"}`).Code
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			for _, code := range codes {
+				assert.Contains(t, []int{http.StatusOK, http.StatusCreated}, code)
+			}
+
+			count, _ := testDB.ConvCol.CountDocuments(context.Background(), bson.M{"participants": bson.M{"$all": bson.A{user1.ID, user3.ID}}})
+			assert.Equal(t, int64(1), count)
+			testDB.ConvCol.DeleteMany(context.Background(), bson.M{"participants": bson.M{"$all": bson.A{user1.ID, user3.ID}}})
+		})
+
+		t.Run("Create with yourself or an unknown user", func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, do(user1.ID, http.MethodPost, "/", `{"userId": "`+user1.ID.Hex()+`"}`).Code)
+			assert.Equal(t, http.StatusBadRequest, do(user1.ID, http.MethodPost, "/", `{"userId": "nope"}`).Code)
+			assert.Equal(t, http.StatusNotFound, do(user1.ID, http.MethodPost, "/", `{"userId": "`+primitive.NewObjectID().Hex()+`"}`).Code)
+		})
+
+		t.Run("Details include every participant", func(t *testing.T) {
+			testDB.MsgCol.InsertOne(context.Background(), models.Message{
+				ConversationID: created.ID,
+				SenderID:       user2.ID,
+				ReceiverID:     user1.ID,
+				Message:        "hi",
+			})
+
+			w := do(user1.ID, http.MethodGet, "/"+created.ID.Hex(), "")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			detail := decode(w)
+			usernames := []string{detail.Participants[0].Username, detail.Participants[1].Username}
+			assert.ElementsMatch(t, []string{"user1", "user2"}, usernames)
+			assert.Equal(t, int64(1), detail.UnreadCount)
+			assert.NotNil(t, detail.PinnedMessages)
+		})
+
+		t.Run("Non participant is forbidden", func(t *testing.T) {
+			w := do(user3.ID, http.MethodGet, "/"+created.ID.Hex(), "")
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Unknown conversation", func(t *testing.T) {
+			w := do(user1.ID, http.MethodGet, "/"+primitive.NewObjectID().Hex(), "")
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Invalid conversation id", func(t *testing.T) {
+			w := do(user1.ID, http.MethodGet, "/not-an-id", "")
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
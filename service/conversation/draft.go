@@ -0,0 +1,132 @@
+package conversation
+
+import (
+	"encoding/json"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// socketIdHeader carries the Pusher socket id of the calling device.
+const socketIdHeader = "X-Socket-Id"
+
+func (s *ConversationService) draftCollection() *mongo.Collection {
+	return s.conversationCollection.Database().Collection("drafts")
+}
+
+func (s *ConversationService) getDraft(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	var draft models.Draft
+	err := s.draftCollection().FindOne(ctx, bson.M{"userId": userIdObject, "conversationId": conversation.ID}).Decode(&draft)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Draft not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    draft,
+	})
+}
+
+func (s *ConversationService) putDraft(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.DraftPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	var draft models.Draft
+	err := s.draftCollection().FindOneAndUpdate(ctx,
+		bson.M{"userId": userIdObject, "conversationId": conversation.ID},
+		bson.M{"$set": bson.M{"text": payload.Text, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&draft)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishDraft(r, models.DraftEvent{
+		ConversationID: draft.ConversationID,
+		Text:           draft.Text,
+		UpdatedAt:      draft.UpdatedAt,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Draft saved",
+		Status:  http.StatusOK,
+		Data:    draft,
+	})
+}
+
+func (s *ConversationService) deleteDraft(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	// Deleting a missing draft is fine, the device may be clearing after a send
+	_, err := s.draftCollection().DeleteOne(ctx, bson.M{"userId": userIdObject, "conversationId": conversation.ID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishDraft(r, models.DraftEvent{
+		ConversationID: conversation.ID,
+		UpdatedAt:      time.Now(),
+	})
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Draft deleted",
+		Status:  http.StatusOK,
+		Data:    nil,
+	})
+}
+
+func publishDraft(r *http.Request, event models.DraftEvent) {
+	userId := r.Context().Value(types.ContextKeyUserID).(string)
+	realtime.PublishExcept(realtime.UserChannel(userId), "draft-updated", event, r.Header.Get(socketIdHeader))
+}
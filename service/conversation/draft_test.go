@@ -0,0 +1,121 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_Drafts(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+		conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, nil)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", conversationService.getConversation).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/draft", conversationService.getDraft).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/draft", conversationService.putDraft).Methods(http.MethodPut)
+		router.HandleFunc("/{id}/draft", conversationService.deleteDraft).Methods(http.MethodDelete)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			req.Header.Set("X-Socket-Id", "111.222")
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		draftPath := "/" + conv.ID.Hex() + "/draft"
+
+		t.Run("Saving a draft notifies the user's other sessions", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPut, draftPath, `{"text": "half typed"}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			events := recorder.Events("draft-updated")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user1.ID.Hex()), events[0].Channel)
+			assert.Equal(t, "111.222", events[0].ExceptSocketID)
+		})
+
+		t.Run("Another device reads the draft", func(t *testing.T) {
+			w := do(user1.ID, http.MethodGet, draftPath, "")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.Draft `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, "half typed", response.Data.Text)
+		})
+
+		t.Run("Drafts are private to their author", func(t *testing.T) {
+			w := do(user2.ID, http.MethodGet, draftPath, "")
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Conversation list carries a draft preview", func(t *testing.T) {
+			do(user1.ID, http.MethodPut, draftPath, `{"text": "`+strings.Repeat("a", 150)+`"}`)
+
+			w := do(user1.ID, http.MethodGet, "/", "")
+
+			var response struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 1)
+			assert.NotNil(t, response.Data.Results[0].Draft)
+			assert.Len(t, response.Data.Results[0].Draft.Text, draftPreviewLength)
+
+			var other struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			w = do(user2.ID, http.MethodGet, "/", "")
+			json.Unmarshal(w.Body.Bytes(), &other)
+			assert.Nil(t, other.Data.Results[0].Draft)
+		})
+
+		t.Run("Delete clears the draft", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodDelete, draftPath, "").Code)
+			assert.Equal(t, http.StatusNotFound, do(user1.ID, http.MethodGet, draftPath, "").Code)
+
+			events := recorder.Events("draft-updated")
+			assert.Empty(t, events[len(events)-1].Data.(models.DraftEvent).Text)
+		})
+
+		t.Run("Non participant", func(t *testing.T) {
+			w := do(user3.ID, http.MethodPut, draftPath, `{"text": "sneaky"}`)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Empty draft is rejected", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPut, draftPath, `{"text": ""}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
@@ -0,0 +1,227 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"lite-chat-go/blocking"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createGroup starts a group owned and administered by the caller.
+func (s *ConversationService) createGroup(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.CreateGroupPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+
+	members := []primitive.ObjectID{userIdObject}
+	seen := map[primitive.ObjectID]bool{userIdObject: true}
+	for _, id := range payload.MemberIDs {
+		memberId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Member ID not valid")
+			return
+		}
+		if !seen[memberId] {
+			seen[memberId] = true
+			members = append(members, memberId)
+		}
+	}
+
+	if len(members) > models.MaxGroupMembers {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("A group can have at most %d members", models.MaxGroupMembers))
+		return
+	}
+
+	count, err := s.userCollection().CountDocuments(ctx, bson.M{"_id": bson.M{"$in": members}})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	inWorkspace, err := tenant.AreMembers(ctx, s.conversationCollection.Database(), members...)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if int(count) != len(members) || !inWorkspace {
+		utils.WriteError(w, http.StatusBadRequest, "Some members were not found")
+		return
+	}
+
+	blocked, err := blocking.Between(ctx, s.conversationCollection.Database(), userIdObject, members[1:]...)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if blocked {
+		utils.WriteError(w, http.StatusForbidden, "Some members can't be added")
+		return
+	}
+
+	now := time.Now()
+	conversation := models.Conversation{
+		ID:           primitive.NewObjectID(),
+		WorkspaceID:  tenant.FromContext(ctx),
+		Type:         models.ConversationTypeGroup,
+		Name:         name,
+		OwnerID:      &userIdObject,
+		Admins:       []primitive.ObjectID{userIdObject},
+		Participants: members,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	systemMessage := newSystemMessage(&conversation, models.SystemEvent{
+		Type:    models.SystemEventGroupCreated,
+		ActorID: userIdObject,
+		Name:    name,
+	}, "", now)
+	conversation.Messages = []primitive.ObjectID{systemMessage.ID}
+
+	if _, err := s.messageCollection.InsertOne(ctx, systemMessage); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := s.conversationCollection.InsertOne(ctx, conversation); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishSystemMessage(&conversation, systemMessage)
+
+	detail, err := s.conversationDetail(ctx, &conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Group created",
+		Status:  http.StatusCreated,
+		Data:    detail,
+	})
+}
+
+// adminGroup loads the {id} group or channel, writing 403 unless the caller administers it.
+func (s *ConversationService) adminGroup(w http.ResponseWriter, r *http.Request) (*models.Conversation, primitive.ObjectID, bool) {
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return nil, primitive.NilObjectID, false
+	}
+
+	if !conversation.IsGroup() && !conversation.IsChannel() {
+		utils.WriteError(w, http.StatusBadRequest, "Conversation is not a group or channel")
+		return nil, primitive.NilObjectID, false
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(r.Context().Value(types.ContextKeyUserID).(string))
+	if !conversation.IsAdmin(userIdObject) {
+		utils.WriteError(w, http.StatusForbidden, "Only admins can do this")
+		return nil, primitive.NilObjectID, false
+	}
+
+	return conversation, userIdObject, true
+}
+
+// renameConversation changes a group or channel name and records it in the history.
+func (s *ConversationService) renameConversation(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.RenameConversationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	conversation, userIdObject, ok := s.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if name != conversation.Name {
+		actor, err := s.displayName(ctx, userIdObject)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		now := time.Now()
+		systemMessage := newSystemMessage(conversation, models.SystemEvent{
+			Type:         models.SystemEventRenamed,
+			ActorID:      userIdObject,
+			Name:         name,
+			PreviousName: conversation.Name,
+		}, actor, now)
+
+		if _, err := s.messageCollection.InsertOne(ctx, systemMessage); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		update := bson.M{
+			"$set":  bson.M{"name": name, "updatedAt": now},
+			"$push": bson.M{"messages": systemMessage.ID},
+		}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := s.conversationCollection.FindOneAndUpdate(ctx, bson.M{"_id": conversation.ID}, update, opts).Decode(conversation); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		publishSystemMessage(conversation, systemMessage)
+	}
+
+	detail, err := s.conversationDetail(ctx, conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    detail,
+	})
+}
@@ -0,0 +1,425 @@
+package conversation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lite-chat-go/blocking"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const inviteTokenBytes = 16
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteInvalid  = errors.New("invite is no longer valid")
+	ErrGroupFull      = errors.New("group is full")
+	ErrBlocked        = errors.New("user and a member blocked each other")
+	errAlreadyMember  = errors.New("already a member")
+)
+
+func (s *ConversationService) inviteCollection() *mongo.Collection {
+	return s.conversationCollection.Database().Collection("group_invites")
+}
+
+// RegisterInviteRoutes serves the link side of invites, open to any signed in user.
+func (s *ConversationService) RegisterInviteRoutes(router *mux.Router) {
+	router.HandleFunc("/{token}", utils.WithJwtAuth(s.previewInvite)).Methods(http.MethodGet)
+	router.HandleFunc("/{token}/join", utils.WithJwtAuth(s.joinInvite)).Methods(http.MethodPost)
+}
+
+func newInviteToken() (string, error) {
+	b := make([]byte, inviteTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *ConversationService) createInvite(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.CreateInvitePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversation, userIdObject, ok := s.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	invite := models.GroupInvite{
+		ID:             primitive.NewObjectID(),
+		Token:          token,
+		ConversationID: conversation.ID,
+		CreatedBy:      userIdObject,
+		MaxUses:        payload.MaxUses,
+		CreatedAt:      now,
+	}
+	if payload.ExpiresInSeconds > 0 {
+		expiresAt := now.Add(time.Duration(payload.ExpiresInSeconds) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if _, err := s.inviteCollection().InsertOne(ctx, invite); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Invite created",
+		Status:  http.StatusCreated,
+		Data:    invite,
+	})
+}
+
+func (s *ConversationService) listInvites(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, _, ok := s.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	cursor, err := s.inviteCollection().Find(ctx,
+		bson.M{"conversationId": conversation.ID, "revokedAt": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	invites := make([]models.GroupInvite, 0)
+	if err := cursor.All(ctx, &invites); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    invites,
+	})
+}
+
+func (s *ConversationService) revokeInvite(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	inviteIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["inviteId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invite ID not valid")
+		return
+	}
+
+	conversation, _, ok := s.adminGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var invite models.GroupInvite
+	err = s.inviteCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": inviteIdObject, "conversationId": conversation.ID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Invite not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Invite revoked",
+		Status:  http.StatusOK,
+		Data:    invite,
+	})
+}
+
+func (s *ConversationService) previewInvite(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	invite, conversation, err := s.usableInvite(ctx, mux.Vars(r)["token"])
+	if err != nil {
+		writeInviteError(w, err)
+		return
+	}
+
+	member, err := s.isMember(ctx, conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	memberCount := int64(len(conversation.Participants))
+	if conversation.IsChannel() {
+		memberCount = conversation.SubscriberCount
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.InvitePreview{
+			ConversationID: conversation.ID,
+			Type:           conversation.Type,
+			Name:           conversation.Name,
+			MemberCount:    memberCount,
+			ExpiresAt:      invite.ExpiresAt,
+			IsMember:       member,
+		},
+	})
+}
+
+func (s *ConversationService) joinInvite(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	invite, conversation, err := s.usableInvite(ctx, mux.Vars(r)["token"])
+	if err != nil {
+		writeInviteError(w, err)
+		return
+	}
+
+	member, err := s.isMember(ctx, conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := "Joined"
+	if !member {
+		err = s.join(ctx, invite, conversation, userIdObject)
+		if err == errAlreadyMember {
+			err = nil
+		} else if err != nil {
+			writeInviteError(w, err)
+			return
+		}
+	} else {
+		message = "Already a member"
+	}
+
+	var updated models.Conversation
+	if err := s.conversationCollection.FindOne(ctx, bson.M{"_id": conversation.ID}).Decode(&updated); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	detail, err := s.conversationDetail(ctx, &updated, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: message,
+		Status:  http.StatusOK,
+		Data:    detail,
+	})
+}
+
+// usableInvite resolves a token to its invite and group, failing when the link
+// can no longer be used.
+func (s *ConversationService) usableInvite(ctx context.Context, token string) (*models.GroupInvite, *models.Conversation, error) {
+	var invite models.GroupInvite
+	err := s.inviteCollection().FindOne(ctx, bson.M{"token": token}).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrInviteNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if !invite.IsUsable(time.Now()) {
+		return nil, nil, ErrInviteInvalid
+	}
+
+	var conversation models.Conversation
+	// Invites only work inside the workspace of their group
+	err = s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{
+		"_id":  invite.ConversationID,
+		"type": bson.M{"$in": bson.A{models.ConversationTypeGroup, models.ConversationTypeChannel}},
+	})).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrInviteNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	return &invite, &conversation, nil
+}
+
+// join spends one use of the invite and adds the user to the group, or subscribes
+// them to the channel. Both writes are guarded so concurrent joins can't overrun
+// maxUses or the group member limit.
+func (s *ConversationService) join(ctx context.Context, invite *models.GroupInvite, conversation *models.Conversation, userId primitive.ObjectID) error {
+	now := time.Now()
+
+	// Nobody joins a group or channel run by someone they blocked or who blocked them
+	blocked, err := blocking.Between(ctx, s.conversationCollection.Database(), userId, conversation.Participants...)
+	if err != nil {
+		return err
+	} else if blocked {
+		return ErrBlocked
+	}
+
+	var systemMessage *models.Message
+	if conversation.IsGroup() {
+		name, err := s.displayName(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		message := newSystemMessage(conversation, models.SystemEvent{
+			Type:      models.SystemEventMemberJoined,
+			ActorID:   userId,
+			ViaInvite: true,
+		}, name, now)
+		systemMessage = &message
+	}
+
+	session, err := s.conversationCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	// The group as it is after the join, so the new member hears about it too
+	var joined models.Conversation
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := s.inviteCollection().UpdateOne(sc,
+			bson.M{
+				"_id":       invite.ID,
+				"revokedAt": bson.M{"$exists": false},
+				"$and": bson.A{
+					bson.M{"$or": bson.A{
+						bson.M{"expiresAt": bson.M{"$exists": false}},
+						bson.M{"expiresAt": bson.M{"$gt": now}},
+					}},
+					bson.M{"$or": bson.A{
+						bson.M{"maxUses": bson.M{"$exists": false}},
+						bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$maxUses"}}},
+					}},
+				},
+			},
+			bson.M{"$inc": bson.M{"uses": 1}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrInviteInvalid
+		}
+
+		// Channel joins don't post a system message, a busy channel would drown in them
+		if conversation.IsChannel() {
+			return nil, s.addSubscriber(sc, conversation.ID, userId, now)
+		}
+
+		err = s.conversationCollection.FindOneAndUpdate(sc,
+			bson.M{
+				"_id":          conversation.ID,
+				"participants": bson.M{"$ne": userId},
+				fmt.Sprintf("participants.%d", models.MaxGroupMembers-1): bson.M{"$exists": false},
+			},
+			bson.M{
+				"$push": bson.M{"participants": userId, "messages": systemMessage.ID},
+				"$set":  bson.M{"updatedAt": now},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&joined)
+		if err == mongo.ErrNoDocuments {
+			count, err := s.conversationCollection.CountDocuments(sc, bson.M{"_id": conversation.ID, "participants": userId})
+			if err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				return nil, errAlreadyMember
+			}
+			return nil, ErrGroupFull
+		} else if err != nil {
+			return nil, err
+		}
+
+		if _, err := s.messageCollection.InsertOne(sc, systemMessage); err != nil {
+			return nil, err
+		}
+
+		// History from before the join doesn't count as unread
+		_, err = s.settingsCollection().UpdateOne(sc,
+			bson.M{"userId": userId, "conversationId": conversation.ID},
+			bson.M{"$max": bson.M{"lastReadAt": now}, "$set": bson.M{"updatedAt": now}},
+			options.Update().SetUpsert(true),
+		)
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if systemMessage != nil {
+		publishSystemMessage(&joined, *systemMessage)
+	}
+
+	return nil
+}
+
+func writeInviteError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInviteNotFound:
+		utils.WriteError(w, http.StatusNotFound, "Invite not found")
+	case ErrInviteInvalid:
+		utils.WriteError(w, http.StatusGone, "Invite link has expired or been revoked")
+	case ErrBlocked:
+		utils.WriteError(w, http.StatusForbidden, "You can't join this group")
+	case ErrGroupFull:
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("Group has reached the limit of %d members", models.MaxGroupMembers))
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,231 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/blocking"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_GroupInvites(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Group Owner")
+		member, _ := testDB.CreateTestUser("member@example.com", "member", "Group Member")
+		joiner, _ := testDB.CreateTestUser("joiner@example.com", "joiner", "New Joiner")
+		late, _ := testDB.CreateTestUser("late@example.com", "late", "Late Joiner")
+		dm, _ := testDB.CreateTestConversation([]primitive.ObjectID{owner.ID, member.ID}, nil)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/groups", conversationService.createGroup).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/invites", conversationService.listInvites).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/invites", conversationService.createInvite).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/invites/{inviteId}", conversationService.revokeInvite).Methods(http.MethodDelete)
+		router.HandleFunc("/invites/{token}", conversationService.previewInvite).Methods(http.MethodGet)
+		router.HandleFunc("/invites/{token}/join", conversationService.joinInvite).Methods(http.MethodPost)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		createInvite := func(groupId primitive.ObjectID, body string) models.GroupInvite {
+			w := do(owner.ID, http.MethodPost, "/"+groupId.Hex()+"/invites", body)
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var response struct {
+				Data models.GroupInvite `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data
+		}
+
+		var group models.ConversationDetail
+
+		t.Run("Create a group", func(t *testing.T) {
+			w := do(owner.ID, http.MethodPost, "/groups", `{"name": " Weekend trip ", "memberIds": ["`+member.ID.Hex()+`"]}`)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var response struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			group = response.Data
+			assert.Equal(t, models.ConversationTypeGroup, group.Type)
+			assert.Equal(t, "Weekend trip", group.Name)
+			assert.Len(t, group.Participants, 2)
+			assert.Equal(t, []primitive.ObjectID{owner.ID}, group.Admins)
+		})
+
+		t.Run("Only admins manage invites", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(member.ID, http.MethodPost, "/"+group.ID.Hex()+"/invites", `{}`).Code)
+			assert.Equal(t, http.StatusForbidden, do(member.ID, http.MethodGet, "/"+group.ID.Hex()+"/invites", "").Code)
+			assert.Equal(t, http.StatusBadRequest, do(owner.ID, http.MethodPost, "/"+dm.ID.Hex()+"/invites", `{}`).Code)
+		})
+
+		t.Run("Preview and join through a link", func(t *testing.T) {
+			invite := createInvite(group.ID, `{"expiresInSeconds": 3600, "maxUses": 1}`)
+			assert.NotEmpty(t, invite.Token)
+			assert.NotNil(t, invite.ExpiresAt)
+
+			w := do(joiner.ID, http.MethodGet, "/invites/"+invite.Token, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var preview struct {
+				Data models.InvitePreview `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &preview)
+			assert.Equal(t, "Weekend trip", preview.Data.Name)
+			assert.Equal(t, int64(2), preview.Data.MemberCount)
+			assert.False(t, preview.Data.IsMember)
+
+			w = do(joiner.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": group.ID}).Decode(&conversation)
+			assert.Contains(t, conversation.Participants, joiner.ID)
+
+			var systemMessage models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"conversationId": group.ID, "system.type": models.SystemEventMemberJoined}).Decode(&systemMessage)
+			assert.Equal(t, joiner.ID, systemMessage.System.ActorID)
+			assert.Equal(t, "New Joiner joined using an invite link", systemMessage.Message)
+
+			// The new member is told about their own join along with everyone else
+			channels := make([]string, 0)
+			for _, event := range recorder.Events("upcoming-message") {
+				if event.Data.(models.Message).ID == systemMessage.ID {
+					channels = append(channels, event.Channel)
+				}
+			}
+			assert.ElementsMatch(t, []string{
+				realtime.UserChannel(owner.ID.Hex()),
+				realtime.UserChannel(member.ID.Hex()),
+				realtime.UserChannel(joiner.ID.Hex()),
+			}, channels)
+
+			// History from before the join isn't unread for the new member
+			var settings models.ConversationSettings
+			conversationService.settingsCollection().FindOne(context.Background(), bson.M{"userId": joiner.ID, "conversationId": group.ID}).Decode(&settings)
+			assert.NotNil(t, settings.LastReadAt)
+
+			// A used up link is gone, members included
+			w = do(joiner.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "")
+			assert.Equal(t, http.StatusGone, w.Code)
+
+			// The single use is gone for everyone else
+			w = do(late.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "")
+			assert.Equal(t, http.StatusGone, w.Code)
+		})
+
+		t.Run("Members rejoining an open link are a no-op", func(t *testing.T) {
+			invite := createInvite(group.ID, `{}`)
+
+			w := do(member.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var stored models.GroupInvite
+			conversationService.inviteCollection().FindOne(context.Background(), bson.M{"_id": invite.ID}).Decode(&stored)
+			assert.Equal(t, 0, stored.Uses)
+		})
+
+		t.Run("Revoked links stop working", func(t *testing.T) {
+			invite := createInvite(group.ID, `{}`)
+
+			w := do(owner.ID, http.MethodDelete, "/"+group.ID.Hex()+"/invites/"+invite.ID.Hex(), "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			assert.Equal(t, http.StatusGone, do(late.ID, http.MethodGet, "/invites/"+invite.Token, "").Code)
+			assert.Equal(t, http.StatusNotFound, do(owner.ID, http.MethodDelete, "/"+group.ID.Hex()+"/invites/"+invite.ID.Hex(), "").Code)
+
+			w = do(owner.ID, http.MethodGet, "/"+group.ID.Hex()+"/invites", "")
+			var response struct {
+				Data []models.GroupInvite `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			for _, listed := range response.Data {
+				assert.NotEqual(t, invite.ID, listed.ID)
+			}
+		})
+
+		t.Run("Blocked users can't join or be added", func(t *testing.T) {
+			testDB.Database.Collection(blocking.Collection).InsertOne(context.Background(), models.Block{
+				BlockerID: member.ID,
+				BlockedID: late.ID,
+				CreatedAt: time.Now(),
+			})
+			defer testDB.Database.Collection(blocking.Collection).DeleteMany(context.Background(), bson.M{})
+
+			invite := createInvite(group.ID, `{}`)
+			assert.Equal(t, http.StatusForbidden, do(late.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "").Code)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": group.ID}).Decode(&conversation)
+			assert.NotContains(t, conversation.Participants, late.ID)
+
+			w := do(member.ID, http.MethodPost, "/groups", `{"name": "Book club", "memberIds": ["`+late.ID.Hex()+`"]}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Expired links stop working", func(t *testing.T) {
+			invite := createInvite(group.ID, `{"expiresInSeconds": 60}`)
+			conversationService.inviteCollection().UpdateByID(context.Background(), invite.ID, bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)}})
+
+			assert.Equal(t, http.StatusGone, do(late.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "").Code)
+		})
+
+		t.Run("Full groups can't be joined", func(t *testing.T) {
+			invite := createInvite(group.ID, `{}`)
+
+			filler := make([]primitive.ObjectID, models.MaxGroupMembers)
+			filler[0] = owner.ID
+			for i := 1; i < len(filler); i++ {
+				filler[i] = primitive.NewObjectID()
+			}
+			testDB.ConvCol.UpdateByID(context.Background(), group.ID, bson.M{"$set": bson.M{"participants": filler}})
+
+			assert.Equal(t, http.StatusConflict, do(late.ID, http.MethodPost, "/invites/"+invite.Token+"/join", "").Code)
+
+			var stored models.GroupInvite
+			conversationService.inviteCollection().FindOne(context.Background(), bson.M{"_id": invite.ID}).Decode(&stored)
+			assert.Equal(t, 0, stored.Uses)
+		})
+
+		t.Run("Unknown token", func(t *testing.T) {
+			assert.Equal(t, http.StatusNotFound, do(late.ID, http.MethodGet, "/invites/nope", "").Code)
+		})
+	})
+}
+
+func TestGroupInviteIsUsable(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.True(t, (&models.GroupInvite{}).IsUsable(now))
+	assert.True(t, (&models.GroupInvite{ExpiresAt: &future, MaxUses: 2, Uses: 1}).IsUsable(now))
+	assert.False(t, (&models.GroupInvite{ExpiresAt: &past}).IsUsable(now))
+	assert.False(t, (&models.GroupInvite{MaxUses: 2, Uses: 2}).IsUsable(now))
+	assert.False(t, (&models.GroupInvite{RevokedAt: &past}).IsUsable(now))
+}
@@ -0,0 +1,184 @@
+package conversation
+
+import (
+	"errors"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errGroupChanged = errors.New("group changed while leaving")
+
+// leaveGroup removes the caller from a group. An owner who leaves hands the group
+// to the next admin, or to the longest standing member when there is none.
+func (s *ConversationService) leaveGroup(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	if conversation.IsChannel() {
+		utils.WriteError(w, http.StatusBadRequest, "Unsubscribe from a channel instead")
+		return
+	} else if !conversation.IsGroup() {
+		utils.WriteError(w, http.StatusBadRequest, "Only groups can be left, delete the chat instead")
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	actor, err := s.displayName(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	systemMessage := newSystemMessage(conversation, models.SystemEvent{
+		Type:    models.SystemEventMemberLeft,
+		ActorID: userIdObject,
+	}, actor, now)
+
+	admins := make([]primitive.ObjectID, 0, len(conversation.Admins))
+	for _, admin := range conversation.Admins {
+		if admin != userIdObject {
+			admins = append(admins, admin)
+		}
+	}
+
+	set := bson.M{"admins": admins, "updatedAt": now}
+	update := bson.M{
+		"$pull": bson.M{"participants": userIdObject},
+		"$push": bson.M{"messages": systemMessage.ID},
+	}
+
+	if conversation.OwnerID != nil && *conversation.OwnerID == userIdObject {
+		owner, found := nextOwner(conversation, admins, userIdObject)
+		if found {
+			set["ownerId"] = owner
+			if !conversation.IsAdmin(owner) {
+				set["admins"] = append(admins, owner)
+			}
+		} else {
+			update["$unset"] = bson.M{"ownerId": ""}
+		}
+	}
+	update["$set"] = set
+
+	var updated models.Conversation
+	err = s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := s.messageCollection.InsertOne(sc, systemMessage); err != nil {
+			return err
+		}
+
+		// The admins guard makes a concurrent change to the admins retry instead of being overwritten
+		err := s.conversationCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": conversation.ID, "participants": userIdObject, "admins": conversation.Admins},
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return errGroupChanged
+		} else if err != nil {
+			return err
+		}
+
+		filter := bson.M{"userId": userIdObject, "conversationId": conversation.ID}
+		if _, err := s.settingsCollection().DeleteOne(sc, filter); err != nil {
+			return err
+		}
+		_, err = s.draftCollection().DeleteOne(sc, filter)
+		return err
+	})
+	if err == errGroupChanged {
+		utils.WriteError(w, http.StatusConflict, "The group changed, try again")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishSystemMessage(&updated, systemMessage)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Left group",
+		Status:  http.StatusOK,
+		Data:    updated.ID,
+	})
+}
+
+// nextOwner picks who inherits a group from leaving: the first remaining admin,
+// otherwise the member who joined earliest.
+func nextOwner(conversation *models.Conversation, admins []primitive.ObjectID, leaving primitive.ObjectID) (primitive.ObjectID, bool) {
+	if len(admins) > 0 {
+		return admins[0], true
+	}
+	for _, participant := range conversation.Participants {
+		if participant != leaving {
+			return participant, true
+		}
+	}
+	return primitive.NilObjectID, false
+}
+
+// clearConversation deletes a direct conversation for the caller only. History up
+// to now is hidden from them and the chat drops out of their list until the next
+// message arrives.
+func (s *ConversationService) clearConversation(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	if conversation.Type != "" {
+		utils.WriteError(w, http.StatusBadRequest, "Only direct chats can be deleted, leave the group instead")
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	filter := bson.M{"userId": userIdObject, "conversationId": conversation.ID}
+
+	now := time.Now()
+	var settings models.ConversationSettings
+	err := s.settingsCollection().FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": bson.M{
+			"clearedAt": now,
+			"archived":  false,
+			"pinned":    false,
+			"pinOrder":  0,
+			"updatedAt": now,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&settings)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := s.draftCollection().DeleteOne(ctx, filter); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishSettings(r, settings)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Chat deleted",
+		Status:  http.StatusOK,
+		Data:    settings,
+	})
+}
@@ -0,0 +1,209 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_LeaveGroup(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Group Owner")
+		member1, _ := testDB.CreateTestUser("member1@example.com", "member1", "Member One")
+		member2, _ := testDB.CreateTestUser("member2@example.com", "member2", "Member Two")
+		dm, _ := testDB.CreateTestConversation([]primitive.ObjectID{owner.ID, member1.ID}, nil)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/groups", conversationService.createGroup).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/leave", conversationService.leaveGroup).Methods(http.MethodPost)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		load := func(id primitive.ObjectID) models.Conversation {
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": id}).Decode(&conversation)
+			return conversation
+		}
+
+		var group struct {
+			Data models.ConversationDetail `json:"data"`
+		}
+		w := do(owner.ID, http.MethodPost, "/groups", `{"name": "Trip", "memberIds": ["`+member1.ID.Hex()+`", "`+member2.ID.Hex()+`"]}`)
+		json.Unmarshal(w.Body.Bytes(), &group)
+		leavePath := "/" + group.Data.ID.Hex() + "/leave"
+
+		t.Run("Direct chats can't be left", func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, do(owner.ID, http.MethodPost, "/"+dm.ID.Hex()+"/leave", "").Code)
+		})
+
+		t.Run("A member leaves", func(t *testing.T) {
+			w := do(member2.ID, http.MethodPost, leavePath, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			conversation := load(group.Data.ID)
+			assert.Equal(t, []primitive.ObjectID{owner.ID, member1.ID}, conversation.Participants)
+			assert.Equal(t, owner.ID, *conversation.OwnerID)
+
+			events := recorder.Events("upcoming-message")
+			message := events[len(events)-1].Data.(models.Message)
+			assert.Equal(t, models.SystemEventMemberLeft, message.System.Type)
+			assert.Equal(t, "Member Two left", message.Message)
+
+			// Gone means gone
+			assert.Equal(t, http.StatusForbidden, do(member2.ID, http.MethodPost, leavePath, "").Code)
+		})
+
+		t.Run("The owner hands the group on when leaving", func(t *testing.T) {
+			w := do(owner.ID, http.MethodPost, leavePath, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			conversation := load(group.Data.ID)
+			assert.Equal(t, []primitive.ObjectID{member1.ID}, conversation.Participants)
+			assert.Equal(t, member1.ID, *conversation.OwnerID)
+			assert.Equal(t, []primitive.ObjectID{member1.ID}, conversation.Admins)
+		})
+
+		t.Run("The last member leaves an ownerless group", func(t *testing.T) {
+			w := do(member1.ID, http.MethodPost, leavePath, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			conversation := load(group.Data.ID)
+			assert.Empty(t, conversation.Participants)
+			assert.Nil(t, conversation.OwnerID)
+		})
+	})
+}
+
+func TestConversationService_ClearConversation(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		_, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		old, _ := testDB.CreateTestMessage(user2.ID, user1.ID, "before")
+		conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, []primitive.ObjectID{old.ID})
+		testDB.MsgCol.UpdateOne(context.Background(), bson.M{"_id": old.ID}, bson.M{"$set": bson.M{"conversationId": conv.ID}})
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", conversationService.getConversation).Methods(http.MethodGet)
+		router.HandleFunc("/groups", conversationService.createGroup).Methods(http.MethodPost)
+		router.HandleFunc("/{id}", conversationService.getConversationDetails).Methods(http.MethodGet)
+		router.HandleFunc("/{id}", conversationService.clearConversation).Methods(http.MethodDelete)
+		router.HandleFunc("/{id}/messages", conversationService.listMessages).Methods(http.MethodGet)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		list := func(userID primitive.ObjectID) []models.ConversationWithSingleParticipant {
+			var response struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			json.Unmarshal(do(userID, http.MethodGet, "/", "").Body.Bytes(), &response)
+			return response.Data.Results
+		}
+		history := func(userID primitive.ObjectID) []models.Message {
+			var response struct {
+				Data models.ConversationMessagesResponse `json:"data"`
+			}
+			json.Unmarshal(do(userID, http.MethodGet, "/"+conv.ID.Hex()+"/messages", "").Body.Bytes(), &response)
+			return response.Data.Results
+		}
+
+		t.Run("Groups are left, not deleted", func(t *testing.T) {
+			var group struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(do(user1.ID, http.MethodPost, "/groups", `{"name": "Trip"}`).Body.Bytes(), &group)
+
+			assert.Equal(t, http.StatusBadRequest, do(user1.ID, http.MethodDelete, "/"+group.Data.ID.Hex(), "").Code)
+		})
+
+		t.Run("Deleting hides the chat and its history for the caller only", func(t *testing.T) {
+			assert.Len(t, list(user1.ID), 2)
+
+			w := do(user1.ID, http.MethodDelete, "/"+conv.ID.Hex(), "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			for _, conversation := range list(user1.ID) {
+				assert.NotEqual(t, conv.ID, conversation.ID)
+			}
+			assert.Empty(t, history(user1.ID))
+
+			var detail struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(do(user1.ID, http.MethodGet, "/"+conv.ID.Hex(), "").Body.Bytes(), &detail)
+			assert.Equal(t, int64(0), detail.Data.UnreadCount)
+
+			assert.Len(t, list(user2.ID), 1)
+			assert.Len(t, history(user2.ID), 1)
+		})
+
+		t.Run("A new message brings the chat back without the old history", func(t *testing.T) {
+			time.Sleep(5 * time.Millisecond)
+			now := time.Now()
+			message := models.Message{
+				ID:             primitive.NewObjectID(),
+				ConversationID: conv.ID,
+				SenderID:       user2.ID,
+				ReceiverID:     user1.ID,
+				Message:        "after",
+				Kind:           models.MessageKindUser,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			testDB.MsgCol.InsertOne(context.Background(), message)
+			testDB.ConvCol.UpdateByID(context.Background(), conv.ID, bson.M{
+				"$push": bson.M{"messages": message.ID},
+				"$set":  bson.M{"updatedAt": now},
+			})
+
+			var found *models.ConversationWithSingleParticipant
+			for _, conversation := range list(user1.ID) {
+				if conversation.ID == conv.ID {
+					found = &conversation
+				}
+			}
+			if assert.NotNil(t, found) {
+				assert.Equal(t, "after", found.LastMessage.Snippet)
+				assert.Equal(t, int64(1), found.UnreadCount)
+			}
+
+			messages := history(user1.ID)
+			assert.Len(t, messages, 1)
+			assert.Equal(t, message.ID, messages[0].ID)
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package conversation
+
+import (
+	"lite-chat-go/models"
+	"lite-chat-go/systemmessage"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// listMessages pages through a conversation newest first. Unlike /messages/list it
+// works for groups and channels, where subscribers read without being participants.
+func (s *ConversationService) listMessages(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+	params := r.URL.Query()
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	settings, err := s.findSettings(ctx, userIdObject, conversation.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filter := bson.M{"conversationId": conversation.ID}
+	if settings.ClearedAt != nil {
+		filter["createdAt"] = bson.M{"$gt": settings.ClearedAt}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := s.messageCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]models.Message, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := systemmessage.Render(ctx, s.userCollection(), results); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := false
+	if len(results) > limit {
+		results = results[:limit]
+		hasMore = true
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.ConversationMessagesResponse{
+			Results: results,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
@@ -0,0 +1,266 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxPinnedMessages = 5
+
+func (s *ConversationService) listPins(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	pins := make([]models.PinnedMessageDetail, 0, len(conversation.Pinned))
+	if len(conversation.Pinned) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(conversation.Pinned))
+		for _, pin := range conversation.Pinned {
+			ids = append(ids, pin.MessageID)
+		}
+
+		cursor, err := s.messageCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		var messages []models.Message
+		if err := cursor.All(ctx, &messages); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		byId := make(map[primitive.ObjectID]models.Message, len(messages))
+		for _, m := range messages {
+			byId[m.ID] = m
+		}
+
+		// Most recently pinned first
+		for i := len(conversation.Pinned) - 1; i >= 0; i-- {
+			pin := conversation.Pinned[i]
+			if m, ok := byId[pin.MessageID]; ok {
+				pins = append(pins, models.PinnedMessageDetail{PinnedMessage: pin, Message: m})
+			}
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    pins,
+	})
+}
+
+func (s *ConversationService) pinMessage(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.PinMessagePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messageIdObject, err := primitive.ObjectIDFromHex(payload.MessageID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Message ID not valid")
+		return
+	}
+
+	conversation, ok := s.posterConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	count, err := s.messageCollection.CountDocuments(ctx, bson.M{"_id": messageIdObject, "conversationId": conversation.ID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	pin := models.PinnedMessage{MessageID: messageIdObject, PinnedBy: userIdObject, PinnedAt: time.Now()}
+
+	// Guarding on the array in the filter keeps the limit and uniqueness atomic
+	filter := bson.M{
+		"_id":                      conversation.ID,
+		"pinnedMessages.messageId": bson.M{"$ne": messageIdObject},
+		fmt.Sprintf("pinnedMessages.%d", maxPinnedMessages-1): bson.M{"$exists": false},
+	}
+
+	var updated models.Conversation
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = s.conversationCollection.FindOneAndUpdate(ctx, filter, bson.M{"$push": bson.M{"pinnedMessages": pin}}, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		for _, p := range conversation.Pinned {
+			if p.MessageID == messageIdObject {
+				utils.WriteError(w, http.StatusConflict, "Message is already pinned")
+				return
+			}
+		}
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("A conversation can have at most %d pinned messages", maxPinnedMessages))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishPin(updated, messageIdObject, userIdObject, true)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Message pinned",
+		Status:  http.StatusOK,
+		Data:    updated.Pinned,
+	})
+}
+
+func (s *ConversationService) unpinMessage(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	messageIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["messageId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Message ID not valid")
+		return
+	}
+
+	conversation, ok := s.posterConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	var updated models.Conversation
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = s.conversationCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": conversation.ID, "pinnedMessages.messageId": messageIdObject},
+		bson.M{"$pull": bson.M{"pinnedMessages": bson.M{"messageId": messageIdObject}}},
+		opts,
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Message is not pinned")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishPin(updated, messageIdObject, userIdObject, false)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Message unpinned",
+		Status:  http.StatusOK,
+		Data:    updated.Pinned,
+	})
+}
+
+// participantConversation loads the {id} conversation, writing 404 when it doesn't exist
+// in the caller's workspace and 403 when the caller is not in it. Channel subscribers
+// count as in it.
+func (s *ConversationService) participantConversation(w http.ResponseWriter, r *http.Request) (*models.Conversation, bool) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return nil, false
+	}
+
+	conversationIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+		return nil, false
+	}
+
+	var conversation models.Conversation
+	err = s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": conversationIdObject})).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return nil, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	member, err := s.isMember(ctx, &conversation, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	if !member {
+		utils.WriteError(w, http.StatusForbidden, "You are not a participant of this conversation")
+		return nil, false
+	}
+
+	return &conversation, true
+}
+
+// posterConversation is participantConversation for changes only posters may
+// make, which leaves channel subscribers out.
+func (s *ConversationService) posterConversation(w http.ResponseWriter, r *http.Request) (*models.Conversation, bool) {
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(r.Context().Value(types.ContextKeyUserID).(string))
+	if !conversation.CanPost(userIdObject) {
+		utils.WriteError(w, http.StatusForbidden, "Only channel admins can do this")
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+func publishPin(conversation models.Conversation, messageId primitive.ObjectID, userId primitive.ObjectID, pinned bool) {
+	eventName := "message-unpinned"
+	if pinned {
+		eventName = "message-pinned"
+	}
+
+	event := models.PinEvent{
+		ConversationID: conversation.ID,
+		MessageID:      messageId,
+		UserID:         userId,
+		Pinned:         pinned,
+	}
+
+	if conversation.IsChannel() {
+		realtime.Publish(realtime.ConversationChannel(conversation.ID.Hex()), eventName, event)
+		return
+	}
+
+	for _, participant := range conversation.Participants {
+		realtime.Publish(realtime.UserChannel(participant.Hex()), eventName, event)
+	}
+}
@@ -0,0 +1,125 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_Pins(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		var messageIDs []primitive.ObjectID
+		for i := 0; i < 7; i++ {
+			msg, _ := testDB.CreateTestMessage(user1.ID, user2.ID, fmt.Sprintf("Message %d", i))
+			messageIDs = append(messageIDs, msg.ID)
+		}
+		conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, messageIDs)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/{id}/pins", conversationService.listPins).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/pins", conversationService.pinMessage).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/pins/{messageId}", conversationService.unpinMessage).Methods(http.MethodDelete)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/"+conv.ID.Hex()+path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		pin := func(userID, messageID primitive.ObjectID) *httptest.ResponseRecorder {
+			return do(userID, http.MethodPost, "/pins", `{"messageId": "`+messageID.Hex()+`"}`)
+		}
+
+		t.Run("Participant pins a message", func(t *testing.T) {
+			w := pin(user1.ID, messageIDs[0])
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": conv.ID}).Decode(&conversation)
+			assert.Len(t, conversation.Pinned, 1)
+			assert.Equal(t, messageIDs[0], conversation.Pinned[0].MessageID)
+			assert.Equal(t, user1.ID, conversation.Pinned[0].PinnedBy)
+
+			events := recorder.Events("message-pinned")
+			assert.Len(t, events, 2)
+			assert.Equal(t, realtime.UserChannel(user2.ID.Hex()), events[1].Channel)
+		})
+
+		t.Run("Pinning twice conflicts", func(t *testing.T) {
+			w := pin(user2.ID, messageIDs[0])
+
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+
+		t.Run("Pin limit is enforced", func(t *testing.T) {
+			for i := 1; i < 5; i++ {
+				assert.Equal(t, http.StatusOK, pin(user1.ID, messageIDs[i]).Code)
+			}
+
+			w := pin(user1.ID, messageIDs[5])
+
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+
+		t.Run("Listing returns most recent pin first", func(t *testing.T) {
+			w := do(user2.ID, http.MethodGet, "/pins", "")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			data := response["data"].([]interface{})
+			assert.Len(t, data, 5)
+			assert.Equal(t, messageIDs[4].Hex(), data[0].(map[string]interface{})["messageId"])
+		})
+
+		t.Run("Unpin", func(t *testing.T) {
+			w := do(user2.ID, http.MethodDelete, "/pins/"+messageIDs[0].Hex(), "")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			w = do(user2.ID, http.MethodDelete, "/pins/"+messageIDs[0].Hex(), "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Message from another conversation", func(t *testing.T) {
+			other, _ := testDB.CreateTestMessage(user3.ID, user2.ID, "Elsewhere")
+
+			w := pin(user1.ID, other.ID)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Non participant", func(t *testing.T) {
+			w := do(user3.ID, http.MethodGet, "/pins", "")
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	})
+}
@@ -1,29 +1,155 @@
 package conversation
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"lite-chat-go/models"
+	"lite-chat-go/tenant"
 	"lite-chat-go/types"
 	"lite-chat-go/utils"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	draftPreviewLength       = 100
+	lastMessageSnippetLength = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
 type ConversationService struct {
 	conversationCollection *mongo.Collection
+	messageCollection      *mongo.Collection
 }
 
-func NewConversationService(conversationCollection *mongo.Collection) *ConversationService {
+func NewConversationService(conversationCollection *mongo.Collection, messageCollection *mongo.Collection) *ConversationService {
 	return &ConversationService{
 		conversationCollection: conversationCollection,
+		messageCollection:      messageCollection,
+	}
+}
+
+// DirectPairIndex keeps two users from ending up with more than one direct
+// conversation in a workspace when both open it at the same time.
+func DirectPairIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{{Key: "workspaceId", Value: 1}, {Key: "pairKey", Value: 1}},
+		Options: options.Index().
+			SetName("workspaceId_pairKey_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"pairKey": bson.M{"$exists": true}}),
+	}
+}
+
+func (s *ConversationService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.draftCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "conversationId", Value: 1}},
+		Options: options.Index().SetName("userId_conversationId").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conversationCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "participants", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("participants_updatedAt"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.conversationCollection.Indexes().CreateOne(ctx, DirectPairIndex()); err != nil {
+		return err
+	}
+
+	_, err = s.settingsCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "conversationId", Value: 1}},
+			Options: options.Index().SetName("userId_conversationId").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "conversationId", Value: 1}},
+			Options: options.Index().SetName("conversationId"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.inviteCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().SetName("token").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "conversationId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("conversationId_createdAt"),
+		},
+	})
+	if err != nil {
+		return err
 	}
+
+	_, err = s.conversationCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "type", Value: 1}, {Key: "public", Value: 1}, {Key: "subscriberCount", Value: -1}},
+		Options: options.Index().SetName("type_public_subscriberCount").SetPartialFilterExpression(bson.M{"type": models.ConversationTypeChannel}),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.subscriptionCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "channelId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetName("channelId_userId").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetName("userId"),
+		},
+	})
+
+	return err
 }
 
 func (s *ConversationService) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("", utils.WithJwtAuth(s.getConversation)).Methods(http.MethodGet)
+	router.HandleFunc("", utils.WithJwtAuth(s.createConversation)).Methods(http.MethodPost)
+	router.HandleFunc("/groups", utils.WithJwtAuth(s.createGroup)).Methods(http.MethodPost)
+	router.HandleFunc("/channels", utils.WithJwtAuth(s.searchChannels)).Methods(http.MethodGet)
+	router.HandleFunc("/channels", utils.WithJwtAuth(s.createChannel)).Methods(http.MethodPost)
+	router.HandleFunc("/pinned", utils.WithJwtAuth(s.reorderPinned)).Methods(http.MethodPut)
+	router.HandleFunc("/{id}", utils.WithJwtAuth(s.getConversationDetails)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}", utils.WithJwtAuth(s.clearConversation)).Methods(http.MethodDelete)
+	router.HandleFunc("/{id}/leave", utils.WithJwtAuth(s.leaveGroup)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/name", utils.WithJwtAuth(s.renameConversation)).Methods(http.MethodPut)
+	router.HandleFunc("/{id}/timer", utils.WithJwtAuth(s.setMessageTimer)).Methods(http.MethodPut)
+	router.HandleFunc("/{id}/messages", utils.WithJwtAuth(s.listMessages)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/pins", utils.WithJwtAuth(s.listPins)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/pins", utils.WithJwtAuth(s.pinMessage)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/pins/{messageId}", utils.WithJwtAuth(s.unpinMessage)).Methods(http.MethodDelete)
+	router.HandleFunc("/{id}/draft", utils.WithJwtAuth(s.getDraft)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/draft", utils.WithJwtAuth(s.putDraft)).Methods(http.MethodPut)
+	router.HandleFunc("/{id}/draft", utils.WithJwtAuth(s.deleteDraft)).Methods(http.MethodDelete)
+	router.HandleFunc("/{id}/settings", utils.WithJwtAuth(s.getSettings)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/settings", utils.WithJwtAuth(s.updateSettings)).Methods(http.MethodPatch)
+	router.HandleFunc("/{id}/subscribe", utils.WithJwtAuth(s.subscribeChannel)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/subscribe", utils.WithJwtAuth(s.unsubscribeChannel)).Methods(http.MethodDelete)
+	router.HandleFunc("/{id}/invites", utils.WithJwtAuth(s.listInvites)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/invites", utils.WithJwtAuth(s.createInvite)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/invites/{inviteId}", utils.WithJwtAuth(s.revokeInvite)).Methods(http.MethodDelete)
 }
 
 func (s *ConversationService) getConversation(w http.ResponseWriter, r *http.Request) {
@@ -32,12 +158,154 @@ func (s *ConversationService) getConversation(w http.ResponseWriter, r *http.Req
 	userIdObject, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch User id object")
+		return
+	}
+
+	query := r.URL.Query()
+
+	_, limit, err := utils.ParsePagination("", query.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Archived conversations are listed separately from the active ones
+	archived := false
+	if value := query.Get("archived"); value != "" {
+		archived, err = strconv.ParseBool(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "archived must be true or false")
+			return
+		}
+	}
+
+	membership, err := s.membershipFilter(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	match := bson.M{"$and": bson.A{membership, tenant.Filter(ctx)}}
+
+	if value := query.Get("cursor"); value != "" {
+		updatedAt, id, err := decodeListCursor(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Cursor not valid")
+			return
+		}
+		match["$and"] = append(match["$and"].(bson.A), bson.M{"$or": bson.A{
+			bson.M{"updatedAt": bson.M{"$lt": updatedAt}},
+			bson.M{"updatedAt": updatedAt, "_id": bson.M{"$lt": id}},
+		}})
+	}
+
+	settingsFilter := bson.M{"settings.archived": true}
+	if !archived {
+		settingsFilter = bson.M{"settings.archived": bson.M{"$ne": true}, "settings.pinned": bson.M{"$ne": true}}
+	}
+
+	// One extra row tells us whether there is another page
+	conversations, err := s.listConversations(ctx, userIdObject, match, settingsFilter, limit+1)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := models.ConversationListResponse{Results: conversations}
+	if len(conversations) > limit {
+		response.Results = conversations[:limit]
+		response.HasMore = true
+		last := response.Results[limit-1]
+		response.NextCursor = encodeListCursor(last.UpdatedAt, last.ID)
+	}
+
+	// Pinned conversations sit on top of the first page and are left out of the pages after it
+	if !archived && query.Get("cursor") == "" {
+		pinned, err := s.pinnedConversations(ctx, userIdObject)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(pinned) > 0 {
+			response.Results = append(pinned, response.Results...)
+		}
+	}
+
+	utils.WriteJSON(
+		w,
+		http.StatusOK,
+		types.CustomSuccessResponse{
+			Message: "Success",
+			Status:  http.StatusOK,
+			Success: true,
+			Data:    response,
+		},
+	)
+}
+
+func (s *ConversationService) pinnedConversations(ctx context.Context, userId primitive.ObjectID) ([]models.ConversationWithSingleParticipant, error) {
+	pinned, err := s.pinnedSettings(ctx, userId)
+	if err != nil {
+		return nil, err
 	}
+	if len(pinned) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(pinned))
+	for _, setting := range pinned {
+		ids = append(ids, setting.ConversationID)
+	}
+
+	membership, err := s.membershipFilter(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	match := bson.M{"$and": bson.A{membership, tenant.Filter(ctx), bson.M{"_id": bson.M{"$in": ids}}}}
+	conversations, err := s.listConversations(ctx, userId, match, bson.M{"settings.pinned": true}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].Settings.PinOrder < conversations[j].Settings.PinOrder
+	})
+
+	return conversations, nil
+}
 
+// listConversations walks the user's conversations newest activity first. The
+// per-user settings are joined before limit so filtering on them stays
+// index-ordered, everything else is only looked up for the rows returned.
+func (s *ConversationService) listConversations(ctx context.Context, userId primitive.ObjectID, match bson.M, settingsFilter bson.M, limit int) ([]models.ConversationWithSingleParticipant, error) {
 	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from": "conversation_settings",
+			"let":  bson.M{"conversationId": "$_id"},
+			"pipeline": mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.M{
+					"$expr":  bson.M{"$eq": []interface{}{"$conversationId", "$$conversationId"}},
+					"userId": userId,
+				}}},
+			},
+			"as": "settings",
+		}}},
+		bson.D{{Key: "$set", Value: bson.M{
+			"settings": bson.M{"$first": "$settings"},
+		}}},
+		bson.D{{Key: "$match", Value: settingsFilter}},
+		// A chat deleted for this user stays hidden until something newer arrives
 		bson.D{{Key: "$match", Value: bson.M{
-			"participants": bson.M{"$in": []primitive.ObjectID{userIdObject}},
+			"$expr": bson.M{"$lt": []interface{}{"$settings.clearedAt", "$updatedAt"}},
 		}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	pipeline = append(pipeline,
 		bson.D{{Key: "$lookup", Value: bson.M{
 			"from":         "users",
 			"localField":   "participants",
@@ -50,7 +318,7 @@ func (s *ConversationService) getConversation(w http.ResponseWriter, r *http.Req
 					"input": "$participants",
 					"as":    "participant",
 					"cond": bson.M{
-						"$ne": []interface{}{"$$participant._id", userIdObject},
+						"$ne": []interface{}{"$$participant._id", userId},
 					},
 				},
 			},
@@ -59,37 +327,209 @@ func (s *ConversationService) getConversation(w http.ResponseWriter, r *http.Req
 			"participants": bson.M{"$first": "$participants"},
 		}}},
 		bson.D{{Key: "$lookup", Value: bson.M{
-			"from":         "messages",
-			"localField":   "messages",
-			"foreignField": "_id",
-			"as":           "messages",
+			"from": "messages",
+			"let":  bson.M{"conversationId": "$_id", "clearedAt": "$settings.clearedAt"},
+			"pipeline": mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.M{
+					"$expr": bson.M{"$and": bson.A{
+						bson.M{"$eq": []interface{}{"$conversationId", "$$conversationId"}},
+						bson.M{"$gt": []interface{}{"$createdAt", "$$clearedAt"}},
+					}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.M{"createdAt": -1}}},
+				bson.D{{Key: "$limit", Value: 1}},
+				bson.D{{Key: "$project", Value: bson.M{
+					"senderId": 1,
+					"snippet": bson.M{"$substrCP": []interface{}{
+						bson.M{"$ifNull": []interface{}{"$plainText", "$message"}}, 0, lastMessageSnippetLength,
+					}},
+					"type":      1,
+					"kind":      1,
+					"status":    1,
+					"createdAt": 1,
+				}}},
+			},
+			"as": "lastMessage",
+		}}},
+		// Direct messages are flagged read one by one, group members have a read position
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from": "messages",
+			"let": bson.M{
+				"conversationId": "$_id",
+				"clearedAt":      "$settings.clearedAt",
+				"lastReadAt":     "$settings.lastReadAt",
+				"type":           "$type",
+			},
+			"pipeline": mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.M{
+					"$expr": bson.M{"$and": bson.A{
+						bson.M{"$eq": []interface{}{"$conversationId", "$$conversationId"}},
+						bson.M{"$gt": []interface{}{"$createdAt", "$$clearedAt"}},
+					}},
+					"$or": bson.A{
+						bson.M{"receiverId": userId, "isRead": false},
+						bson.M{
+							"senderId": bson.M{"$ne": userId},
+							"$expr": bson.M{"$and": bson.A{
+								bson.M{"$eq": []interface{}{"$$type", models.ConversationTypeGroup}},
+								bson.M{"$gt": []interface{}{"$createdAt", "$$lastReadAt"}},
+							}},
+						},
+					},
+					"kind": bson.M{"$ne": models.MessageKindSystem},
+				}}},
+				bson.D{{Key: "$count", Value: "count"}},
+			},
+			"as": "unread",
+		}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from": "drafts",
+			"let":  bson.M{"conversationId": "$_id"},
+			"pipeline": mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.M{
+					"$expr":  bson.M{"$eq": []interface{}{"$conversationId", "$$conversationId"}},
+					"userId": userId,
+				}}},
+				bson.D{{Key: "$project", Value: bson.M{
+					"_id":       0,
+					"text":      bson.M{"$substrCP": []interface{}{"$text", 0, draftPreviewLength}},
+					"updatedAt": 1,
+				}}},
+			},
+			"as": "draft",
 		}}},
 		bson.D{{Key: "$project", Value: bson.M{
-			"messages":     bson.M{"$slice": []interface{}{"$messages", -1}},
+			"type":         1,
+			"name":         1,
 			"participants": 1,
+			"lastMessage":  bson.M{"$first": "$lastMessage"},
+			"unreadCount":  bson.M{"$ifNull": []interface{}{bson.M{"$first": "$unread.count"}, 0}},
+			"draft":        bson.M{"$first": "$draft"},
+			"settings":     1,
+			"createdAt":    1,
+			"updatedAt":    1,
 		}}},
-	}
+	)
 
 	cursor, err := s.conversationCollection.Aggregate(ctx, pipeline)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
-		return
+		return nil, err
 	}
 
-	conversations :=  make([]models.ConversationWithSingleParticipant, 0)
+	conversations := make([]models.ConversationWithSingleParticipant, 0)
 	if err := cursor.All(ctx, &conversations); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, err
+	}
+
+	return conversations, nil
+}
+
+// List cursors are the last row's activity time and id, so rows sharing a
+// timestamp are neither skipped nor repeated.
+func encodeListCursor(updatedAt time.Time, id primitive.ObjectID) string {
+	raw := strconv.FormatInt(updatedAt.UnixMilli(), 10) + "_" + id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeListCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+
+	millis, hex, found := strings.Cut(string(raw), "_")
+	if !found {
+		return time.Time{}, primitive.NilObjectID, errInvalidCursor
+	}
+
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+
+	return time.UnixMilli(ms), id, nil
+}
+
+func (s *ConversationService) setMessageTimer(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
 		return
 	}
 
-	utils.WriteJSON(
-		w,
-		http.StatusOK,
-		types.CustomSuccessResponse{
+	var payload models.ConversationTimerPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversation, ok := s.posterConversation(w, r)
+	if !ok {
+		return
+	}
+
+	seconds := *payload.Seconds
+	if seconds == conversation.MessageTimer {
+		utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+			Success: true,
 			Message: "Success",
 			Status:  http.StatusOK,
-			Success: true,
-			Data:    conversations,
-		},
-	)
+			Data:    conversation,
+		})
+		return
+	}
+
+	actor, err := s.displayName(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	systemMessage := newSystemMessage(conversation, models.SystemEvent{
+		Type:    models.SystemEventTimerChanged,
+		ActorID: userIdObject,
+		Timer:   &seconds,
+	}, actor, now)
+
+	if _, err := s.messageCollection.InsertOne(ctx, systemMessage); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	update := bson.M{
+		"$set":  bson.M{"messageTimer": seconds, "updatedAt": now},
+		"$push": bson.M{"messages": systemMessage.ID},
+	}
+	if seconds == 0 {
+		update["$set"] = bson.M{"updatedAt": now}
+		update["$unset"] = bson.M{"messageTimer": ""}
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := s.conversationCollection.FindOneAndUpdate(ctx, bson.M{"_id": conversation.ID}, update, opts).Decode(conversation); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishSystemMessage(conversation, systemMessage)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    conversation,
+	})
 }
@@ -1,20 +1,28 @@
 package conversation
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
 	"lite-chat-go/types"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestConversationService_GetConversation(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
-		conversationService := NewConversationService(testDB.ConvCol)
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
 
 		// Create test users
 		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
@@ -57,7 +65,7 @@ func TestConversationService_GetConversation(t *testing.T) {
 			assert.True(t, response.Success)
 			assert.Equal(t, "Success", response.Message)
 
-			conversations := response.Data.([]interface{})
+			conversations := response.Data.(map[string]interface{})["results"].([]interface{})
 			assert.Len(t, conversations, 2) // user1 has 2 conversations
 
 			// Verify conversation structure
@@ -94,7 +102,7 @@ func TestConversationService_GetConversation(t *testing.T) {
 
 			assert.True(t, response.Success)
 
-			conversations := response.Data.([]interface{})
+			conversations := response.Data.(map[string]interface{})["results"].([]interface{})
 			assert.Len(t, conversations, 0) // No conversations
 		})
 
@@ -129,7 +137,7 @@ func TestConversationService_GetConversation(t *testing.T) {
 
 			assert.True(t, response.Success)
 
-			conversations := response.Data.([]interface{})
+			conversations := response.Data.(map[string]interface{})["results"].([]interface{})
 			assert.Len(t, conversations, 1) // user2 has only 1 conversation (with user1)
 
 			conv := conversations[0].(map[string]interface{})
@@ -140,7 +148,7 @@ func TestConversationService_GetConversation(t *testing.T) {
 			assert.Equal(t, user1.Username, participant["username"])
 		})
 
-		t.Run("Verify messages are included", func(t *testing.T) {
+		t.Run("Verify last message preview is included", func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/conversations", nil)
 
 			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
@@ -156,21 +164,18 @@ func TestConversationService_GetConversation(t *testing.T) {
 			err := json.Unmarshal(w.Body.Bytes(), &response)
 			assert.NoError(t, err)
 
-			conversations := response.Data.([]interface{})
+			conversations := response.Data.(map[string]interface{})["results"].([]interface{})
 			assert.True(t, len(conversations) > 0)
 
-			// Check if conversations have messages
 			for _, convInterface := range conversations {
 				conv := convInterface.(map[string]interface{})
-				messages := conv["messages"].([]interface{})
-
-				// Each conversation should have at least one message (last message)
-				if len(messages) > 0 {
-					msg := messages[0].(map[string]interface{})
-					assert.Contains(t, msg, "_id")
-					assert.Contains(t, msg, "senderId")
-					assert.Contains(t, msg, "receiverId")
-					assert.Contains(t, msg, "message")
+				assert.NotContains(t, conv, "messages")
+
+				if lastMessage, ok := conv["lastMessage"].(map[string]interface{}); ok {
+					assert.Contains(t, lastMessage, "_id")
+					assert.Contains(t, lastMessage, "senderId")
+					assert.Contains(t, lastMessage, "snippet")
+					assert.Contains(t, lastMessage, "createdAt")
 				}
 			}
 		})
@@ -201,7 +206,7 @@ func TestConversationService_GetConversation(t *testing.T) {
 			assert.True(t, response.Success)
 			assert.Equal(t, "Success", response.Message)
 
-			conversations := response.Data.([]interface{})
+			conversations := response.Data.(map[string]interface{})["results"].([]interface{})
 			assert.Len(t, conversations, 0)
 		})
 	})
@@ -209,7 +214,7 @@ func TestConversationService_GetConversation(t *testing.T) {
 
 func TestConversationService_RegisterRoutes(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
-		conversationService := NewConversationService(testDB.ConvCol)
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
 
 		t.Run("Verify routes are registered", func(t *testing.T) {
 			// This test ensures the RegisterRoutes method works without panicking
@@ -225,17 +230,230 @@ func TestConversationService_RegisterRoutes(t *testing.T) {
 func TestNewConversationService(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
 		t.Run("Create new conversation service", func(t *testing.T) {
-			service := NewConversationService(testDB.ConvCol)
+			service := NewConversationService(testDB.ConvCol, testDB.MsgCol)
 
 			assert.NotNil(t, service)
 			assert.Equal(t, testDB.ConvCol, service.conversationCollection)
+			assert.Equal(t, testDB.MsgCol, service.messageCollection)
 		})
 
 		t.Run("Create service with nil collection", func(t *testing.T) {
-			service := NewConversationService(nil)
+			service := NewConversationService(nil, nil)
 
 			assert.NotNil(t, service)
 			assert.Nil(t, service.conversationCollection)
+			assert.Nil(t, service.messageCollection)
 		})
 	})
 }
+
+func TestConversationService_UnreadCount(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		message1, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Hello")
+		message2, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Are you there?")
+		message3, _ := testDB.CreateTestMessage(user2.ID, user1.ID, "Yes")
+
+		testDB.CreateTestConversation(
+			[]primitive.ObjectID{user1.ID, user2.ID},
+			[]primitive.ObjectID{message1.ID, message2.ID, message3.ID},
+		)
+
+		unreadFor := func(userID primitive.ObjectID) float64 {
+			req := httptest.NewRequest(http.MethodGet, "/conversations", nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			conversationService.getConversation(w, req)
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			conversations := response.Data.(map[string]interface{})["results"].([]interface{})
+			assert.Len(t, conversations, 1)
+			return conversations[0].(map[string]interface{})["unreadCount"].(float64)
+		}
+
+		assert.Equal(t, float64(2), unreadFor(user2.ID))
+		assert.Equal(t, float64(1), unreadFor(user1.ID))
+	})
+}
+
+func TestConversationService_SetMessageTimer(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		_, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+		conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, nil)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/{id}/timer", conversationService.setMessageTimer).Methods(http.MethodPut)
+
+		setTimer := func(userID primitive.ObjectID, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/"+conv.ID.Hex()+"/timer", bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		t.Run("Participant sets the timer and a system message is recorded", func(t *testing.T) {
+			w := setTimer(user1.ID, `{"seconds": 86400}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": conv.ID}).Decode(&conversation)
+			assert.Equal(t, int64(86400), conversation.MessageTimer)
+			assert.Len(t, conversation.Messages, 1)
+
+			var systemMessage models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": conversation.Messages[0]}).Decode(&systemMessage)
+			assert.Equal(t, models.MessageKindSystem, systemMessage.Kind)
+			assert.Equal(t, models.SystemEventTimerChanged, systemMessage.System.Type)
+			assert.Equal(t, user1.ID, systemMessage.System.ActorID)
+			assert.Equal(t, "User One set disappearing messages to 1 day", systemMessage.Message)
+		})
+
+		t.Run("Turning the timer off", func(t *testing.T) {
+			w := setTimer(user2.ID, `{"seconds": 0}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": conv.ID}).Decode(&conversation)
+			assert.Equal(t, int64(0), conversation.MessageTimer)
+			assert.Len(t, conversation.Messages, 2)
+
+			var systemMessage models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": conversation.Messages[1]}).Decode(&systemMessage)
+			assert.Equal(t, "User Two turned off disappearing messages", systemMessage.Message)
+		})
+
+		t.Run("Unsupported duration", func(t *testing.T) {
+			w := setTimer(user1.ID, `{"seconds": 42}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Non participant", func(t *testing.T) {
+			w := setTimer(user3.ID, `{"seconds": 3600}`)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	})
+}
+
+func TestConversationService_ListPagination(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+
+		// Two conversations share a timestamp to exercise the id tiebreak
+		base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+		offsets := []time.Duration{5, 4, 3, 3, 1}
+		expected := make([]primitive.ObjectID, 0, len(offsets))
+		var newest *models.User
+		for i, offset := range offsets {
+			other, _ := testDB.CreateTestUser(fmt.Sprintf("other%d@example.com", i), fmt.Sprintf("other%d", i), "Other")
+			conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, other.ID}, nil)
+			testDB.ConvCol.UpdateByID(context.Background(), conv.ID, bson.M{"$set": bson.M{"updatedAt": base.Add(offset * time.Minute)}})
+			expected = append(expected, conv.ID)
+			if i == 0 {
+				newest = other
+			}
+		}
+		// Same updatedAt sorts by _id descending, and the later insert has the larger id
+		expected[2], expected[3] = expected[3], expected[2]
+
+		message, _ := testDB.CreateTestMessage(newest.ID, user1.ID, "**Newest** message in the list")
+		testDB.MsgCol.UpdateByID(context.Background(), message.ID, bson.M{"$set": bson.M{"conversationId": expected[0], "plainText": "Newest message in the list"}})
+
+		fetch := func(query string) (int, models.ConversationListResponse) {
+			req := httptest.NewRequest(http.MethodGet, "/conversations"+query, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			conversationService.getConversation(w, req)
+
+			var response struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return w.Code, response.Data
+		}
+
+		t.Run("Pages follow the most recent activity", func(t *testing.T) {
+			var seen []primitive.ObjectID
+			query := "?limit=2"
+			for pages := 0; pages < 5; pages++ {
+				code, page := fetch(query)
+				assert.Equal(t, http.StatusOK, code)
+				for _, conversation := range page.Results {
+					seen = append(seen, conversation.ID)
+				}
+				if !page.HasMore {
+					assert.Empty(t, page.NextCursor)
+					break
+				}
+				query = "?limit=2&cursor=" + page.NextCursor
+			}
+
+			assert.Equal(t, expected, seen)
+		})
+
+		t.Run("Last message preview", func(t *testing.T) {
+			_, page := fetch("?limit=1")
+
+			assert.Len(t, page.Results, 1)
+			lastMessage := page.Results[0].LastMessage
+			assert.NotNil(t, lastMessage)
+			assert.Equal(t, message.ID, lastMessage.ID)
+			assert.Equal(t, "Newest message in the list", lastMessage.Snippet)
+			assert.Equal(t, models.MessageStatusSent, lastMessage.Status)
+
+			_, page = fetch("?limit=1&cursor=" + page.NextCursor)
+			assert.Nil(t, page.Results[0].LastMessage)
+		})
+
+		t.Run("Invalid cursor", func(t *testing.T) {
+			code, _ := fetch("?cursor=not-a-cursor")
+
+			assert.Equal(t, http.StatusBadRequest, code)
+		})
+
+		t.Run("Invalid limit", func(t *testing.T) {
+			code, _ := fetch("?limit=500")
+
+			assert.Equal(t, http.StatusBadRequest, code)
+		})
+	})
+}
+
+func TestListCursor(t *testing.T) {
+	updatedAt := time.UnixMilli(1700000000123)
+	id := primitive.NewObjectID()
+
+	decodedAt, decodedId, err := decodeListCursor(encodeListCursor(updatedAt, id))
+
+	assert.NoError(t, err)
+	assert.True(t, updatedAt.Equal(decodedAt))
+	assert.Equal(t, id, decodedId)
+
+	_, _, err = decodeListCursor("bm9wZQ")
+	assert.Error(t, err)
+}
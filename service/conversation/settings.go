@@ -0,0 +1,335 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errTooManyPinned = errors.New("too many pinned conversations")
+
+func (s *ConversationService) settingsCollection() *mongo.Collection {
+	return s.conversationCollection.Database().Collection("conversation_settings")
+}
+
+// pinLockCollection holds one document per user that every pin writes, so
+// concurrent pins of the same user conflict instead of all passing the limit.
+func (s *ConversationService) pinLockCollection() *mongo.Collection {
+	return s.conversationCollection.Database().Collection("conversation_pin_locks")
+}
+
+// findSettings returns the user's settings for a conversation, or defaults when none are stored.
+func (s *ConversationService) findSettings(ctx context.Context, userId primitive.ObjectID, conversationId primitive.ObjectID) (models.ConversationSettings, error) {
+	settings := models.ConversationSettings{UserID: userId, ConversationID: conversationId}
+	err := s.settingsCollection().FindOne(ctx, bson.M{"userId": userId, "conversationId": conversationId}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return settings, nil
+	}
+
+	return settings, err
+}
+
+func (s *ConversationService) getSettings(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	settings, err := s.findSettings(ctx, userIdObject, conversation.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    settings,
+	})
+}
+
+func (s *ConversationService) updateSettings(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.ConversationSettingsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if payload.Muted == nil && payload.MutedUntil == nil && payload.Archived == nil && payload.Pinned == nil {
+		utils.WriteError(w, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+
+	now := time.Now()
+	if payload.MutedUntil != nil && !payload.MutedUntil.After(now) {
+		utils.WriteError(w, http.StatusBadRequest, "mutedUntil must be in the future")
+		return
+	}
+
+	if payload.Muted != nil && !*payload.Muted && payload.MutedUntil != nil {
+		utils.WriteError(w, http.StatusBadRequest, "mutedUntil can't be set when unmuting")
+		return
+	}
+
+	if payload.Archived != nil && *payload.Archived && payload.Pinned != nil && *payload.Pinned {
+		utils.WriteError(w, http.StatusBadRequest, "An archived conversation can't be pinned")
+		return
+	}
+
+	conversation, ok := s.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	settings, err := s.findSettings(ctx, userIdObject, conversation.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if payload.Muted != nil {
+		settings.Muted = *payload.Muted
+		settings.MutedUntil = nil
+	}
+	if payload.MutedUntil != nil {
+		// A mute without an end time lasts until the user unmutes
+		settings.Muted = true
+		settings.MutedUntil = payload.MutedUntil
+	}
+
+	if payload.Archived != nil {
+		settings.Archived = *payload.Archived
+		if settings.Archived {
+			settings.Pinned = false
+			settings.PinOrder = 0
+		}
+	}
+
+	pinning := false
+	if payload.Pinned != nil && *payload.Pinned != settings.Pinned {
+		if *payload.Pinned {
+			if settings.Archived {
+				utils.WriteError(w, http.StatusBadRequest, "An archived conversation can't be pinned")
+				return
+			}
+			pinning = true
+		} else {
+			settings.Pinned = false
+			settings.PinOrder = 0
+		}
+	}
+
+	settings.UpdatedAt = now
+
+	// A pin checks the limit and writes in one transaction
+	err = s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if pinning {
+			order, err := s.nextPinOrder(sc, userIdObject)
+			if err != nil {
+				return err
+			}
+			settings.Pinned = true
+			settings.PinOrder = order
+		}
+
+		return s.settingsCollection().FindOneAndUpdate(sc,
+			bson.M{"userId": userIdObject, "conversationId": conversation.ID},
+			bson.M{"$set": bson.M{
+				"muted":      settings.Muted,
+				"mutedUntil": settings.MutedUntil,
+				"archived":   settings.Archived,
+				"pinned":     settings.Pinned,
+				"pinOrder":   settings.PinOrder,
+				"updatedAt":  settings.UpdatedAt,
+			}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&settings)
+	})
+	if err == errTooManyPinned {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("At most %d conversations can be pinned", models.MaxPinnedConversations))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	publishSettings(r, settings)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Settings updated",
+		Status:  http.StatusOK,
+		Data:    settings,
+	})
+}
+
+// nextPinOrder places a newly pinned conversation after the ones already pinned.
+// Run it in a transaction: taking the user's pin lock makes a concurrent pin
+// conflict and retry, so it counts this one.
+func (s *ConversationService) nextPinOrder(ctx context.Context, userId primitive.ObjectID) (int, error) {
+	_, err := s.pinLockCollection().UpdateOne(ctx,
+		bson.M{"_id": userId},
+		bson.M{"$inc": bson.M{"pins": 1}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	pinned, err := s.pinnedSettings(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(pinned) >= models.MaxPinnedConversations {
+		return 0, errTooManyPinned
+	}
+
+	order := 0
+	for _, setting := range pinned {
+		if setting.PinOrder > order {
+			order = setting.PinOrder
+		}
+	}
+
+	return order + 1, nil
+}
+
+// pinnedSettings lists the user's pins in the request's workspace, ordered. Each
+// workspace has its own pins and its own limit.
+func (s *ConversationService) pinnedSettings(ctx context.Context, userId primitive.ObjectID) ([]models.ConversationSettings, error) {
+	cursor, err := s.settingsCollection().Find(ctx,
+		bson.M{"userId": userId, "pinned": true},
+		options.Find().SetSort(bson.D{{Key: "pinOrder", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var pinned []models.ConversationSettings
+	if err := cursor.All(ctx, &pinned); err != nil {
+		return nil, err
+	}
+	if len(pinned) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(pinned))
+	for _, setting := range pinned {
+		ids = append(ids, setting.ConversationID)
+	}
+
+	inWorkspace, err := s.conversationCollection.Distinct(ctx, "_id", tenant.Scope(ctx, bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[primitive.ObjectID]bool, len(inWorkspace))
+	for _, id := range inWorkspace {
+		if id, ok := id.(primitive.ObjectID); ok {
+			keep[id] = true
+		}
+	}
+
+	scoped := pinned[:0]
+	for _, setting := range pinned {
+		if keep[setting.ConversationID] {
+			scoped = append(scoped, setting)
+		}
+	}
+	return scoped, nil
+}
+
+// reorderPinned takes the full list of pinned conversations in their new order.
+func (s *ConversationService) reorderPinned(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.PinnedConversationsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	pinned, err := s.pinnedSettings(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	isPinned := make(map[primitive.ObjectID]bool, len(pinned))
+	for _, setting := range pinned {
+		isPinned[setting.ConversationID] = true
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(payload.ConversationIDs))
+	writes := make([]mongo.WriteModel, 0, len(payload.ConversationIDs))
+	for i, id := range payload.ConversationIDs {
+		conversationId, err := primitive.ObjectIDFromHex(id)
+		if err != nil || !isPinned[conversationId] || seen[conversationId] {
+			utils.WriteError(w, http.StatusBadRequest, "Conversation IDs must list every pinned conversation once")
+			return
+		}
+		seen[conversationId] = true
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"userId": userIdObject, "conversationId": conversationId}).
+			SetUpdate(bson.M{"$set": bson.M{"pinOrder": i + 1}}))
+	}
+
+	if len(seen) != len(isPinned) {
+		utils.WriteError(w, http.StatusBadRequest, "Conversation IDs must list every pinned conversation once")
+		return
+	}
+
+	if len(writes) > 0 {
+		if _, err := s.settingsCollection().BulkWrite(ctx, writes); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Pinned conversations reordered",
+		Status:  http.StatusOK,
+		Data:    payload.ConversationIDs,
+	})
+}
+
+func publishSettings(r *http.Request, settings models.ConversationSettings) {
+	userId := r.Context().Value(types.ContextKeyUserID).(string)
+	realtime.PublishExcept(realtime.UserChannel(userId), "conversation-settings-updated", settings, r.Header.Get(socketIdHeader))
+}
@@ -0,0 +1,220 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_Settings(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+		user4, _ := testDB.CreateTestUser("user4@example.com", "user4", "User Four")
+		conv12, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, nil)
+		conv13, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user3.ID}, nil)
+		conv14, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user4.ID}, nil)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", conversationService.getConversation).Methods(http.MethodGet)
+		router.HandleFunc("/pinned", conversationService.reorderPinned).Methods(http.MethodPut)
+		router.HandleFunc("/{id}/settings", conversationService.getSettings).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/settings", conversationService.updateSettings).Methods(http.MethodPatch)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		settingsPath := func(conv *models.Conversation) string {
+			return "/" + conv.ID.Hex() + "/settings"
+		}
+		list := func(userID primitive.ObjectID, query string) []models.ConversationWithSingleParticipant {
+			var response struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			w := do(userID, http.MethodGet, query, "")
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data.Results
+		}
+
+		t.Run("Defaults when nothing is stored", func(t *testing.T) {
+			w := do(user1.ID, http.MethodGet, settingsPath(conv12), "")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ConversationSettings `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.False(t, response.Data.Muted)
+			assert.False(t, response.Data.Archived)
+			assert.False(t, response.Data.Pinned)
+		})
+
+		t.Run("Mute until a time", func(t *testing.T) {
+			until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			w := do(user1.ID, http.MethodPatch, settingsPath(conv12), `{"mutedUntil": "`+until+`"}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ConversationSettings `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.True(t, response.Data.IsMuted(time.Now()))
+			assert.False(t, response.Data.IsMuted(time.Now().Add(2*time.Hour)))
+
+			events := recorder.Events("conversation-settings-updated")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user1.ID.Hex()), events[0].Channel)
+		})
+
+		t.Run("Settings are per user", func(t *testing.T) {
+			var response struct {
+				Data models.ConversationSettings `json:"data"`
+			}
+			w := do(user2.ID, http.MethodGet, settingsPath(conv12), "")
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.False(t, response.Data.Muted)
+		})
+
+		t.Run("Mute in the past is rejected", func(t *testing.T) {
+			until := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+			w := do(user1.ID, http.MethodPatch, settingsPath(conv12), `{"mutedUntil": "`+until+`"}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Pinned conversations are listed first in pin order", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPatch, settingsPath(conv14), `{"pinned": true}`).Code)
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPatch, settingsPath(conv13), `{"pinned": true}`).Code)
+
+			conversations := list(user1.ID, "/")
+			assert.Len(t, conversations, 3)
+			assert.Equal(t, conv14.ID, conversations[0].ID)
+			assert.Equal(t, conv13.ID, conversations[1].ID)
+			assert.Equal(t, conv12.ID, conversations[2].ID)
+		})
+
+		t.Run("Reorder pinned conversations", func(t *testing.T) {
+			body := `{"conversationIds": ["` + conv13.ID.Hex() + `", "` + conv14.ID.Hex() + `"]}`
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPut, "/pinned", body).Code)
+
+			conversations := list(user1.ID, "/")
+			assert.Equal(t, conv13.ID, conversations[0].ID)
+			assert.Equal(t, conv14.ID, conversations[1].ID)
+		})
+
+		t.Run("Reorder must list every pinned conversation", func(t *testing.T) {
+			body := `{"conversationIds": ["` + conv13.ID.Hex() + `"]}`
+			assert.Equal(t, http.StatusBadRequest, do(user1.ID, http.MethodPut, "/pinned", body).Code)
+
+			body = `{"conversationIds": ["` + conv13.ID.Hex() + `", "` + conv12.ID.Hex() + `"]}`
+			assert.Equal(t, http.StatusBadRequest, do(user1.ID, http.MethodPut, "/pinned", body).Code)
+		})
+
+		t.Run("Archiving moves the conversation out of the active list", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPatch, settingsPath(conv14), `{"archived": true}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ConversationSettings `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.False(t, response.Data.Pinned)
+
+			active := list(user1.ID, "/")
+			assert.Len(t, active, 2)
+			for _, conversation := range active {
+				assert.NotEqual(t, conv14.ID, conversation.ID)
+			}
+
+			archived := list(user1.ID, "/?archived=true")
+			assert.Len(t, archived, 1)
+			assert.Equal(t, conv14.ID, archived[0].ID)
+
+			// The other participant still sees it as active
+			assert.Len(t, list(user4.ID, "/"), 1)
+		})
+
+		t.Run("Archived conversation can't be pinned", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPatch, settingsPath(conv14), `{"pinned": true}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Invalid archived filter", func(t *testing.T) {
+			w := do(user1.ID, http.MethodGet, "/?archived=maybe", "")
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Empty update", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPatch, settingsPath(conv12), `{}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Concurrent pins stay within the limit", func(t *testing.T) {
+			pinner, _ := testDB.CreateTestUser("pinner@example.com", "pinner", "Pinner")
+
+			codes := make(chan int, models.MaxPinnedConversations+3)
+			var wg sync.WaitGroup
+			for i := 0; i < cap(codes); i++ {
+				conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{pinner.ID, user2.ID}, nil)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					codes <- do(pinner.ID, http.MethodPatch, settingsPath(conv), `{"pinned": true}`).Code
+				}()
+			}
+			wg.Wait()
+			close(codes)
+
+			pinned := 0
+			for code := range codes {
+				if code == http.StatusOK {
+					pinned++
+				} else {
+					assert.Equal(t, http.StatusConflict, code)
+				}
+			}
+			assert.Equal(t, models.MaxPinnedConversations, pinned)
+
+			count, _ := testDB.Database.Collection("conversation_settings").CountDocuments(context.Background(), bson.M{"userId": pinner.ID, "pinned": true})
+			assert.Equal(t, int64(models.MaxPinnedConversations), count)
+		})
+
+		t.Run("Non participant", func(t *testing.T) {
+			w := do(user3.ID, http.MethodPatch, settingsPath(conv12), `{"muted": true}`)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package conversation
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newSystemMessage records event in a conversation. The text is stored for
+// clients that don't read System, readers get it re-rendered by systemmessage.Render.
+func newSystemMessage(conversation *models.Conversation, event models.SystemEvent, actor string, now time.Time) models.Message {
+	return models.Message{
+		ID:             primitive.NewObjectID(),
+		ConversationID: conversation.ID,
+		WorkspaceID:    conversation.WorkspaceID,
+		SenderID:       event.ActorID,
+		Message:        event.Text(actor),
+		IsRead:         true,
+		Kind:           models.MessageKindSystem,
+		System:         &event,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+func publishSystemMessage(conversation *models.Conversation, message models.Message) {
+	if conversation.IsChannel() {
+		realtime.Publish(realtime.ConversationChannel(conversation.ID.Hex()), "upcoming-message", message)
+		return
+	}
+	for _, participant := range conversation.Participants {
+		realtime.Publish(realtime.UserChannel(participant.Hex()), "upcoming-message", message)
+	}
+}
+
+func (s *ConversationService) displayName(ctx context.Context, userId primitive.ObjectID) (string, error) {
+	var user models.UserPublic
+	if err := s.userCollection().FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+		return "", err
+	}
+	return user.Fullname, nil
+}
@@ -0,0 +1,144 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSystemEventText(t *testing.T) {
+	day := int64(86400)
+	off := int64(0)
+
+	tests := []struct {
+		event models.SystemEvent
+		actor string
+		want  string
+	}{
+		{models.SystemEvent{Type: models.SystemEventTimerChanged, Timer: &day}, "Ann", "Ann set disappearing messages to 1 day"},
+		{models.SystemEvent{Type: models.SystemEventTimerChanged, Timer: &off}, "Ann", "Ann turned off disappearing messages"},
+		{models.SystemEvent{Type: models.SystemEventGroupCreated, Name: "Trip"}, "Ann", `Group "Trip" created`},
+		{models.SystemEvent{Type: models.SystemEventMemberJoined}, "Ann", "Ann joined"},
+		{models.SystemEvent{Type: models.SystemEventMemberJoined, ViaInvite: true}, "Ann", "Ann joined using an invite link"},
+		{models.SystemEvent{Type: models.SystemEventMemberLeft}, "Ann", "Ann left"},
+		{models.SystemEvent{Type: models.SystemEventRenamed, Name: "Trip 2"}, "Ann", `Ann changed the name to "Trip 2"`},
+		{models.SystemEvent{Type: models.SystemEventCallMissed, CallType: "video"}, "Ann", "Missed video call from Ann"},
+		{models.SystemEvent{Type: models.SystemEventMemberLeft}, "", "Someone left"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.event.Type), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.event.Text(tt.actor))
+		})
+	}
+}
+
+func TestConversationService_SystemMessages(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Group Owner")
+		member, _ := testDB.CreateTestUser("member@example.com", "member", "Group Member")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/groups", conversationService.createGroup).Methods(http.MethodPost)
+		router.HandleFunc("/{id}", conversationService.getConversationDetails).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/name", conversationService.renameConversation).Methods(http.MethodPut)
+		router.HandleFunc("/{id}/messages", conversationService.listMessages).Methods(http.MethodGet)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		var group struct {
+			Data models.ConversationDetail `json:"data"`
+		}
+		w := do(owner.ID, http.MethodPost, "/groups", `{"name": "Trip", "memberIds": ["`+member.ID.Hex()+`"]}`)
+		json.Unmarshal(w.Body.Bytes(), &group)
+		groupPath := "/" + group.Data.ID.Hex()
+
+		t.Run("Only admins rename", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(member.ID, http.MethodPut, groupPath+"/name", `{"name": "Mine"}`).Code)
+		})
+
+		t.Run("Renaming records a system message", func(t *testing.T) {
+			before := len(recorder.Events("upcoming-message"))
+
+			w := do(owner.ID, http.MethodPut, groupPath+"/name", `{"name": " Trip 2 "}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, "Trip 2", response.Data.Name)
+
+			// One event per member on their own channel, nothing on the shared one
+			events := recorder.Events("upcoming-message")
+			assert.Len(t, events, before+2)
+			assert.ElementsMatch(t, []string{
+				realtime.UserChannel(owner.ID.Hex()),
+				realtime.UserChannel(member.ID.Hex()),
+			}, []string{events[before].Channel, events[before+1].Channel})
+			message := events[len(events)-1].Data.(models.Message)
+			assert.Equal(t, models.SystemEventRenamed, message.System.Type)
+			assert.Equal(t, "Trip", message.System.PreviousName)
+
+			// The same name again changes nothing
+			do(owner.ID, http.MethodPut, groupPath+"/name", `{"name": "Trip 2"}`)
+			assert.Len(t, recorder.Events("upcoming-message"), before+2)
+		})
+
+		t.Run("History renders system messages from their event", func(t *testing.T) {
+			// Stored wording drifts, readers still see the current rendering
+			now := time.Now()
+			legacy := newSystemMessage(&models.Conversation{ID: group.Data.ID}, models.SystemEvent{Type: models.SystemEventMemberLeft, ActorID: member.ID}, "", now)
+			legacy.Message = "member left the group"
+			legacy.ReceiverID = member.ID
+			legacy.IsRead = false
+			testDB.MsgCol.InsertOne(context.Background(), legacy)
+
+			w := do(member.ID, http.MethodGet, groupPath+"/messages", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ConversationMessagesResponse `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 3)
+			assert.Equal(t, "Group Member left", response.Data.Results[0].Message)
+			assert.Equal(t, `Group Owner changed the name to "Trip 2"`, response.Data.Results[1].Message)
+			assert.Equal(t, `Group "Trip" created`, response.Data.Results[2].Message)
+		})
+
+		t.Run("System messages never count as unread", func(t *testing.T) {
+			w := do(member.ID, http.MethodGet, groupPath, "")
+
+			var response struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, int64(0), response.Data.UnreadCount)
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConversationService_WorkspaceIsolation(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		conversationService := NewConversationService(testDB.ConvCol, testDB.MsgCol)
+		assert.NoError(t, conversationService.EnsureIndexes(context.Background()))
+
+		alice, _ := testDB.CreateTestUser("alice@example.com", "alice", "Alice")
+		bob, _ := testDB.CreateTestUser("bob@example.com", "bob", "Bob")
+		carol, _ := testDB.CreateTestUser("carol@example.com", "carol", "Carol")
+
+		// Alice and Bob share workspace A, Alice and Carol share workspace B
+		workspaceA, workspaceB := primitive.NewObjectID(), primitive.NewObjectID()
+		members := testDB.Database.Collection(tenant.MemberCollection)
+		for workspace, users := range map[primitive.ObjectID][]primitive.ObjectID{
+			workspaceA: {alice.ID, bob.ID},
+			workspaceB: {alice.ID, carol.ID},
+		} {
+			for _, id := range users {
+				members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspace, UserID: id})
+			}
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", conversationService.getConversation).Methods(http.MethodGet)
+		router.HandleFunc("/", conversationService.createConversation).Methods(http.MethodPost)
+		router.HandleFunc("/groups", conversationService.createGroup).Methods(http.MethodPost)
+		router.HandleFunc("/channels", conversationService.searchChannels).Methods(http.MethodGet)
+		router.HandleFunc("/channels", conversationService.createChannel).Methods(http.MethodPost)
+		router.HandleFunc("/{id}", conversationService.getConversationDetails).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/messages", conversationService.listMessages).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/subscribe", conversationService.subscribeChannel).Methods(http.MethodPost)
+
+		do := func(userID, workspaceID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			if !workspaceID.IsZero() {
+				ctx = context.WithValue(ctx, types.ContextKeyWorkspaceID, workspaceID.Hex())
+			}
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		decodeDetail := func(w *httptest.ResponseRecorder) models.ConversationDetail {
+			var response struct {
+				Data models.ConversationDetail `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data
+		}
+		list := func(userID, workspaceID primitive.ObjectID) []primitive.ObjectID {
+			var response struct {
+				Data models.ConversationListResponse `json:"data"`
+			}
+			json.Unmarshal(do(userID, workspaceID, http.MethodGet, "/", "").Body.Bytes(), &response)
+
+			ids := make([]primitive.ObjectID, 0, len(response.Data.Results))
+			for _, conversation := range response.Data.Results {
+				ids = append(ids, conversation.ID)
+			}
+			return ids
+		}
+
+		var direct, group, channel models.ConversationDetail
+
+		t.Run("Conversations are created inside the workspace", func(t *testing.T) {
+			w := do(alice.ID, workspaceA, http.MethodPost, "/", `{"userId": "`+bob.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			direct = decodeDetail(w)
+
+			w = do(alice.ID, workspaceA, http.MethodPost, "/groups", `{"name": "Team A", "memberIds": ["`+bob.ID.Hex()+`"]}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			group = decodeDetail(w)
+
+			w = do(alice.ID, workspaceA, http.MethodPost, "/channels", `{"name": "News A", "public": true}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			channel = decodeDetail(w)
+
+			var stored models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": direct.ID}).Decode(&stored)
+			assert.Equal(t, workspaceA, stored.WorkspaceID)
+		})
+
+		t.Run("Users outside the workspace can't be reached", func(t *testing.T) {
+			w := do(alice.ID, workspaceA, http.MethodPost, "/", `{"userId": "`+carol.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			w = do(alice.ID, workspaceA, http.MethodPost, "/groups", `{"name": "Mixed", "memberIds": ["`+carol.ID.Hex()+`"]}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Members of a named workspace only can't be reached from the default one", func(t *testing.T) {
+			dave, _ := testDB.CreateTestUser("dave@example.com", "dave", "Dave")
+			members.DeleteOne(context.Background(), bson.M{"workspaceId": bson.M{"$exists": false}, "userId": dave.ID})
+			members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspaceA, UserID: dave.ID})
+
+			w := do(carol.ID, primitive.NilObjectID, http.MethodPost, "/", `{"userId": "`+dave.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			w = do(carol.ID, primitive.NilObjectID, http.MethodPost, "/groups", `{"name": "Mixed", "memberIds": ["`+dave.ID.Hex()+`"]}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("The same pair gets a separate direct chat per workspace", func(t *testing.T) {
+			w := do(alice.ID, primitive.NilObjectID, http.MethodPost, "/", `{"userId": "`+bob.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.NotEqual(t, direct.ID, decodeDetail(w).ID)
+
+			w = do(alice.ID, workspaceA, http.MethodPost, "/", `{"userId": "`+bob.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, direct.ID, decodeDetail(w).ID)
+		})
+
+		t.Run("Lists only show the current workspace", func(t *testing.T) {
+			inA := list(alice.ID, workspaceA)
+			assert.ElementsMatch(t, []primitive.ObjectID{direct.ID, group.ID, channel.ID}, inA)
+
+			for _, id := range list(alice.ID, workspaceB) {
+				assert.NotContains(t, inA, id)
+			}
+			for _, id := range list(alice.ID, primitive.NilObjectID) {
+				assert.NotContains(t, inA, id)
+			}
+		})
+
+		t.Run("Conversations of another workspace are not found", func(t *testing.T) {
+			for _, id := range []primitive.ObjectID{direct.ID, group.ID, channel.ID} {
+				assert.Equal(t, http.StatusNotFound, do(alice.ID, workspaceB, http.MethodGet, "/"+id.Hex(), "").Code)
+				assert.Equal(t, http.StatusNotFound, do(alice.ID, workspaceB, http.MethodGet, "/"+id.Hex()+"/messages", "").Code)
+			}
+			assert.Equal(t, http.StatusOK, do(alice.ID, workspaceA, http.MethodGet, "/"+group.ID.Hex(), "").Code)
+		})
+
+		t.Run("The channel directory stays inside the workspace", func(t *testing.T) {
+			directory := func(userID, workspaceID primitive.ObjectID) []models.ChannelSummary {
+				var response struct {
+					Data models.ChannelDirectoryResponse `json:"data"`
+				}
+				json.Unmarshal(do(userID, workspaceID, http.MethodGet, "/channels?q=news", "").Body.Bytes(), &response)
+				return response.Data.Results
+			}
+
+			assert.Len(t, directory(bob.ID, workspaceA), 1)
+			assert.Empty(t, directory(carol.ID, workspaceB))
+			assert.Empty(t, directory(carol.ID, primitive.NilObjectID))
+
+			w := do(carol.ID, workspaceB, http.MethodPost, "/"+channel.ID.Hex()+"/subscribe", "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	})
+}
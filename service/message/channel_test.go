@@ -0,0 +1,85 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageService_SendToChannel(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Channel Owner")
+		reader, _ := testDB.CreateTestUser("reader@example.com", "reader", "Channel Reader")
+
+		now := time.Now()
+		channel := models.Conversation{
+			ID:           primitive.NewObjectID(),
+			Type:         models.ConversationTypeChannel,
+			Name:         "Announcements",
+			OwnerID:      &owner.ID,
+			Admins:       []primitive.ObjectID{owner.ID},
+			Participants: []primitive.ObjectID{owner.ID},
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		testDB.ConvCol.InsertOne(context.Background(), channel)
+
+		send := func(userID primitive.ObjectID, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.sendMessage(w, req)
+			return w
+		}
+
+		t.Run("Admins post to the channel's realtime channel", func(t *testing.T) {
+			w := send(owner.ID, `{"conversationId": "`+channel.ID.Hex()+`", "message": "Hello subscribers"}`)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			events := recorder.Events("upcoming-message")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.ConversationChannel(channel.ID.Hex()), events[0].Channel)
+		})
+
+		t.Run("Subscribers can't post", func(t *testing.T) {
+			w := send(reader.ID, `{"conversationId": "`+channel.ID.Hex()+`", "message": "Hi"}`)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Unknown conversation", func(t *testing.T) {
+			w := send(owner.ID, `{"conversationId": "`+primitive.NewObjectID().Hex()+`", "message": "Hi"}`)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Scheduling needs a user", func(t *testing.T) {
+			w := send(owner.ID, `{"conversationId": "`+channel.ID.Hex()+`", "message": "Later", "scheduledAt": "`+now.Add(time.Hour).Format(time.RFC3339)+`"}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Neither user nor conversation", func(t *testing.T) {
+			w := send(owner.ID, `{"message": "Hi"}`)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageService_ClearedChat(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+
+		ctx := context.Background()
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		before, _, err := messageService.SendMessage(ctx, user2.ID, user1.ID, "@user1 standup notes", "")
+		assert.NoError(t, err)
+
+		clearedAt := time.Now()
+		messageService.settingsCollection().InsertOne(ctx, models.ConversationSettings{
+			UserID:         user1.ID,
+			ConversationID: before.ConversationID,
+			ClearedAt:      &clearedAt,
+		})
+		time.Sleep(5 * time.Millisecond)
+
+		after, _, err := messageService.SendMessage(ctx, user2.ID, user1.ID, "@user1 standup moved", "")
+		assert.NoError(t, err)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/list/{receiver_id}", messageService.getMessage).Methods(http.MethodGet)
+		router.HandleFunc("/unread-count", messageService.unreadCount).Methods(http.MethodGet)
+		router.HandleFunc("/search", messageService.searchMessage).Methods(http.MethodGet)
+		router.HandleFunc("/mentions", messageService.listMentions).Methods(http.MethodGet)
+
+		get := func(userID primitive.ObjectID, path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex()))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		t.Run("History before clearing is hidden from the user who cleared it", func(t *testing.T) {
+			var mine struct {
+				Data []models.Message `json:"data"`
+			}
+			json.Unmarshal(get(user1.ID, "/list/"+user2.ID.Hex()).Body.Bytes(), &mine)
+			assert.Len(t, mine.Data, 1)
+			assert.Equal(t, after.ID, mine.Data[0].ID)
+
+			var theirs struct {
+				Data []models.Message `json:"data"`
+			}
+			json.Unmarshal(get(user2.ID, "/list/"+user1.ID.Hex()).Body.Bytes(), &theirs)
+			assert.Len(t, theirs.Data, 2)
+		})
+
+		t.Run("Hidden messages don't count as unread", func(t *testing.T) {
+			var response struct {
+				Data models.UnreadCount `json:"data"`
+			}
+			json.Unmarshal(get(user1.ID, "/unread-count").Body.Bytes(), &response)
+			assert.Equal(t, int64(1), response.Data.Total)
+		})
+
+		t.Run("Hidden messages are left out of search and mentions", func(t *testing.T) {
+			var found struct {
+				Data struct {
+					Results []struct {
+						Message models.Message `json:"message"`
+					} `json:"results"`
+				} `json:"data"`
+			}
+			json.Unmarshal(get(user1.ID, "/search?q=standup").Body.Bytes(), &found)
+			assert.Len(t, found.Data.Results, 1)
+			assert.Equal(t, after.ID, found.Data.Results[0].Message.ID)
+
+			var mentions struct {
+				Data struct {
+					Results []models.Message `json:"results"`
+				} `json:"data"`
+			}
+			json.Unmarshal(get(user1.ID, "/mentions").Body.Bytes(), &mentions)
+			assert.Len(t, mentions.Data.Results, 1)
+			assert.Equal(t, after.ID, mentions.Data.Results[0].ID)
+		})
+	})
+}
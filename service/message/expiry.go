@@ -0,0 +1,104 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const expiryBatchSize = 500
+
+// RunExpirySweeper removes disappearing messages every interval until ctx is done.
+func (s *MessageService) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.SweepExpired(ctx); err != nil {
+				log.Printf("failed to sweep expired messages: %v", err)
+			}
+		}
+	}
+}
+
+// SweepExpired deletes messages past their expiresAt, detaches them from their
+// conversation and tells the participants so previews can be refreshed.
+func (s *MessageService) SweepExpired(ctx context.Context) (int64, error) {
+	var removed int64
+
+	for {
+		opts := options.Find().
+			SetProjection(bson.M{"conversationId": 1}).
+			SetLimit(expiryBatchSize)
+
+		cursor, err := s.messageCollection.Find(ctx, bson.M{"expiresAt": bson.M{"$lte": time.Now()}}, opts)
+		if err != nil {
+			return removed, err
+		}
+
+		var expired []models.Message
+		if err := cursor.All(ctx, &expired); err != nil {
+			return removed, err
+		}
+
+		if len(expired) == 0 {
+			return removed, nil
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(expired))
+		byConversation := make(map[primitive.ObjectID][]primitive.ObjectID)
+		for _, m := range expired {
+			ids = append(ids, m.ID)
+			byConversation[m.ConversationID] = append(byConversation[m.ConversationID], m.ID)
+		}
+
+		result, err := s.messageCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return removed, err
+		}
+		removed += result.DeletedCount
+
+		for conversationId, messageIds := range byConversation {
+			if err := s.detachExpired(ctx, conversationId, messageIds); err != nil {
+				return removed, err
+			}
+		}
+
+		if len(expired) < expiryBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+func (s *MessageService) detachExpired(ctx context.Context, conversationId primitive.ObjectID, messageIds []primitive.ObjectID) error {
+	var conversation models.Conversation
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.conversationCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": conversationId},
+		bson.M{"$pull": bson.M{
+			"messages":       bson.M{"$in": messageIds},
+			"pinnedMessages": bson.M{"messageId": bson.M{"$in": messageIds}},
+		}},
+		opts,
+	).Decode(&conversation)
+	if err != nil {
+		return err
+	}
+
+	event := models.MessagesExpired{ConversationID: conversationId, MessageIDs: messageIds}
+	for _, participant := range conversation.Participants {
+		realtime.Publish(realtime.UserChannel(participant.Hex()), "messages-expired", event)
+	}
+
+	return nil
+}
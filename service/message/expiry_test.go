@@ -0,0 +1,63 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageService_DisappearingMessages(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		kept, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Before the timer")
+		conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, []primitive.ObjectID{kept.ID})
+		testDB.ConvCol.UpdateByID(context.Background(), conv.ID, bson.M{"$set": bson.M{"messageTimer": 3600}})
+
+		t.Run("Messages sent while the timer is active expire", func(t *testing.T) {
+			sent, _, err := messageService.SendMessage(context.Background(), user1.ID, user2.ID, "Vanishing", "")
+			assert.NoError(t, err)
+			assert.NotNil(t, sent.ExpiresAt)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), *sent.ExpiresAt, time.Minute)
+		})
+
+		t.Run("Sweeper removes expired messages and updates the conversation", func(t *testing.T) {
+			testDB.MsgCol.UpdateMany(context.Background(),
+				bson.M{"expiresAt": bson.M{"$exists": true}},
+				bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)}},
+			)
+
+			removed, err := messageService.SweepExpired(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), removed)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": conv.ID}).Decode(&conversation)
+			assert.Equal(t, []primitive.ObjectID{kept.ID}, conversation.Messages)
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{})
+			assert.Equal(t, int64(1), count)
+
+			events := recorder.Events("messages-expired")
+			assert.Len(t, events, 2)
+		})
+
+		t.Run("Nothing to sweep", func(t *testing.T) {
+			removed, err := messageService.SweepExpired(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), removed)
+		})
+	})
+}
@@ -0,0 +1,233 @@
+package message
+
+import (
+	"encoding/json"
+	"lite-chat-go/blocking"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MessageService) forwardMessage(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.ForwardMessagePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messageIds, err := parseObjectIDs(payload.MessageIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Message ID not valid")
+		return
+	}
+
+	conversationIds, err := parseObjectIDs(payload.ConversationIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+		return
+	}
+
+	// Everything is checked up front so a bad id doesn't leave a half-forwarded batch
+	cursor, err := s.messageCollection.Find(ctx, bson.M{"_id": bson.M{"$in": messageIds}})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var originals []models.Message
+	if err := cursor.All(ctx, &originals); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sourceConversationIds := make([]primitive.ObjectID, 0, len(originals))
+	for _, original := range originals {
+		if original.Kind == models.MessageKindSystem {
+			utils.WriteError(w, http.StatusBadRequest, "System messages cannot be forwarded")
+			return
+		}
+		sourceConversationIds = append(sourceConversationIds, original.ConversationID)
+	}
+
+	readableFilter, err := membership.Filter(ctx, s.conversationCollection.Database(), userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	readableFilter["_id"] = bson.M{"$in": sourceConversationIds}
+
+	readable, err := s.conversationCollection.CountDocuments(ctx, tenant.Scope(ctx, readableFilter))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(originals) != countDistinct(messageIds) || readable != int64(countDistinct(sourceConversationIds)) {
+		utils.WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	// Targets are direct conversations and groups the caller is in, and channels they post in
+	cursor, err = s.conversationCollection.Find(ctx, tenant.Scope(ctx, bson.M{
+		"_id":          bson.M{"$in": conversationIds},
+		"participants": userIdObject,
+	}))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var targets []models.Conversation
+	if err := cursor.All(ctx, &targets); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(targets) != countDistinct(conversationIds) {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	// Posting rights and blocks are checked here too so one target doesn't stop the batch halfway
+	for _, target := range targets {
+		if !target.CanPost(userIdObject) {
+			utils.WriteError(w, http.StatusForbidden, "You can't post in this conversation")
+			return
+		}
+		if target.Type != "" {
+			continue
+		}
+
+		receiverId, _ := otherParticipant(target, userIdObject)
+		blocked, err := blocking.Between(ctx, s.messageCollection.Database(), userIdObject, receiverId)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		} else if blocked {
+			utils.WriteError(w, http.StatusForbidden, "You can't message this user")
+			return
+		}
+	}
+
+	// Keep the original reading order in every target
+	sort.Slice(originals, func(i, j int) bool {
+		return originals[i].CreatedAt.Before(originals[j].CreatedAt)
+	})
+
+	forwarded := make([]models.Message, 0, len(originals)*len(targets))
+	for _, target := range targets {
+		for _, original := range originals {
+			draft := forwardCopy(original, payload.HideOrigin)
+			draft.SenderID = userIdObject
+			draft.ConversationID = target.ID
+
+			message, _, err := s.send(ctx, draft)
+			if err == ErrUserNotFound {
+				utils.WriteError(w, http.StatusNotFound, "User not found")
+				return
+			} else if err == ErrInvalidReceiver {
+				utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
+				return
+			} else if err == ErrBlocked {
+				utils.WriteError(w, http.StatusForbidden, "You can't message this user")
+				return
+			} else if err == ErrConversationNotFound {
+				utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+				return
+			} else if err == ErrCannotPost {
+				utils.WriteError(w, http.StatusForbidden, "You can't post in this conversation")
+				return
+			} else if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			forwarded = append(forwarded, *message)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    forwarded,
+	})
+}
+
+// forwardCopy keeps the content of original and drops everything tied to its
+// delivery. A copy of a copy still points at the first message it came from.
+func forwardCopy(original models.Message, hideOrigin bool) models.Message {
+	draft := original
+	draft.ConversationID = primitive.NilObjectID
+	draft.ReceiverID = primitive.NilObjectID
+	draft.ClientMessageID = ""
+	draft.Forwarded = true
+	draft.ForwardedFrom = nil
+
+	if !hideOrigin {
+		if original.ForwardedFrom != nil {
+			origin := *original.ForwardedFrom
+			draft.ForwardedFrom = &origin
+		} else {
+			draft.ForwardedFrom = &models.ForwardOrigin{
+				MessageID:      original.ID,
+				ConversationID: original.ConversationID,
+				SenderID:       original.SenderID,
+			}
+		}
+	}
+
+	return draft
+}
+
+func otherParticipant(conversation models.Conversation, userId primitive.ObjectID) (primitive.ObjectID, bool) {
+	for _, participant := range conversation.Participants {
+		if participant != userId {
+			return participant, true
+		}
+	}
+
+	return primitive.NilObjectID, false
+}
+
+func parseObjectIDs(values []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func countDistinct(ids []primitive.ObjectID) int {
+	seen := make(map[primitive.ObjectID]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+
+	return len(seen)
+}
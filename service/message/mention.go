@@ -0,0 +1,242 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/richtext"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxMentionsPerMessage = 20
+	mentionPreviewLength  = 100
+)
+
+// A mention starts at the beginning of the text or after a character that
+// cannot be part of a username, so emails like a@b.com are not matched.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9._@-])@([A-Za-z0-9._-]{1,64})`)
+
+type mentionToken struct {
+	Username string
+	Offset   int
+	Length   int
+}
+
+// parseMentions finds @username tokens in text. Offsets are UTF-16 based.
+func parseMentions(text string) []mentionToken {
+	var tokens []mentionToken
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		// Trailing dots are sentence punctuation, not part of the name
+		for end > start && text[end-1] == '.' {
+			end--
+		}
+		if end == start {
+			continue
+		}
+
+		username := text[start:end]
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+
+		// Include the @ sign in the entity span
+		at := start - 1
+		tokens = append(tokens, mentionToken{
+			Username: username,
+			Offset:   richtext.UTF16Len(text[:at]),
+			Length:   richtext.UTF16Len(text[at:end]),
+		})
+
+		if len(tokens) == maxMentionsPerMessage {
+			break
+		}
+	}
+
+	return tokens
+}
+
+// resolveMentions keeps only the tokens that name a user of the conversation's
+// workspace who can read it: a participant, or anyone in the case of channels.
+func (s *MessageService) resolveMentions(ctx context.Context, text string, conversation *models.Conversation) ([]models.Mention, error) {
+	tokens := parseMentions(text)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	usernames := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		usernames = append(usernames, token.Username)
+	}
+
+	filter := bson.M{"username": bson.M{"$in": usernames}}
+	if !conversation.IsChannel() {
+		filter["_id"] = bson.M{"$in": conversation.Participants}
+	}
+
+	members, err := tenant.UserFilter(ctx, s.userCollection.Database())
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.userCollection.Find(ctx,
+		bson.M{"$and": bson.A{filter, members}},
+		options.Find().SetProjection(bson.M{"_id": 1, "username": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	byUsername := make(map[string]primitive.ObjectID, len(users))
+	for _, user := range users {
+		byUsername[user.Username] = user.ID
+	}
+
+	var mentions []models.Mention
+	for _, token := range tokens {
+		if userId, ok := byUsername[token.Username]; ok {
+			mentions = append(mentions, models.Mention{
+				UserID:   userId,
+				Username: token.Username,
+				Offset:   token.Offset,
+				Length:   token.Length,
+			})
+		}
+	}
+
+	return mentions, nil
+}
+
+// publishMentions notifies mentioned participants. Mentions are delivered even
+// when the conversation is muted, see notifyRecipients.
+func publishMentions(message models.Message, participants []primitive.ObjectID) {
+	if len(message.Mentions) == 0 {
+		return
+	}
+
+	isParticipant := make(map[primitive.ObjectID]bool, len(participants))
+	for _, participant := range participants {
+		isParticipant[participant] = true
+	}
+
+	event := models.MentionEvent{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Preview:        truncate(message.PlainText, mentionPreviewLength),
+	}
+
+	for _, mention := range message.Mentions {
+		if mention.UserID == message.SenderID || !isParticipant[mention.UserID] {
+			continue
+		}
+		realtime.Publish(realtime.UserChannel(mention.UserID.Hex()), "mention", event)
+	}
+}
+
+func (s *MessageService) listMentions(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+	params := r.URL.Query()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversationFilter, err := membership.Filter(ctx, s.conversationCollection.Database(), userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	conversationIds, err := s.conversationCollection.Distinct(ctx, "_id", tenant.Scope(ctx, conversationFilter))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filter := bson.M{
+		"mentions.userId": userIdObject,
+		"conversationId":  bson.M{"$in": conversationIds},
+		"senderId":        bson.M{"$ne": userIdObject},
+	}
+
+	cleared, err := s.clearedBefore(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(cleared) > 0 {
+		filter["$nor"] = hiddenMessages(cleared)
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := s.messageCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]models.Message, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := false
+	if len(results) > limit {
+		results = results[:limit]
+		hasMore = true
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.MentionsResponse{
+			Results: results,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
+
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:max])) + "..."
+}
@@ -0,0 +1,58 @@
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	t.Run("Mentions at the start and mid sentence", func(t *testing.T) {
+		tokens := parseMentions("@alice can you ask @bob.smith1234?")
+
+		assert.Len(t, tokens, 2)
+		assert.Equal(t, mentionToken{Username: "alice", Offset: 0, Length: 6}, tokens[0])
+		assert.Equal(t, mentionToken{Username: "bob.smith1234", Offset: 19, Length: 14}, tokens[1])
+	})
+
+	t.Run("Email addresses are not mentions", func(t *testing.T) {
+		assert.Empty(t, parseMentions("write to alice@example.com"))
+	})
+
+	t.Run("Trailing dots are dropped", func(t *testing.T) {
+		tokens := parseMentions("thanks @carol.")
+
+		assert.Len(t, tokens, 1)
+		assert.Equal(t, "carol", tokens[0].Username)
+		assert.Equal(t, 6, tokens[0].Length)
+	})
+
+	t.Run("Duplicates are reported once", func(t *testing.T) {
+		assert.Len(t, parseMentions("@dave @dave @dave"), 1)
+	})
+
+	t.Run("Offsets are in UTF-16 code units", func(t *testing.T) {
+		tokens := parseMentions("😀 @erin")
+
+		assert.Len(t, tokens, 1)
+		assert.Equal(t, 3, tokens[0].Offset)
+		assert.Equal(t, 5, tokens[0].Length)
+	})
+
+	t.Run("Mentions per message are capped", func(t *testing.T) {
+		var b strings.Builder
+		for i := 0; i < maxMentionsPerMessage+5; i++ {
+			b.WriteString("@user")
+			b.WriteByte(byte('a' + i))
+			b.WriteByte(' ')
+		}
+
+		assert.Len(t, parseMentions(b.String()), maxMentionsPerMessage)
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "héllo...", truncate("héllo world", 6))
+}
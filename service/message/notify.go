@@ -0,0 +1,77 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const notificationPreviewLength = 100
+
+func (s *MessageService) settingsCollection() *mongo.Collection {
+	return s.messageCollection.Database().Collection("conversation_settings")
+}
+
+// notifyRecipients unarchives the conversation for everyone but the sender and
+// sends a notification to recipients who haven't muted it. Mentioned users are
+// left to the mention event, which ignores mute.
+func (s *MessageService) notifyRecipients(ctx context.Context, message models.Message, participants []primitive.ObjectID) {
+	_, err := s.settingsCollection().UpdateMany(ctx,
+		bson.M{"conversationId": message.ConversationID, "userId": bson.M{"$ne": message.SenderID}, "archived": true},
+		bson.M{"$set": bson.M{"archived": false, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("failed to unarchive conversation %s: %v", message.ConversationID.Hex(), err)
+	}
+
+	muted, err := s.mutedParticipants(ctx, message.ConversationID, time.Now())
+	if err != nil {
+		log.Printf("failed to load mute settings for conversation %s: %v", message.ConversationID.Hex(), err)
+	}
+
+	mentioned := make(map[primitive.ObjectID]bool, len(message.Mentions))
+	for _, mention := range message.Mentions {
+		mentioned[mention.UserID] = true
+	}
+
+	event := models.MessageNotification{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Preview:        truncate(message.PlainText, notificationPreviewLength),
+	}
+
+	for _, participant := range participants {
+		if participant == message.SenderID || muted[participant] || mentioned[participant] {
+			continue
+		}
+		realtime.Publish(realtime.UserChannel(participant.Hex()), "message-notification", event)
+	}
+}
+
+func (s *MessageService) mutedParticipants(ctx context.Context, conversationId primitive.ObjectID, now time.Time) (map[primitive.ObjectID]bool, error) {
+	cursor, err := s.settingsCollection().Find(ctx, bson.M{"conversationId": conversationId, "muted": true})
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []models.ConversationSettings
+	if err := cursor.All(ctx, &settings); err != nil {
+		return nil, err
+	}
+
+	muted := make(map[primitive.ObjectID]bool, len(settings))
+	for _, setting := range settings {
+		if setting.IsMuted(now) {
+			muted[setting.UserID] = true
+		}
+	}
+
+	return muted, nil
+}
@@ -0,0 +1,74 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMessageService_NotifyRecipients(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		ctx := context.Background()
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		first, _, err := messageService.SendMessage(ctx, user1.ID, user2.ID, "hello", "")
+		assert.NoError(t, err)
+		assert.Len(t, recorder.Events("message-notification"), 1)
+
+		t.Run("Incoming message unarchives the conversation", func(t *testing.T) {
+			settings := messageService.settingsCollection()
+			settings.InsertOne(ctx, models.ConversationSettings{UserID: user2.ID, ConversationID: first.ConversationID, Archived: true})
+			settings.InsertOne(ctx, models.ConversationSettings{UserID: user1.ID, ConversationID: first.ConversationID, Archived: true})
+
+			_, _, err := messageService.SendMessage(ctx, user1.ID, user2.ID, "still there?", "")
+			assert.NoError(t, err)
+
+			var receiver, sender models.ConversationSettings
+			settings.FindOne(ctx, bson.M{"userId": user2.ID}).Decode(&receiver)
+			settings.FindOne(ctx, bson.M{"userId": user1.ID}).Decode(&sender)
+			assert.False(t, receiver.Archived)
+			assert.True(t, sender.Archived)
+		})
+
+		t.Run("Muted recipients get no notification but still get mentions", func(t *testing.T) {
+			until := time.Now().Add(time.Hour)
+			messageService.settingsCollection().UpdateOne(ctx,
+				bson.M{"userId": user2.ID, "conversationId": first.ConversationID},
+				bson.M{"$set": bson.M{"muted": true, "mutedUntil": until}},
+			)
+			before := len(recorder.Events("message-notification"))
+
+			_, _, err := messageService.SendMessage(ctx, user1.ID, user2.ID, "hey @user2", "")
+			assert.NoError(t, err)
+
+			assert.Len(t, recorder.Events("message-notification"), before)
+			mentions := recorder.Events("mention")
+			assert.Len(t, mentions, 1)
+			assert.Equal(t, realtime.UserChannel(user2.ID.Hex()), mentions[0].Channel)
+		})
+
+		t.Run("Expired mute no longer silences", func(t *testing.T) {
+			messageService.settingsCollection().UpdateOne(ctx,
+				bson.M{"userId": user2.ID, "conversationId": first.ConversationID},
+				bson.M{"$set": bson.M{"mutedUntil": time.Now().Add(-time.Minute)}},
+			)
+			before := len(recorder.Events("message-notification"))
+
+			_, _, err := messageService.SendMessage(ctx, user1.ID, user2.ID, "ping", "")
+			assert.NoError(t, err)
+
+			assert.Len(t, recorder.Events("message-notification"), before+1)
+		})
+	})
+}
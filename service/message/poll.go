@@ -0,0 +1,431 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrPollNotFound      = errors.New("poll not found")
+	ErrPollClosed        = errors.New("poll is closed")
+	ErrInvalidPollOption = errors.New("poll option not valid")
+)
+
+func (s *MessageService) pollVoteCollection() *mongo.Collection {
+	return s.messageCollection.Database().Collection("poll_votes")
+}
+
+func (s *MessageService) createPoll(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.CreatePollPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var receiverIdObject, conversationIdObject primitive.ObjectID
+	if payload.ConversationID != "" {
+		conversationIdObject, err = primitive.ObjectIDFromHex(payload.ConversationID)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+			return
+		}
+	} else {
+		receiverIdObject, err = primitive.ObjectIDFromHex(payload.UserId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
+			return
+		}
+	}
+
+	if payload.ClosesAt != nil && !payload.ClosesAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, "closesAt must be in the future")
+		return
+	}
+
+	poll := models.Poll{
+		Question:       strings.TrimSpace(payload.Question),
+		MultipleChoice: payload.MultipleChoice,
+		ClosesAt:       payload.ClosesAt,
+	}
+
+	seen := make(map[string]bool, len(payload.Options))
+	for i, text := range payload.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || seen[strings.ToLower(text)] {
+			utils.WriteError(w, http.StatusBadRequest, "Poll options must be unique and not empty")
+			return
+		}
+		seen[strings.ToLower(text)] = true
+		poll.Options = append(poll.Options, models.PollOption{ID: i, Text: text})
+	}
+
+	message, _, err := s.send(ctx, models.Message{
+		SenderID:       userIdObject,
+		ReceiverID:     receiverIdObject,
+		ConversationID: conversationIdObject,
+		Message:        poll.Question,
+		Type:           models.MessageTypePoll,
+		Poll:           &poll,
+	})
+	if err == ErrUserNotFound {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err == ErrInvalidReceiver {
+		utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
+		return
+	} else if err == ErrBlocked {
+		utils.WriteError(w, http.StatusForbidden, "You can't message this user")
+		return
+	} else if err == ErrConversationNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	} else if err == ErrCannotPost {
+		utils.WriteError(w, http.StatusForbidden, "You can't post in this conversation")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    message,
+	})
+}
+
+func (s *MessageService) votePoll(w http.ResponseWriter, r *http.Request) {
+	var payload models.PollVotePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.handleVote(w, r, payload.OptionIDs)
+}
+
+func (s *MessageService) unvotePoll(w http.ResponseWriter, r *http.Request) {
+	s.handleVote(w, r, nil)
+}
+
+func (s *MessageService) closePoll(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, messageIdObject, ok := pollRequestIds(w, r)
+	if !ok {
+		return
+	}
+
+	message, err := s.findPoll(ctx, messageIdObject, userIdObject)
+	if err == ErrPollNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Poll not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if message.SenderID != userIdObject {
+		utils.WriteError(w, http.StatusForbidden, "Only the creator can close a poll")
+		return
+	}
+
+	now := time.Now()
+	var updated models.Message
+	err = s.messageCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": messageIdObject, "poll.closedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"poll.closedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusConflict, "Poll is closed")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := models.PollResult{MessageID: updated.ID, ConversationID: updated.ConversationID, Poll: *updated.Poll}
+	s.publishPollUpdate(ctx, result)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Poll closed",
+		Status:  http.StatusOK,
+		Data:    result,
+	})
+}
+
+// handleVote replaces the caller's selection with optionIds, or removes it when nil.
+func (s *MessageService) handleVote(w http.ResponseWriter, r *http.Request, optionIds []int) {
+	var ctx = r.Context()
+
+	userIdObject, messageIdObject, ok := pollRequestIds(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.vote(ctx, messageIdObject, userIdObject, optionIds)
+	switch {
+	case err == ErrPollNotFound:
+		utils.WriteError(w, http.StatusNotFound, "Poll not found")
+		return
+	case err == ErrPollClosed:
+		utils.WriteError(w, http.StatusConflict, "Poll is closed")
+		return
+	case err == ErrInvalidPollOption:
+		utils.WriteError(w, http.StatusBadRequest, "Poll option not valid")
+		return
+	case err != nil:
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.publishPollUpdate(ctx, *result)
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    result,
+	})
+}
+
+func (s *MessageService) vote(ctx context.Context, messageId primitive.ObjectID, userId primitive.ObjectID, optionIds []int) (*models.PollResult, error) {
+	message, err := s.findPoll(ctx, messageId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if message.Poll.IsClosed(now) {
+		return nil, ErrPollClosed
+	}
+
+	optionIds, err = normalizeOptions(message.Poll, optionIds)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.messageCollection.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	// The vote document and the counters on the message move together
+	var updated models.Message
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		votes := s.pollVoteCollection()
+
+		var previous models.PollVote
+		err := votes.FindOne(sc, bson.M{"messageId": messageId, "userId": userId}).Decode(&previous)
+		hadVote := err == nil
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		delta := make(map[string]int)
+		for _, id := range previous.OptionIDs {
+			delta[optionCounter(id)]--
+		}
+		for _, id := range optionIds {
+			delta[optionCounter(id)]++
+		}
+
+		if len(optionIds) == 0 {
+			if !hadVote {
+				return nil, nil
+			}
+			if _, err := votes.DeleteOne(sc, bson.M{"_id": previous.ID}); err != nil {
+				return nil, err
+			}
+			delta["poll.totalVoters"]--
+		} else {
+			_, err := votes.UpdateOne(sc,
+				bson.M{"messageId": messageId, "userId": userId},
+				bson.M{"$set": bson.M{"optionIds": optionIds, "updatedAt": now}},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return nil, err
+			}
+			if !hadVote {
+				delta["poll.totalVoters"]++
+			}
+		}
+
+		inc := bson.M{}
+		for key, value := range delta {
+			if value != 0 {
+				inc[key] = value
+			}
+		}
+
+		// Re-checking the close state here rejects votes racing a close
+		filter := bson.M{
+			"_id":           messageId,
+			"poll.closedAt": bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"poll.closesAt": bson.M{"$exists": false}},
+				bson.M{"poll.closesAt": bson.M{"$gt": now}},
+			},
+		}
+		update := bson.M{"$set": bson.M{"updatedAt": now}}
+		if len(inc) > 0 {
+			update["$inc"] = inc
+		}
+
+		err = s.messageCollection.FindOneAndUpdate(sc, filter, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPollClosed
+		}
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.Poll == nil {
+		// Unvoting without a vote changes nothing
+		updated = *message
+	}
+
+	return &models.PollResult{
+		MessageID:      updated.ID,
+		ConversationID: updated.ConversationID,
+		Poll:           *updated.Poll,
+		MyVotes:        optionIds,
+	}, nil
+}
+
+// freshPoll copies poll without any votes, so forwarded polls start over.
+func freshPoll(poll models.Poll) *models.Poll {
+	options := make([]models.PollOption, len(poll.Options))
+	for i, option := range poll.Options {
+		options[i] = models.PollOption{ID: i, Text: option.Text}
+	}
+
+	poll.Options = options
+	poll.TotalVoters = 0
+	poll.ClosedAt = nil
+	return &poll
+}
+
+// findPoll loads a poll message the user can see.
+func (s *MessageService) findPoll(ctx context.Context, messageId primitive.ObjectID, userId primitive.ObjectID) (*models.Message, error) {
+	var message models.Message
+	err := s.messageCollection.FindOne(ctx, bson.M{"_id": messageId, "type": models.MessageTypePoll}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	count, err := s.conversationCollection.CountDocuments(ctx, tenant.Scope(ctx, bson.M{"_id": message.ConversationID, "participants": userId}))
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || message.Poll == nil {
+		return nil, ErrPollNotFound
+	}
+
+	return &message, nil
+}
+
+func (s *MessageService) publishPollUpdate(ctx context.Context, result models.PollResult) {
+	var conversation models.Conversation
+	if err := s.conversationCollection.FindOne(ctx, bson.M{"_id": result.ConversationID}).Decode(&conversation); err != nil {
+		return
+	}
+
+	// Selections are private, everyone gets the counts
+	result.MyVotes = nil
+	for _, participant := range conversation.Participants {
+		realtime.Publish(realtime.UserChannel(participant.Hex()), "poll-updated", result)
+	}
+}
+
+// normalizeOptions dedupes and sorts optionIds and checks them against the poll.
+func normalizeOptions(poll *models.Poll, optionIds []int) ([]int, error) {
+	if len(optionIds) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool, len(optionIds))
+	normalized := make([]int, 0, len(optionIds))
+	for _, id := range optionIds {
+		if id < 0 || id >= len(poll.Options) {
+			return nil, ErrInvalidPollOption
+		}
+		if !seen[id] {
+			seen[id] = true
+			normalized = append(normalized, id)
+		}
+	}
+
+	if !poll.MultipleChoice && len(normalized) > 1 {
+		return nil, ErrInvalidPollOption
+	}
+
+	sort.Ints(normalized)
+	return normalized, nil
+}
+
+func optionCounter(optionId int) string {
+	return fmt.Sprintf("poll.options.%d.voteCount", optionId)
+}
+
+func pollRequestIds(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userIdObject, err := primitive.ObjectIDFromHex(r.Context().Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	messageIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Message ID not valid")
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return userIdObject, messageIdObject, true
+}
@@ -0,0 +1,63 @@
+package message
+
+import (
+	"lite-chat-go/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeOptions(t *testing.T) {
+	single := &models.Poll{Options: make([]models.PollOption, 3)}
+	multi := &models.Poll{Options: make([]models.PollOption, 3), MultipleChoice: true}
+
+	t.Run("Multiple choice selections are deduped and sorted", func(t *testing.T) {
+		ids, err := normalizeOptions(multi, []int{2, 0, 2})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 2}, ids)
+	})
+
+	t.Run("Single choice accepts one option", func(t *testing.T) {
+		ids, err := normalizeOptions(single, []int{1})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1}, ids)
+
+		_, err = normalizeOptions(single, []int{0, 1})
+		assert.ErrorIs(t, err, ErrInvalidPollOption)
+	})
+
+	t.Run("Unknown options", func(t *testing.T) {
+		_, err := normalizeOptions(multi, []int{3})
+		assert.ErrorIs(t, err, ErrInvalidPollOption)
+
+		_, err = normalizeOptions(multi, []int{-1})
+		assert.ErrorIs(t, err, ErrInvalidPollOption)
+	})
+}
+
+func TestPollIsClosed(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.False(t, (&models.Poll{}).IsClosed(now))
+	assert.False(t, (&models.Poll{ClosesAt: &future}).IsClosed(now))
+	assert.True(t, (&models.Poll{ClosesAt: &past}).IsClosed(now))
+	assert.True(t, (&models.Poll{ClosedAt: &past}).IsClosed(now))
+}
+
+func TestFreshPoll(t *testing.T) {
+	closed := time.Now()
+	poll := freshPoll(models.Poll{
+		Question:    "Lunch?",
+		Options:     []models.PollOption{{ID: 0, Text: "Yes", VoteCount: 3}, {ID: 1, Text: "No", VoteCount: 1}},
+		TotalVoters: 4,
+		ClosedAt:    &closed,
+	})
+
+	assert.Equal(t, "Lunch?", poll.Question)
+	assert.Equal(t, []models.PollOption{{ID: 0, Text: "Yes"}, {ID: 1, Text: "No"}}, poll.Options)
+	assert.Zero(t, poll.TotalVoters)
+	assert.Nil(t, poll.ClosedAt)
+}
@@ -0,0 +1,64 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/linkpreview"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const previewTimeout = 10 * time.Second
+
+// SetLinkPreviewer enables link previews on sent messages.
+func (s *MessageService) SetLinkPreviewer(fetcher linkpreview.Fetcher) {
+	s.previewFetcher = fetcher
+}
+
+// attachPreview runs after the message is delivered so a slow site never holds up sending.
+func (s *MessageService) attachPreview(message models.Message, participants []primitive.ObjectID) {
+	if s.previewFetcher == nil || message.Preview != nil {
+		return
+	}
+
+	link := linkpreview.FirstURL(message)
+	if link == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+		defer cancel()
+
+		preview, err := s.previewFetcher.Fetch(ctx, link)
+		if err != nil {
+			log.Printf("link preview for %s failed: %v", link, err)
+			return
+		}
+		if preview.Title == "" && preview.Description == "" && preview.ImageURL == "" {
+			return
+		}
+
+		_, err = s.messageCollection.UpdateOne(ctx,
+			bson.M{"_id": message.ID},
+			bson.M{"$set": bson.M{"preview": preview}},
+		)
+		if err != nil {
+			log.Printf("failed to store link preview for message %s: %v", message.ID.Hex(), err)
+			return
+		}
+
+		event := models.LinkPreviewEvent{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			Preview:        *preview,
+		}
+		for _, participant := range participants {
+			realtime.Publish(realtime.UserChannel(participant.Hex()), "message-preview", event)
+		}
+	}()
+}
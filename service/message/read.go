@@ -0,0 +1,112 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Group messages have no receiver to flag as read. Each member's progress is the
+// lastReadAt in their conversation settings instead.
+
+// markGroupRead moves userId's read position in a group up to upTo and tells the
+// other members how many messages that covered. The position never moves back.
+func (s *MessageService) markGroupRead(ctx context.Context, conversation *models.Conversation, userId primitive.ObjectID, upTo *models.Message) (models.ReadReceipt, error) {
+	readAt := time.Now()
+	receipt := models.ReadReceipt{
+		ConversationID: conversation.ID,
+		ReaderID:       userId,
+		MessageID:      upTo.ID,
+		ReadAt:         readAt,
+	}
+
+	var previous models.ConversationSettings
+	err := s.settingsCollection().FindOneAndUpdate(ctx,
+		bson.M{"userId": userId, "conversationId": conversation.ID},
+		bson.M{
+			"$max": bson.M{"lastReadAt": upTo.CreatedAt},
+			"$set": bson.M{"updatedAt": readAt},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return receipt, err
+	}
+
+	createdAt := bson.M{"$lte": upTo.CreatedAt}
+	if previous.LastReadAt != nil {
+		if !previous.LastReadAt.Before(upTo.CreatedAt) {
+			return receipt, nil
+		}
+		createdAt["$gt"] = *previous.LastReadAt
+	}
+
+	receipt.Count, err = s.messageCollection.CountDocuments(ctx, bson.M{
+		"conversationId": conversation.ID,
+		"senderId":       bson.M{"$ne": userId},
+		"kind":           bson.M{"$ne": models.MessageKindSystem},
+		"createdAt":      createdAt,
+	})
+	if err != nil {
+		return receipt, err
+	}
+
+	if receipt.Count > 0 {
+		for _, participant := range conversation.Participants {
+			if participant != userId {
+				realtime.Publish(realtime.UserChannel(participant.Hex()), "message-read", receipt)
+			}
+		}
+	}
+
+	return receipt, nil
+}
+
+// groupUnreadFilters returns a filter per group of userId matching the messages
+// of others past the member's read position.
+func (s *MessageService) groupUnreadFilters(ctx context.Context, userId primitive.ObjectID) (bson.A, error) {
+	groupIds, err := s.conversationCollection.Distinct(ctx, "_id", tenant.Scope(ctx, bson.M{
+		"participants": userId,
+		"type":         models.ConversationTypeGroup,
+	}))
+	if err != nil || len(groupIds) == 0 {
+		return nil, err
+	}
+
+	cursor, err := s.settingsCollection().Find(ctx, bson.M{
+		"userId":         userId,
+		"conversationId": bson.M{"$in": groupIds},
+		"lastReadAt":     bson.M{"$exists": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []models.ConversationSettings
+	if err := cursor.All(ctx, &settings); err != nil {
+		return nil, err
+	}
+
+	lastReadAt := make(map[primitive.ObjectID]time.Time, len(settings))
+	for _, setting := range settings {
+		lastReadAt[setting.ConversationID] = *setting.LastReadAt
+	}
+
+	filters := make(bson.A, 0, len(groupIds))
+	for _, id := range groupIds {
+		filter := bson.M{"conversationId": id, "senderId": bson.M{"$ne": userId}}
+		if at, ok := lastReadAt[id.(primitive.ObjectID)]; ok {
+			filter["createdAt"] = bson.M{"$gt": at}
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,128 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageService_GroupReadState(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Group Owner")
+		alice, _ := testDB.CreateTestUser("alice@example.com", "alice", "Alice")
+		bob, _ := testDB.CreateTestUser("bob@example.com", "bob", "Bob")
+
+		now := time.Now()
+		group := models.Conversation{
+			ID:           primitive.NewObjectID(),
+			Type:         models.ConversationTypeGroup,
+			Name:         "Weekend trip",
+			OwnerID:      &owner.ID,
+			Admins:       []primitive.ObjectID{owner.ID},
+			Participants: []primitive.ObjectID{owner.ID, alice.ID, bob.ID},
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		testDB.ConvCol.InsertOne(context.Background(), group)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/send", messageService.sendMessage).Methods(http.MethodPost)
+		router.HandleFunc("/read", messageService.markConversationRead).Methods(http.MethodPost)
+		router.HandleFunc("/unread-count", messageService.unreadCount).Methods(http.MethodGet)
+
+		do := func(userID primitive.ObjectID, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex()))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		send := func(text string) models.Message {
+			w := do(owner.ID, http.MethodPost, "/send", `{"conversationId": "`+group.ID.Hex()+`", "message": "`+text+`"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.Message `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			time.Sleep(5 * time.Millisecond)
+			return response.Data
+		}
+		unread := func(userID primitive.ObjectID) int64 {
+			var response struct {
+				Data models.UnreadCount `json:"data"`
+			}
+			json.Unmarshal(do(userID, http.MethodGet, "/unread-count", "").Body.Bytes(), &response)
+			return response.Data.Total
+		}
+		markRead := func(userID primitive.ObjectID, messageID primitive.ObjectID) *httptest.ResponseRecorder {
+			return do(userID, http.MethodPost, "/read", `{"conversationId": "`+group.ID.Hex()+`", "messageId": "`+messageID.Hex()+`"}`)
+		}
+
+		first := send("First")
+		second := send("Second")
+		third := send("Third")
+
+		t.Run("Group messages are unread for every other member", func(t *testing.T) {
+			assert.Equal(t, int64(3), unread(alice.ID))
+			assert.Equal(t, int64(3), unread(bob.ID))
+			assert.Equal(t, int64(0), unread(owner.ID))
+		})
+
+		t.Run("Reading moves only the reader's position", func(t *testing.T) {
+			w := markRead(alice.ID, second.ID)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.ReadReceipt `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, int64(2), response.Data.Count)
+
+			assert.Equal(t, int64(1), unread(alice.ID))
+			assert.Equal(t, int64(3), unread(bob.ID))
+
+			events := recorder.Events("message-read")
+			assert.Len(t, events, 2)
+			for _, event := range events {
+				assert.NotEqual(t, realtime.UserChannel(alice.ID.Hex()), event.Channel)
+			}
+		})
+
+		t.Run("The read position never moves back", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, markRead(alice.ID, first.ID).Code)
+			assert.Equal(t, int64(1), unread(alice.ID))
+			assert.Len(t, recorder.Events("message-read"), 2)
+
+			var settings models.ConversationSettings
+			messageService.settingsCollection().FindOne(context.Background(), bson.M{
+				"userId":         alice.ID,
+				"conversationId": group.ID,
+			}).Decode(&settings)
+			assert.WithinDuration(t, second.CreatedAt, *settings.LastReadAt, time.Millisecond)
+		})
+
+		t.Run("Reading the latest message clears the group", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, markRead(alice.ID, third.ID).Code)
+			assert.Equal(t, int64(0), unread(alice.ID))
+		})
+	})
+}
@@ -1,34 +1,44 @@
 package message
 
 import (
+	"context"
 	"encoding/json"
-	"lite-chat-go/config"
+	"fmt"
+	"lite-chat-go/linkpreview"
+	"lite-chat-go/membership"
 	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/storage"
+	"lite-chat-go/systemmessage"
+	"lite-chat-go/tenant"
 	"lite-chat-go/types"
 	"lite-chat-go/utils"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/pusher/pusher-http-go/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var client = pusher.Client{
-	AppID:   config.Envs.PusherAppID,
-	Key:     config.Envs.PusherKey,
-	Secret:  config.Envs.PusherSecret,
-	Cluster: config.Envs.PusherCluster,
-	Secure:  true,
-}
-
 type MessageService struct {
 	messageCollection      *mongo.Collection
 	conversationCollection *mongo.Collection
 	userCollection         *mongo.Collection
+	searchBackend          SearchBackend
+	scheduler              Scheduler
+	previewFetcher         linkpreview.Fetcher
+	attachmentStore        storage.Store
+}
+
+// Scheduler stores messages that should be sent later instead of immediately.
+type Scheduler interface {
+	Schedule(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, text string, scheduledAt time.Time) (*models.ScheduledMessage, error)
+	ScheduleInConversation(ctx context.Context, senderId primitive.ObjectID, conversationId primitive.ObjectID, text string, scheduledAt time.Time) (*models.ScheduledMessage, error)
 }
 
 func NewMessageService(messageCollection *mongo.Collection, conversationCollection *mongo.Collection, userCollection *mongo.Collection) *MessageService {
@@ -36,13 +46,103 @@ func NewMessageService(messageCollection *mongo.Collection, conversationCollecti
 		messageCollection:      messageCollection,
 		conversationCollection: conversationCollection,
 		userCollection:         userCollection,
+		searchBackend:          NewMongoSearchBackend(messageCollection),
+	}
+}
+
+// SetSearchBackend replaces the default Mongo text search used by /search.
+func (s *MessageService) SetSearchBackend(backend SearchBackend) {
+	s.searchBackend = backend
+}
+
+// SetScheduler enables the scheduledAt field on /send.
+func (s *MessageService) SetScheduler(scheduler Scheduler) {
+	s.scheduler = scheduler
+}
+
+func (s *MessageService) EnsureIndexes(ctx context.Context) error {
+	// Search moved from the raw body to the plain-text fallback, and a
+	// collection can only hold one text index
+	if err := dropIndexIfExists(ctx, s.messageCollection, "message_text"); err != nil {
+		return err
+	}
+
+	_, err := s.messageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "plainText", Value: "text"}},
+			Options: options.Index().SetName("plainText_text"),
+		},
+		{
+			Keys:    bson.D{{Key: "conversationId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("conversationId_createdAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "receiverId", Value: 1}, {Key: "isRead", Value: 1}, {Key: "conversationId", Value: 1}},
+			Options: options.Index().SetName("receiverId_isRead_conversationId"),
+		},
+		{
+			Keys:    bson.D{{Key: "attachments.key", Value: 1}},
+			Options: options.Index().SetName("attachments_key").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "mentions.userId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("mentions_userId_createdAt"),
+		},
+		{
+			Keys: bson.D{{Key: "senderId", Value: 1}, {Key: "clientMessageId", Value: 1}},
+			Options: options.Index().
+				SetName("senderId_clientMessageId_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"clientMessageId": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.pollVoteCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "messageId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetName("messageId_userId").SetUnique(true),
+	})
+
+	return err
+}
+
+func dropIndexIfExists(ctx context.Context, collection *mongo.Collection, name string) error {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		if spec.Name == name {
+			_, err := collection.Indexes().DropOne(ctx, name)
+			return err
+		}
 	}
+
+	return nil
 }
 
 func (s *MessageService) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/list/{receiver_id}", utils.WithJwtAuth(s.getMessage)).Methods(http.MethodGet)
 	router.HandleFunc("/send", utils.WithJwtAuth(s.sendMessage)).Methods(http.MethodPost)
 	router.HandleFunc("/update-status", utils.WithJwtAuth(s.updateStatusMessage)).Methods(http.MethodPost)
+	router.HandleFunc("/search", utils.WithJwtAuth(s.searchMessage)).Methods(http.MethodGet)
+	router.HandleFunc("/read", utils.WithJwtAuth(s.markConversationRead)).Methods(http.MethodPost)
+	router.HandleFunc("/unread-count", utils.WithJwtAuth(s.unreadCount)).Methods(http.MethodGet)
+	router.HandleFunc("/delivered", utils.WithJwtAuth(s.markDelivered)).Methods(http.MethodPost)
+	router.HandleFunc("/mentions", utils.WithJwtAuth(s.listMentions)).Methods(http.MethodGet)
+	router.HandleFunc("/forward", utils.WithJwtAuth(s.forwardMessage)).Methods(http.MethodPost)
+	router.HandleFunc("/poll", utils.WithJwtAuth(s.createPoll)).Methods(http.MethodPost)
+	router.HandleFunc("/voice", utils.WithJwtAuth(s.sendVoiceNote)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/vote", utils.WithJwtAuth(s.votePoll)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/vote", utils.WithJwtAuth(s.unvotePoll)).Methods(http.MethodDelete)
+	router.HandleFunc("/{id}/poll/close", utils.WithJwtAuth(s.closePoll)).Methods(http.MethodPost)
 }
 
 func (s *MessageService) getMessage(w http.ResponseWriter, r *http.Request) {
@@ -66,12 +166,20 @@ func (s *MessageService) getMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	clearedAt, err := s.clearedAt(ctx, userIdObject, receiverIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.D{
 			{Key: "participants", Value: bson.D{
 				{Key: "$all", Value: bson.A{userIdObject, receiverIdObject}},
 			}},
+			{Key: "type", Value: bson.D{{Key: "$exists", Value: false}}},
 		}}},
+		bson.D{{Key: "$match", Value: tenant.Filter(ctx)}},
 		bson.D{{Key: "$lookup", Value: bson.D{
 			{Key: "from", Value: "messages"},
 			{Key: "localField", Value: "messages"},
@@ -82,11 +190,21 @@ func (s *MessageService) getMessage(w http.ResponseWriter, r *http.Request) {
 		bson.D{{Key: "$replaceRoot", Value: bson.D{
 			{Key: "newRoot", Value: "$messages"},
 		}}},
+	}
+
+	// History the user deleted for themselves stays hidden from them
+	if clearedAt != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{
+			{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: clearedAt}}},
+		}}})
+	}
+
+	pipeline = append(pipeline,
 		bson.D{{Key: "$sort", Value: bson.D{
 			{Key: "createdAt", Value: -1},
 		}}},
 		bson.D{{Key: "$limit", Value: 50}},
-	}
+	)
 
 	cursor, err := s.conversationCollection.Aggregate(ctx, pipeline)
 
@@ -102,6 +220,11 @@ func (s *MessageService) getMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := systemmessage.Render(ctx, s.userCollection, message); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
 	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
 		Success: true,
 		Message: "Success",
@@ -109,6 +232,56 @@ func (s *MessageService) getMessage(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// clearedAt is when userId last deleted their direct chat with otherId, nil if never.
+func (s *MessageService) clearedAt(ctx context.Context, userId primitive.ObjectID, otherId primitive.ObjectID) (*time.Time, error) {
+	var conversation models.Conversation
+	err := s.conversationCollection.FindOne(ctx,
+		tenant.Scope(ctx, bson.M{"participants": bson.M{"$all": bson.A{userId, otherId}}, "type": bson.M{"$exists": false}}),
+		options.FindOne().SetProjection(bson.M{"_id": 1}),
+	).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var settings models.ConversationSettings
+	err = s.settingsCollection().FindOne(ctx, bson.M{"userId": userId, "conversationId": conversation.ID}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return settings.ClearedAt, err
+}
+
+// clearedBefore maps the conversations userId deleted to when they did. Their
+// messages up to then are hidden from userId everywhere.
+func (s *MessageService) clearedBefore(ctx context.Context, userId primitive.ObjectID) (map[primitive.ObjectID]time.Time, error) {
+	cursor, err := s.settingsCollection().Find(ctx, bson.M{"userId": userId, "clearedAt": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	var cleared []models.ConversationSettings
+	if err := cursor.All(ctx, &cleared); err != nil {
+		return nil, err
+	}
+
+	before := make(map[primitive.ObjectID]time.Time, len(cleared))
+	for _, settings := range cleared {
+		before[settings.ConversationID] = *settings.ClearedAt
+	}
+	return before, nil
+}
+
+// hiddenMessages matches the messages cleared hides, to be used with $nor.
+func hiddenMessages(cleared map[primitive.ObjectID]time.Time) bson.A {
+	hidden := make(bson.A, 0, len(cleared))
+	for conversationId, clearedAt := range cleared {
+		hidden = append(hidden, bson.M{"conversationId": conversationId, "createdAt": bson.M{"$lte": clearedAt}})
+	}
+	return hidden
+}
+
 func (s *MessageService) sendMessage(w http.ResponseWriter, r *http.Request) {
 	var ctx = r.Context()
 	userId, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
@@ -135,7 +308,12 @@ func (s *MessageService) sendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	receiverObjectId, err := primitive.ObjectIDFromHex(payload.UserId)
+	var receiverObjectId, conversationObjectId primitive.ObjectID
+	if payload.ConversationID != "" {
+		conversationObjectId, err = primitive.ObjectIDFromHex(payload.ConversationID)
+	} else {
+		receiverObjectId, err = primitive.ObjectIDFromHex(payload.UserId)
+	}
 
 	if err != nil {
 		log.Println(err)
@@ -143,80 +321,115 @@ func (s *MessageService) sendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find receiver
-	var receiver models.User
-	err = s.userCollection.FindOne(ctx, bson.M{"_id": receiverObjectId}).Decode(&receiver)
-	if err == mongo.ErrNoDocuments {
-		utils.WriteError(w, http.StatusNotFound, "User not found")
-		return
-	} else if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+	if payload.ScheduledAt != nil {
+		s.scheduleMessage(w, r, userId, receiverObjectId, conversationObjectId, payload)
 		return
 	}
 
-	receiverId := receiver.ID.Hex() // or your custom getPlainId equivalent
+	clientMessageId := payload.ClientMessageID
+	if clientMessageId == "" {
+		clientMessageId = r.Header.Get("Idempotency-Key")
+	}
+
+	if len(clientMessageId) > maxClientMessageIDLength {
+		utils.WriteError(w, http.StatusBadRequest, "Idempotency key is too long")
+		return
+	}
 
-	if receiverId == userId.Hex() {
+	newMessage, replayed, err := s.send(ctx, models.Message{
+		SenderID:        userId,
+		ReceiverID:      receiverObjectId,
+		ConversationID:  conversationObjectId,
+		Message:         payload.Message,
+		ClientMessageID: clientMessageId,
+	})
+	if err == ErrUserNotFound {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err == ErrInvalidReceiver {
 		utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
 		return
+	} else if err == ErrBlocked {
+		utils.WriteError(w, http.StatusForbidden, "You can't message this user")
+		return
+	} else if err == ErrConversationNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	} else if err == ErrCannotPost {
+		utils.WriteError(w, http.StatusForbidden, "You can't post in this conversation")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	newMessage := models.Message{
-		SenderID:   userId,
-		ReceiverID: receiverObjectId,
-		Message:    payload.Message,
-		IsRead:     false,
-		CreatedAt:  time.Now(),
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
 	}
 
-	var conversation models.Conversation
-	filter := bson.M{"participants": bson.M{"$all": bson.A{userId, receiverObjectId}}}
-	err = s.conversationCollection.FindOne(ctx, filter).Decode(&conversation)
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Message: "Success",
+		Status:  200,
+		Success: true,
+		Data:    newMessage,
+	})
+}
 
-	if err == mongo.ErrNoDocuments {
-		// Create new conversation
-		conversation = models.Conversation{
-			Participants: []primitive.ObjectID{userId, receiverObjectId},
-			UpdatedAt:    time.Now(),
-		}
+func (s *MessageService) scheduleMessage(w http.ResponseWriter, r *http.Request, senderId primitive.ObjectID, receiverId primitive.ObjectID, conversationId primitive.ObjectID, payload models.MessagePayload) {
+	var ctx = r.Context()
 
-		result, err := s.conversationCollection.InsertOne(ctx, conversation)
-		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		conversation.ID = result.InsertedID.(primitive.ObjectID)
-	} else if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+	if s.scheduler == nil {
+		utils.WriteError(w, http.StatusBadRequest, "Scheduling messages is not available")
 		return
 	}
 
-	// Insert message
-	msgResult, err := s.messageCollection.InsertOne(ctx, newMessage)
-	if err != nil {
+	if !payload.ScheduledAt.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, "scheduledAt must be in the future")
+		return
+	}
+
+	var err error
+	if conversationId.IsZero() {
+		err = s.validateReceiver(ctx, senderId, receiverId)
+	} else {
+		_, err = s.resolveConversation(ctx, models.Message{SenderID: senderId, ConversationID: conversationId}, time.Now())
+	}
+	if err == ErrUserNotFound {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err == ErrInvalidReceiver {
+		utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
+		return
+	} else if err == ErrBlocked {
+		utils.WriteError(w, http.StatusForbidden, "You can't message this user")
+		return
+	} else if err == ErrConversationNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	} else if err == ErrCannotPost {
+		utils.WriteError(w, http.StatusForbidden, "You can't post in this conversation")
+		return
+	} else if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	newMessage.ID = msgResult.InsertedID.(primitive.ObjectID)
 
-	// Update conversation with message reference
-	update := bson.M{
-		"$push": bson.M{"messages": msgResult.InsertedID},
-		"$set":  bson.M{"updatedAt": time.Now()},
+	var scheduled *models.ScheduledMessage
+	if conversationId.IsZero() {
+		scheduled, err = s.scheduler.Schedule(ctx, senderId, receiverId, payload.Message, *payload.ScheduledAt)
+	} else {
+		scheduled, err = s.scheduler.ScheduleInConversation(ctx, senderId, conversationId, payload.Message, *payload.ScheduledAt)
 	}
-	_, err = s.conversationCollection.UpdateByID(ctx, conversation.ID, update)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	client.Trigger("lite-chat", "upcoming-message", newMessage)
-
 	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
-		Message: "Success",
-		Status:  200,
+		Message: "Message scheduled",
+		Status:  http.StatusOK,
 		Success: true,
-		Data:    newMessage,
+		Data:    scheduled,
 	})
 }
 
@@ -259,6 +472,38 @@ func (s *MessageService) updateStatusMessage(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if message.ReceiverID.IsZero() {
+		// Group messages are read by moving the member's read position
+		userIdObject, _ := primitive.ObjectIDFromHex(userId)
+		var conversation models.Conversation
+		err := s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{
+			"_id":          message.ConversationID,
+			"participants": userIdObject,
+			"type":         models.ConversationTypeGroup,
+		})).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			utils.WriteError(w, http.StatusBadRequest, "Error processing data")
+			return
+		} else if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		receipt, err := s.markGroupRead(ctx, &conversation, userIdObject, &message)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+			Message: "Success Update message status",
+			Status:  http.StatusOK,
+			Success: true,
+			Data:    receipt,
+		})
+		return
+	}
+
 	if userId != message.ReceiverID.Hex() {
 		utils.WriteError(w, http.StatusBadRequest, "Error processing data")
 		return
@@ -266,16 +511,21 @@ func (s *MessageService) updateStatusMessage(w http.ResponseWriter, r *http.Requ
 
 	message.IsRead = true
 
-	update := bson.M{
-		"$set": bson.M{"isRead": true, "updatedAt": time.Now()},
-	}
-
-	data, err := s.messageCollection.UpdateByID(ctx, message.ID, update)
+	readAt := time.Now()
+	data, err := s.messageCollection.UpdateByID(ctx, message.ID, readUpdate(readAt))
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	realtime.Publish(realtime.UserChannel(message.SenderID.Hex()), "message-read", models.ReadReceipt{
+		ConversationID: message.ConversationID,
+		ReaderID:       message.ReceiverID,
+		MessageID:      message.ID,
+		ReadAt:         readAt,
+		Count:          data.ModifiedCount,
+	})
+
 	utils.WriteJSON(
 		w,
 		http.StatusOK,
@@ -287,3 +537,423 @@ func (s *MessageService) updateStatusMessage(w http.ResponseWriter, r *http.Requ
 		},
 	)
 }
+
+func (s *MessageService) markConversationRead(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userId := ctx.Value(types.ContextKeyUserID).(string)
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.MarkConversationReadPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversationIdObject, err := primitive.ObjectIDFromHex(payload.ConversationID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messageIdObject, err := primitive.ObjectIDFromHex(payload.MessageID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var conversation models.Conversation
+	err = s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": conversationIdObject, "participants": userIdObject})).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var lastRead models.Message
+	err = s.messageCollection.FindOne(ctx, bson.M{"_id": messageIdObject, "conversationId": conversation.ID}).Decode(&lastRead)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if conversation.IsGroup() {
+		receipt, err := s.markGroupRead(ctx, &conversation, userIdObject, &lastRead)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+			Success: true,
+			Message: "Success",
+			Status:  http.StatusOK,
+			Data:    receipt,
+		})
+		return
+	}
+
+	readAt := time.Now()
+	filter := bson.M{
+		"conversationId": conversation.ID,
+		"receiverId":     userIdObject,
+		"isRead":         false,
+		"createdAt":      bson.M{"$lte": lastRead.CreatedAt},
+	}
+
+	result, err := s.messageCollection.UpdateMany(ctx, filter, readUpdate(readAt))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	receipt := models.ReadReceipt{
+		ConversationID: conversation.ID,
+		ReaderID:       userIdObject,
+		MessageID:      lastRead.ID,
+		ReadAt:         readAt,
+		Count:          result.ModifiedCount,
+	}
+
+	if result.ModifiedCount > 0 {
+		for _, participant := range conversation.Participants {
+			if participant != userIdObject {
+				realtime.Publish(realtime.UserChannel(participant.Hex()), "message-read", receipt)
+			}
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    receipt,
+	})
+}
+
+// readUpdate moves messages to read, backfilling deliveredAt for messages never acknowledged.
+func readUpdate(readAt time.Time) mongo.Pipeline {
+	return mongo.Pipeline{
+		bson.D{{Key: "$set", Value: bson.M{
+			"isRead":      true,
+			"status":      models.MessageStatusRead,
+			"readAt":      readAt,
+			"deliveredAt": bson.M{"$ifNull": bson.A{"$deliveredAt", readAt}},
+			"updatedAt":   readAt,
+		}}},
+	}
+}
+
+func (s *MessageService) markDelivered(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.MarkDeliveredPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messageIds, err := parseDeliveredPayload(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	count, err := s.MarkDelivered(ctx, userIdObject, messageIds)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    map[string]int64{"delivered": count},
+	})
+}
+
+// HandleDeliveredEvent acknowledges delivery for a client event relayed from the realtime webhook.
+func (s *MessageService) HandleDeliveredEvent(ctx context.Context, userId string, data []byte) error {
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	var payload models.MarkDeliveredPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	messageIds, err := parseDeliveredPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.MarkDelivered(ctx, userIdObject, messageIds)
+	return err
+}
+
+// MarkDelivered moves the recipient's sent messages to delivered and notifies each sender.
+func (s *MessageService) MarkDelivered(ctx context.Context, recipientId primitive.ObjectID, messageIds []primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"_id":         bson.M{"$in": messageIds},
+		"receiverId":  recipientId,
+		"isRead":      false,
+		"deliveredAt": bson.M{"$exists": false},
+	}
+
+	cursor, err := s.messageCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"senderId": 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []models.Message
+	if err := cursor.All(ctx, &pending); err != nil {
+		return 0, err
+	}
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	deliveredAt := time.Now()
+	bySender := make(map[primitive.ObjectID][]primitive.ObjectID)
+	ids := make([]primitive.ObjectID, 0, len(pending))
+	for _, m := range pending {
+		bySender[m.SenderID] = append(bySender[m.SenderID], m.ID)
+		ids = append(ids, m.ID)
+	}
+
+	filter["_id"] = bson.M{"$in": ids}
+	result, err := s.messageCollection.UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{
+			"status":      models.MessageStatusDelivered,
+			"deliveredAt": deliveredAt,
+			"updatedAt":   deliveredAt,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for senderId, senderMessageIds := range bySender {
+		realtime.Publish(realtime.UserChannel(senderId.Hex()), "message-delivered", models.DeliveryReceipt{
+			MessageIDs:  senderMessageIds,
+			RecipientID: recipientId,
+			DeliveredAt: deliveredAt,
+		})
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func parseDeliveredPayload(payload models.MarkDeliveredPayload) ([]primitive.ObjectID, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, err
+	}
+
+	messageIds := make([]primitive.ObjectID, 0, len(payload.MessageIDs))
+	for _, id := range payload.MessageIDs {
+		messageId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, err
+		}
+		messageIds = append(messageIds, messageId)
+	}
+
+	return messageIds, nil
+}
+
+func (s *MessageService) unreadCount(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	groups, err := s.groupUnreadFilters(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filter := tenant.Scope(ctx, bson.M{
+		"$or":  append(bson.A{bson.M{"receiverId": userIdObject, "isRead": false}}, groups...),
+		"kind": bson.M{"$ne": models.MessageKindSystem},
+	})
+
+	// Messages hidden by deleting a chat don't count either
+	cleared, err := s.clearedBefore(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(cleared) > 0 {
+		filter["$nor"] = hiddenMessages(cleared)
+	}
+
+	total, err := s.messageCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    models.UnreadCount{Total: total},
+	})
+}
+
+func (s *MessageService) searchMessage(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	params := r.URL.Query()
+
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := SearchQuery{
+		Text:  text,
+		Skip:  int64((page - 1) * limit),
+		Limit: int64(limit + 1),
+	}
+
+	if senderId := params.Get("senderId"); senderId != "" {
+		senderIdObject, err := primitive.ObjectIDFromHex(senderId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Sender ID not valid")
+			return
+		}
+		query.SenderID = &senderIdObject
+	}
+
+	for key, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC3339 timestamp", key))
+			return
+		}
+		*target = &parsed
+	}
+
+	conversationFilter, err := membership.Filter(ctx, s.conversationCollection.Database(), userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if conversationId := params.Get("conversationId"); conversationId != "" {
+		conversationIdObject, err := primitive.ObjectIDFromHex(conversationId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+			return
+		}
+		conversationFilter["_id"] = conversationIdObject
+	}
+
+	conversationIds, err := s.conversationCollection.Distinct(ctx, "_id", tenant.Scope(ctx, conversationFilter))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(conversationIds) == 0 && params.Get("conversationId") != "" {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	for _, id := range conversationIds {
+		query.ConversationIDs = append(query.ConversationIDs, id.(primitive.ObjectID))
+	}
+
+	query.ClearedBefore, err = s.clearedBefore(ctx, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]models.MessageSearchResult, 0)
+	hasMore := false
+
+	if len(query.ConversationIDs) > 0 {
+		hits, err := s.searchBackend.Search(ctx, query)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if len(hits) > limit {
+			hits = hits[:limit]
+			hasMore = true
+		}
+
+		for _, hit := range hits {
+			body := hit.Message.PlainText
+			if body == "" {
+				body = hit.Message.Message
+			}
+			snippet, highlights := buildSnippet(body, text, snippetRadius)
+			results = append(results, models.MessageSearchResult{
+				Message:    hit.Message,
+				Snippet:    snippet,
+				Highlights: highlights,
+				Score:      hit.Score,
+			})
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.MessageSearchResponse{
+			Results: results,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"lite-chat-go/blocking"
 	"lite-chat-go/internal/testutils"
+	"lite-chat-go/linkpreview"
 	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/storage"
 	"lite-chat-go/types"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -266,6 +273,25 @@ func TestMessageService_SendMessage(t *testing.T) {
 			assert.Equal(t, http.StatusBadRequest, w.Code)
 		})
 
+		t.Run("Send message longer than the limit", func(t *testing.T) {
+			payload := models.MessagePayload{
+				UserId:  user2.ID.Hex(),
+				Message: strings.Repeat("[", 4097),
+			}
+
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(body))
+
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+
+			messageService.sendMessage(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
 		t.Run("Send message with invalid user ID format", func(t *testing.T) {
 			payload := models.MessagePayload{
 				UserId:  "invalid-id-format",
@@ -306,6 +332,219 @@ func TestMessageService_SendMessage(t *testing.T) {
 	})
 }
 
+func TestMessageService_SendMessageRealtime(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+		user3, _ := testDB.CreateTestUser("outsider@example.com", "outsider", "Outsider User")
+
+		_, _, err := messageService.SendMessage(context.Background(), user1.ID, user2.ID, "Just between us", "")
+		assert.NoError(t, err)
+
+		t.Run("Only the participants receive the message", func(t *testing.T) {
+			events := recorder.Events("upcoming-message")
+			channels := make([]string, 0, len(events))
+			for _, event := range events {
+				channels = append(channels, event.Channel)
+			}
+
+			assert.ElementsMatch(t, []string{
+				realtime.UserChannel(user1.ID.Hex()),
+				realtime.UserChannel(user2.ID.Hex()),
+			}, channels)
+			assert.NotContains(t, channels, realtime.UserChannel(user3.ID.Hex()))
+			assert.NotContains(t, channels, realtime.BroadcastChannel)
+		})
+	})
+}
+
+func TestMessageService_SendMessageIdempotency(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+
+		send := func(payload models.MessagePayload, idempotencyKey string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(body))
+			if idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", idempotencyKey)
+			}
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.sendMessage(w, req)
+			return w
+		}
+
+		messageID := func(w *httptest.ResponseRecorder) string {
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data.(map[string]interface{})["_id"].(string)
+		}
+
+		t.Run("Retry with the same clientMessageId returns the original", func(t *testing.T) {
+			payload := models.MessagePayload{UserId: user2.ID.Hex(), Message: "Hello", ClientMessageID: "client-1"}
+
+			first := send(payload, "")
+			second := send(payload, "")
+
+			assert.Equal(t, http.StatusOK, first.Code)
+			assert.Equal(t, http.StatusOK, second.Code)
+			assert.Equal(t, messageID(first), messageID(second))
+			assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"clientMessageId": "client-1"})
+			assert.Equal(t, int64(1), count)
+			assert.Len(t, recorder.Events("upcoming-message"), 2)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"participants": user1.ID}).Decode(&conversation)
+			assert.Len(t, conversation.Messages, 1)
+		})
+
+		t.Run("Idempotency-Key header is honoured", func(t *testing.T) {
+			payload := models.MessagePayload{UserId: user2.ID.Hex(), Message: "Hello again"}
+
+			first := send(payload, "header-key")
+			second := send(payload, "header-key")
+
+			assert.Equal(t, messageID(first), messageID(second))
+		})
+
+		t.Run("Messages without a key are never deduplicated", func(t *testing.T) {
+			payload := models.MessagePayload{UserId: user2.ID.Hex(), Message: "Hello"}
+
+			first := send(payload, "")
+			second := send(payload, "")
+
+			assert.NotEqual(t, messageID(first), messageID(second))
+		})
+
+		t.Run("Overlong key is rejected", func(t *testing.T) {
+			payload := models.MessagePayload{UserId: user2.ID.Hex(), Message: "Hello"}
+
+			w := send(payload, strings.Repeat("k", 65))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Failed message insert leaves no conversation behind", func(t *testing.T) {
+			user3, _ := testDB.CreateTestUser("third@example.com", "third", "Third User")
+
+			// Reject a specific body so the insert fails after the conversation was created
+			err := testDB.Database.RunCommand(context.Background(), bson.D{
+				{Key: "collMod", Value: "messages"},
+				{Key: "validator", Value: bson.M{"message": bson.M{"$ne": "poison"}}},
+			}).Err()
+			assert.NoError(t, err)
+
+			_, _, err = messageService.SendMessage(context.Background(), user1.ID, user3.ID, "poison", "")
+			assert.Error(t, err)
+
+			count, _ := testDB.ConvCol.CountDocuments(context.Background(), bson.M{"participants": user3.ID})
+			assert.Equal(t, int64(0), count)
+		})
+	})
+}
+
+type fakeScheduler struct {
+	scheduled []models.ScheduledMessage
+}
+
+func (f *fakeScheduler) Schedule(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, text string, scheduledAt time.Time) (*models.ScheduledMessage, error) {
+	scheduled := models.ScheduledMessage{ID: primitive.NewObjectID(), SenderID: senderId, ReceiverID: receiverId, Message: text, ScheduledAt: scheduledAt}
+	f.scheduled = append(f.scheduled, scheduled)
+	return &scheduled, nil
+}
+
+func (f *fakeScheduler) ScheduleInConversation(ctx context.Context, senderId primitive.ObjectID, conversationId primitive.ObjectID, text string, scheduledAt time.Time) (*models.ScheduledMessage, error) {
+	scheduled := models.ScheduledMessage{ID: primitive.NewObjectID(), SenderID: senderId, ConversationID: conversationId, Message: text, ScheduledAt: scheduledAt}
+	f.scheduled = append(f.scheduled, scheduled)
+	return &scheduled, nil
+}
+
+func TestMessageService_SendScheduledMessage(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		scheduler := &fakeScheduler{}
+		messageService.SetScheduler(scheduler)
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+
+		send := func(payload models.MessagePayload) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.sendMessage(w, req)
+			return w
+		}
+
+		t.Run("Future scheduledAt is handed to the scheduler", func(t *testing.T) {
+			at := time.Now().Add(time.Hour)
+			w := send(models.MessagePayload{UserId: user2.ID.Hex(), Message: "Later", ScheduledAt: &at})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Len(t, scheduler.scheduled, 1)
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{})
+			assert.Equal(t, int64(0), count)
+		})
+
+		t.Run("Past scheduledAt is rejected", func(t *testing.T) {
+			at := time.Now().Add(-time.Hour)
+			w := send(models.MessagePayload{UserId: user2.ID.Hex(), Message: "Too late", ScheduledAt: &at})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Unknown receiver is rejected up front", func(t *testing.T) {
+			at := time.Now().Add(time.Hour)
+			w := send(models.MessagePayload{UserId: primitive.NewObjectID().Hex(), Message: "Nobody", ScheduledAt: &at})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Group messages can be scheduled", func(t *testing.T) {
+			now := time.Now()
+			group := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeGroup,
+				Name:         "Planning",
+				OwnerID:      &user1.ID,
+				Admins:       []primitive.ObjectID{user1.ID},
+				Participants: []primitive.ObjectID{user1.ID, user2.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertOne(context.Background(), group)
+
+			at := now.Add(time.Hour)
+			w := send(models.MessagePayload{ConversationID: group.ID.Hex(), Message: "Reminder", ScheduledAt: &at})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, group.ID, scheduler.scheduled[len(scheduler.scheduled)-1].ConversationID)
+
+			w = send(models.MessagePayload{ConversationID: primitive.NewObjectID().Hex(), Message: "Nowhere", ScheduledAt: &at})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	})
+}
+
 func TestMessageService_UpdateStatusMessage(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
 		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
@@ -455,6 +694,328 @@ func TestMessageService_UpdateStatusMessage(t *testing.T) {
 	})
 }
 
+func TestMessageService_SearchMessage(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		message1, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Are we still on for the project meeting?")
+		message2, _ := testDB.CreateTestMessage(user2.ID, user1.ID, "Yes, the meeting starts at noon")
+		message3, _ := testDB.CreateTestMessage(user2.ID, user3.ID, "Secret meeting notes")
+
+		conv1, _ := testDB.CreateTestConversation(
+			[]primitive.ObjectID{user1.ID, user2.ID},
+			[]primitive.ObjectID{message1.ID, message2.ID},
+		)
+		conv2, _ := testDB.CreateTestConversation(
+			[]primitive.ObjectID{user2.ID, user3.ID},
+			[]primitive.ObjectID{message3.ID},
+		)
+
+		search := func(userID primitive.ObjectID, query string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/search?"+query, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.searchMessage(w, req)
+			return w
+		}
+
+		t.Run("Only returns messages from caller's conversations", func(t *testing.T) {
+			w := search(user1.ID, "q=meeting")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response types.CustomSuccessResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			data := response.Data.(map[string]interface{})
+			results := data["results"].([]interface{})
+			assert.Len(t, results, 2)
+
+			for _, r := range results {
+				result := r.(map[string]interface{})
+				msg := result["message"].(map[string]interface{})
+				assert.Equal(t, conv1.ID.Hex(), msg["conversationId"])
+				assert.Contains(t, result["snippet"], "meeting")
+				assert.NotEmpty(t, result["highlights"])
+			}
+		})
+
+		t.Run("Filters by sender", func(t *testing.T) {
+			w := search(user1.ID, "q=meeting&senderId="+user2.ID.Hex())
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			results := response.Data.(map[string]interface{})["results"].([]interface{})
+			assert.Len(t, results, 1)
+		})
+
+		t.Run("Paginates results", func(t *testing.T) {
+			w := search(user1.ID, "q=meeting&limit=1")
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			data := response.Data.(map[string]interface{})
+			assert.Len(t, data["results"].([]interface{}), 1)
+			assert.True(t, data["hasMore"].(bool))
+		})
+
+		t.Run("Filters by date range", func(t *testing.T) {
+			w := search(user1.ID, "q=meeting&from=2000-01-01T00:00:00Z&to=2000-12-31T00:00:00Z")
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			results := response.Data.(map[string]interface{})["results"].([]interface{})
+			assert.Len(t, results, 0)
+		})
+
+		t.Run("Rejects conversation the caller is not part of", func(t *testing.T) {
+			w := search(user1.ID, "q=meeting&conversationId="+conv2.ID.Hex())
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Missing query", func(t *testing.T) {
+			w := search(user1.ID, "")
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Invalid date filter", func(t *testing.T) {
+			w := search(user1.ID, "q=meeting&from=yesterday")
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
+
+func TestMessageService_MarkConversationRead(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+		user3, _ := testDB.CreateTestUser("outsider@example.com", "outsider", "Outsider User")
+
+		message1, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "First")
+		message2, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Second")
+		time.Sleep(10 * time.Millisecond)
+		message3, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Third")
+
+		conv, _ := testDB.CreateTestConversation(
+			[]primitive.ObjectID{user1.ID, user2.ID},
+			[]primitive.ObjectID{message1.ID, message2.ID, message3.ID},
+		)
+
+		markRead := func(userID primitive.ObjectID, payload models.MarkConversationReadPayload) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/read", bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.markConversationRead(w, req)
+			return w
+		}
+
+		t.Run("Marks every message up to the given one", func(t *testing.T) {
+			w := markRead(user2.ID, models.MarkConversationReadPayload{
+				ConversationID: conv.ID.Hex(),
+				MessageID:      message2.ID.Hex(),
+			})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			unread, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"conversationId": conv.ID, "isRead": false})
+			assert.Equal(t, int64(1), unread)
+
+			events := recorder.Events("message-read")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user1.ID.Hex()), events[0].Channel)
+		})
+
+		t.Run("Sender cannot mark their own messages read", func(t *testing.T) {
+			w := markRead(user1.ID, models.MarkConversationReadPayload{
+				ConversationID: conv.ID.Hex(),
+				MessageID:      message3.ID.Hex(),
+			})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var message models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message3.ID}).Decode(&message)
+			assert.False(t, message.IsRead)
+		})
+
+		t.Run("Non participant gets not found", func(t *testing.T) {
+			w := markRead(user3.ID, models.MarkConversationReadPayload{
+				ConversationID: conv.ID.Hex(),
+				MessageID:      message3.ID.Hex(),
+			})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Missing message ID", func(t *testing.T) {
+			w := markRead(user2.ID, models.MarkConversationReadPayload{
+				ConversationID: conv.ID.Hex(),
+			})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
+
+func TestMessageService_UnreadCount(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		testDB.CreateTestMessage(user1.ID, user2.ID, "One")
+		testDB.CreateTestMessage(user1.ID, user2.ID, "Two")
+		testDB.CreateTestMessage(user2.ID, user1.ID, "Reply")
+
+		req := httptest.NewRequest(http.MethodGet, "/unread-count", nil)
+		ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user2.ID.Hex())
+		req = req.WithContext(ctx)
+
+		w := httptest.NewRecorder()
+		messageService.unreadCount(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response types.CustomSuccessResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		data := response.Data.(map[string]interface{})
+		assert.Equal(t, float64(2), data["total"])
+	})
+}
+
+func TestMessageService_MarkDelivered(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+
+		message1, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "First")
+		message2, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Second")
+
+		testDB.CreateTestConversation(
+			[]primitive.ObjectID{user1.ID, user2.ID},
+			[]primitive.ObjectID{message1.ID, message2.ID},
+		)
+
+		markDelivered := func(userID primitive.ObjectID, payload models.MarkDeliveredPayload) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/delivered", bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.markDelivered(w, req)
+			return w
+		}
+
+		t.Run("Sender cannot acknowledge their own messages", func(t *testing.T) {
+			w := markDelivered(user1.ID, models.MarkDeliveredPayload{MessageIDs: []string{message1.ID.Hex()}})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var message models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message1.ID}).Decode(&message)
+			assert.Equal(t, models.MessageStatusSent, message.Status)
+		})
+
+		t.Run("Recipient acknowledges delivery over REST", func(t *testing.T) {
+			w := markDelivered(user2.ID, models.MarkDeliveredPayload{MessageIDs: []string{message1.ID.Hex()}})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var message models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message1.ID}).Decode(&message)
+			assert.Equal(t, models.MessageStatusDelivered, message.Status)
+			assert.NotNil(t, message.DeliveredAt)
+			assert.Nil(t, message.ReadAt)
+
+			events := recorder.Events("message-delivered")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user1.ID.Hex()), events[0].Channel)
+		})
+
+		t.Run("Repeated acknowledgement is a no-op", func(t *testing.T) {
+			w := markDelivered(user2.ID, models.MarkDeliveredPayload{MessageIDs: []string{message1.ID.Hex()}})
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, float64(0), response.Data.(map[string]interface{})["delivered"])
+			assert.Len(t, recorder.Events("message-delivered"), 1)
+		})
+
+		t.Run("Recipient acknowledges delivery over the realtime channel", func(t *testing.T) {
+			data, _ := json.Marshal(models.MarkDeliveredPayload{MessageIDs: []string{message2.ID.Hex()}})
+
+			err := messageService.HandleDeliveredEvent(context.Background(), user2.ID.Hex(), data)
+			assert.NoError(t, err)
+
+			var message models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message2.ID}).Decode(&message)
+			assert.Equal(t, models.MessageStatusDelivered, message.Status)
+		})
+
+		t.Run("Reading keeps the delivery timestamp", func(t *testing.T) {
+			var before models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message1.ID}).Decode(&before)
+
+			body, _ := json.Marshal(models.UpdateMessagePayload{MessageID: message1.ID.Hex()})
+			req := httptest.NewRequest(http.MethodPost, "/update-status", bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user2.ID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.updateStatusMessage(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var after models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message1.ID}).Decode(&after)
+			assert.Equal(t, models.MessageStatusRead, after.Status)
+			assert.NotNil(t, after.ReadAt)
+			assert.Equal(t, before.DeliveredAt.Unix(), after.DeliveredAt.Unix())
+			assert.Len(t, recorder.Events("message-read"), 1)
+		})
+
+		t.Run("Invalid message ID", func(t *testing.T) {
+			w := markDelivered(user2.ID, models.MarkDeliveredPayload{MessageIDs: []string{"invalid"}})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Empty message list", func(t *testing.T) {
+			w := markDelivered(user2.ID, models.MarkDeliveredPayload{})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
+
 func TestNewMessageService(t *testing.T) {
 	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
 		t.Run("Create new message service", func(t *testing.T) {
@@ -475,4 +1036,595 @@ func TestNewMessageService(t *testing.T) {
 			assert.Nil(t, service.userCollection)
 		})
 	})
-}
\ No newline at end of file
+}
+func TestMessageService_ForwardMessage(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+		user4, _ := testDB.CreateTestUser("user4@example.com", "user4", "User Four")
+
+		first, _ := testDB.CreateTestMessage(user2.ID, user1.ID, "First")
+		second, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "Second")
+		source, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, []primitive.ObjectID{first.ID, second.ID})
+		target, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user3.ID}, nil)
+		foreign, _ := testDB.CreateTestConversation([]primitive.ObjectID{user3.ID, user4.ID}, nil)
+
+		forward := func(userID primitive.ObjectID, payload models.ForwardMessagePayload) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/forward", bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.forwardMessage(w, req)
+			return w
+		}
+
+		t.Run("Forward copies messages in order with their origin", func(t *testing.T) {
+			w := forward(user1.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{second.ID.Hex(), first.ID.Hex()},
+				ConversationIDs: []string{target.ID.Hex()},
+			})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var forwarded []models.Message
+			cursor, _ := testDB.MsgCol.Find(context.Background(), bson.M{"conversationId": target.ID})
+			cursor.All(context.Background(), &forwarded)
+			assert.Len(t, forwarded, 2)
+
+			var copyOfFirst models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"conversationId": target.ID, "message": "First"}).Decode(&copyOfFirst)
+			assert.True(t, copyOfFirst.Forwarded)
+			assert.Equal(t, user1.ID, copyOfFirst.SenderID)
+			assert.Equal(t, user3.ID, copyOfFirst.ReceiverID)
+			assert.Equal(t, models.MessageStatusSent, copyOfFirst.Status)
+			assert.Equal(t, first.ID, copyOfFirst.ForwardedFrom.MessageID)
+			assert.Equal(t, source.ID, copyOfFirst.ForwardedFrom.ConversationID)
+			assert.Equal(t, user2.ID, copyOfFirst.ForwardedFrom.SenderID)
+
+			var copyOfSecond models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"conversationId": target.ID, "message": "Second"}).Decode(&copyOfSecond)
+			assert.True(t, copyOfFirst.CreatedAt.Before(copyOfSecond.CreatedAt) || copyOfFirst.CreatedAt.Equal(copyOfSecond.CreatedAt))
+
+			assert.Len(t, recorder.Events("upcoming-message"), 4)
+		})
+
+		t.Run("Origin can be hidden", func(t *testing.T) {
+			w := forward(user1.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{first.ID.Hex()},
+				ConversationIDs: []string{source.ID.Hex()},
+				HideOrigin:      true,
+			})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			data := response["data"].([]interface{})
+			assert.Len(t, data, 1)
+			assert.Equal(t, true, data[0].(map[string]interface{})["forwarded"])
+			assert.NotContains(t, data[0].(map[string]interface{}), "forwardedFrom")
+		})
+
+		t.Run("Target conversation the caller is not in", func(t *testing.T) {
+			w := forward(user1.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{first.ID.Hex()},
+				ConversationIDs: []string{foreign.ID.Hex()},
+			})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Message the caller cannot read", func(t *testing.T) {
+			w := forward(user3.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{first.ID.Hex()},
+				ConversationIDs: []string{foreign.ID.Hex()},
+			})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Blocked target receives nothing", func(t *testing.T) {
+			testDB.Database.Collection(blocking.Collection).InsertOne(context.Background(), models.Block{
+				ID:        primitive.NewObjectID(),
+				BlockerID: user3.ID,
+				BlockedID: user1.ID,
+				CreatedAt: time.Now(),
+			})
+			defer testDB.Database.Collection(blocking.Collection).DeleteMany(context.Background(), bson.M{})
+
+			before, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"conversationId": target.ID})
+			w := forward(user1.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{first.ID.Hex()},
+				ConversationIDs: []string{source.ID.Hex(), target.ID.Hex()},
+			})
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			after, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"conversationId": target.ID})
+			assert.Equal(t, before, after)
+		})
+
+		t.Run("Groups the caller is in and channels they post in are targets", func(t *testing.T) {
+			now := time.Now()
+			group := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeGroup,
+				Name:         "Team",
+				OwnerID:      &user3.ID,
+				Admins:       []primitive.ObjectID{user3.ID},
+				Participants: []primitive.ObjectID{user1.ID, user3.ID, user4.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			channel := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeChannel,
+				Name:         "News",
+				OwnerID:      &user1.ID,
+				Admins:       []primitive.ObjectID{user1.ID},
+				Participants: []primitive.ObjectID{user1.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertMany(context.Background(), []interface{}{group, channel})
+
+			w := forward(user1.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{first.ID.Hex()},
+				ConversationIDs: []string{group.ID.Hex(), channel.ID.Hex()},
+			})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"conversationId": group.ID, "forwarded": true})
+			assert.Equal(t, int64(1), count)
+			count, _ = testDB.MsgCol.CountDocuments(context.Background(), bson.M{"conversationId": channel.ID, "forwarded": true})
+			assert.Equal(t, int64(1), count)
+		})
+
+		t.Run("Channel the caller only reads", func(t *testing.T) {
+			now := time.Now()
+			channel := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeChannel,
+				Name:         "Announcements",
+				OwnerID:      &user3.ID,
+				Admins:       []primitive.ObjectID{user3.ID},
+				Participants: []primitive.ObjectID{user1.ID, user3.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertOne(context.Background(), channel)
+
+			w := forward(user1.ID, models.ForwardMessagePayload{
+				MessageIDs:      []string{first.ID.Hex()},
+				ConversationIDs: []string{channel.ID.Hex()},
+			})
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Empty payload", func(t *testing.T) {
+			w := forward(user1.ID, models.ForwardMessagePayload{})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
+
+func TestMessageService_Mentions(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		t.Run("Mentions are resolved and the mentioned participant is notified", func(t *testing.T) {
+			message, _, err := messageService.SendMessage(context.Background(), user1.ID, user2.ID, "hey @user2, loop in @user3 and @nobody", "")
+
+			assert.NoError(t, err)
+			// user3 is not in the conversation so only user2 is mentioned and notified
+			assert.Len(t, message.Mentions, 1)
+			assert.Equal(t, user2.ID, message.Mentions[0].UserID)
+			assert.Equal(t, 4, message.Mentions[0].Offset)
+
+			events := recorder.Events("mention")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user2.ID.Hex()), events[0].Channel)
+		})
+
+		t.Run("Mentions of me lists messages from my conversations", func(t *testing.T) {
+			messageService.SendMessage(context.Background(), user3.ID, user1.ID, "@user2 is not here", "")
+
+			req := httptest.NewRequest(http.MethodGet, "/mentions", nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user2.ID.Hex())
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			messageService.listMentions(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			results := response["data"].(map[string]interface{})["results"].([]interface{})
+			assert.Len(t, results, 1)
+			assert.Equal(t, user1.ID.Hex(), results[0].(map[string]interface{})["senderId"])
+		})
+	})
+}
+
+func TestMessageService_RichText(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+		_, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		t.Run("Markdown is stored as plain text with entities", func(t *testing.T) {
+			message, _, err := messageService.SendMessage(context.Background(), user1.ID, user2.ID, "**Standup** moved, see [notes](https://example.com)", "")
+
+			assert.NoError(t, err)
+			assert.Equal(t, "**Standup** moved, see [notes](https://example.com)", message.Message)
+			assert.Equal(t, "Standup moved, see notes", message.PlainText)
+			assert.Len(t, message.Entities, 2)
+			assert.Equal(t, models.TextEntityLink, message.Entities[1].Type)
+		})
+
+		t.Run("Search runs against the plain text", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/search?q=standup", nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user2.ID.Hex())
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			messageService.searchMessage(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			results := response["data"].(map[string]interface{})["results"].([]interface{})
+			assert.Len(t, results, 1)
+			assert.Equal(t, "Standup moved, see notes", results[0].(map[string]interface{})["snippet"])
+		})
+	})
+}
+
+func TestMessageService_LinkPreview(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		fetcher := linkpreview.NewFakeFetcher()
+		fetcher.Set("https://example.com/post", models.LinkPreview{Title: "A post", SiteName: "Example"})
+		messageService.SetLinkPreviewer(fetcher)
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		t.Run("Preview is attached after sending and pushed to participants", func(t *testing.T) {
+			message, _, err := messageService.SendMessage(context.Background(), user1.ID, user2.ID, "read https://example.com/post!", "")
+			assert.NoError(t, err)
+			assert.Nil(t, message.Preview)
+
+			assert.Eventually(t, func() bool {
+				return len(recorder.Events("message-preview")) == 2
+			}, 2*time.Second, 20*time.Millisecond)
+
+			var stored models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": message.ID}).Decode(&stored)
+			assert.NotNil(t, stored.Preview)
+			assert.Equal(t, "A post", stored.Preview.Title)
+			assert.Equal(t, "https://example.com/post", stored.Preview.URL)
+		})
+
+		t.Run("Messages without links are not fetched", func(t *testing.T) {
+			messageService.SendMessage(context.Background(), user1.ID, user2.ID, "no links here", "")
+
+			assert.Equal(t, []string{"https://example.com/post"}, fetcher.Calls())
+		})
+	})
+}
+
+func TestMessageService_Polls(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/poll", messageService.createPoll).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/vote", messageService.votePoll).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/vote", messageService.unvotePoll).Methods(http.MethodDelete)
+		router.HandleFunc("/{id}/poll/close", messageService.closePoll).Methods(http.MethodPost)
+
+		do := func(userID primitive.ObjectID, method, path string, payload interface{}) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		pollOf := func(id primitive.ObjectID) *models.Poll {
+			var message models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": id}).Decode(&message)
+			return message.Poll
+		}
+
+		w := do(user1.ID, http.MethodPost, "/poll", models.CreatePollPayload{
+			UserId:         user2.ID.Hex(),
+			Question:       "Where for lunch?",
+			Options:        []string{"Tacos", "Sushi", "Pizza"},
+			MultipleChoice: true,
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var created struct {
+			Data models.Message `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		pollId := created.Data.ID.Hex()
+
+		t.Run("Poll is stored as a poll message", func(t *testing.T) {
+			assert.Equal(t, models.MessageTypePoll, created.Data.Type)
+			assert.Len(t, created.Data.Poll.Options, 3)
+			assert.Equal(t, "Where for lunch?", created.Data.Message)
+		})
+
+		t.Run("Votes update counts and notify participants", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPost, "/"+pollId+"/vote", models.PollVotePayload{OptionIDs: []int{0, 1}}).Code)
+			assert.Equal(t, http.StatusOK, do(user2.ID, http.MethodPost, "/"+pollId+"/vote", models.PollVotePayload{OptionIDs: []int{1}}).Code)
+
+			poll := pollOf(created.Data.ID)
+			assert.Equal(t, 2, poll.TotalVoters)
+			assert.Equal(t, 1, poll.Options[0].VoteCount)
+			assert.Equal(t, 2, poll.Options[1].VoteCount)
+
+			assert.Len(t, recorder.Events("poll-updated"), 4)
+		})
+
+		t.Run("Changing a vote moves the counts", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user2.ID, http.MethodPost, "/"+pollId+"/vote", models.PollVotePayload{OptionIDs: []int{2}}).Code)
+
+			poll := pollOf(created.Data.ID)
+			assert.Equal(t, 2, poll.TotalVoters)
+			assert.Equal(t, 1, poll.Options[1].VoteCount)
+			assert.Equal(t, 1, poll.Options[2].VoteCount)
+		})
+
+		t.Run("Unvote", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodDelete, "/"+pollId+"/vote", nil).Code)
+
+			poll := pollOf(created.Data.ID)
+			assert.Equal(t, 1, poll.TotalVoters)
+			assert.Equal(t, 0, poll.Options[0].VoteCount)
+			assert.Equal(t, 0, poll.Options[1].VoteCount)
+		})
+
+		t.Run("Non participants cannot vote", func(t *testing.T) {
+			w := do(user3.ID, http.MethodPost, "/"+pollId+"/vote", models.PollVotePayload{OptionIDs: []int{0}})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Invalid option", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPost, "/"+pollId+"/vote", models.PollVotePayload{OptionIDs: []int{7}})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Only the creator closes, closed polls reject votes", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(user2.ID, http.MethodPost, "/"+pollId+"/poll/close", nil).Code)
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPost, "/"+pollId+"/poll/close", nil).Code)
+
+			w := do(user2.ID, http.MethodPost, "/"+pollId+"/vote", models.PollVotePayload{OptionIDs: []int{0}})
+
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+
+		t.Run("Polls can be created in a group", func(t *testing.T) {
+			now := time.Now()
+			group := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeGroup,
+				Name:         "Lunch crew",
+				OwnerID:      &user1.ID,
+				Admins:       []primitive.ObjectID{user1.ID},
+				Participants: []primitive.ObjectID{user1.ID, user2.ID, user3.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertOne(context.Background(), group)
+
+			w := do(user1.ID, http.MethodPost, "/poll", models.CreatePollPayload{
+				ConversationID: group.ID.Hex(),
+				Question:       "Friday?",
+				Options:        []string{"Yes", "No"},
+			})
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var groupPoll struct {
+				Data models.Message `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &groupPoll)
+			assert.Equal(t, group.ID, groupPoll.Data.ConversationID)
+
+			w = do(user3.ID, http.MethodPost, "/"+groupPoll.Data.ID.Hex()+"/vote", models.PollVotePayload{OptionIDs: []int{0}})
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			w = do(user1.ID, http.MethodPost, "/poll", models.CreatePollPayload{
+				ConversationID: primitive.NewObjectID().Hex(),
+				Question:       "Friday?",
+				Options:        []string{"Yes", "No"},
+			})
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Polls past their close time reject votes", func(t *testing.T) {
+			closesAt := time.Now().Add(time.Hour)
+			w := do(user1.ID, http.MethodPost, "/poll", models.CreatePollPayload{
+				UserId:   user2.ID.Hex(),
+				Question: "Quick one",
+				Options:  []string{"A", "B"},
+				ClosesAt: &closesAt,
+			})
+			json.Unmarshal(w.Body.Bytes(), &created)
+			testDB.MsgCol.UpdateByID(context.Background(), created.Data.ID, bson.M{"$set": bson.M{"poll.closesAt": time.Now().Add(-time.Second)}})
+
+			w = do(user2.ID, http.MethodPost, "/"+created.Data.ID.Hex()+"/vote", models.PollVotePayload{OptionIDs: []int{0}})
+
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+	})
+}
+
+func TestMessageService_SendVoiceNote(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		store := storage.NewMemoryStore()
+		messageService.SetAttachmentStore(store)
+		_, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		upload := func(fields map[string]string, file []byte) *httptest.ResponseRecorder {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for key, value := range fields {
+				writer.WriteField(key, value)
+			}
+			if file != nil {
+				part, _ := writer.CreateFormFile("file", "note")
+				part.Write(file)
+			}
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/voice", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			messageService.sendVoiceNote(w, req)
+			return w
+		}
+
+		t.Run("WAV voice note is stored with duration and waveform", func(t *testing.T) {
+			w := upload(map[string]string{"userId": user2.ID.Hex()}, testWAV(8000))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.Message `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, models.MessageTypeAudio, response.Data.Type)
+			assert.Len(t, response.Data.Attachments, 1)
+
+			attachment := response.Data.Attachments[0]
+			assert.Equal(t, int64(1000), attachment.DurationMs)
+			assert.Len(t, attachment.Waveform, waveformBuckets)
+
+			file, err := store.Open(context.Background(), attachment.Key)
+			assert.NoError(t, err)
+			file.Close()
+
+			// The listing carries the metadata without the file
+			var stored models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": response.Data.ID}).Decode(&stored)
+			assert.Equal(t, attachment.Waveform, stored.Attachments[0].Waveform)
+		})
+
+		t.Run("Unsupported format", func(t *testing.T) {
+			w := upload(map[string]string{"userId": user2.ID.Hex()}, []byte("just some text"))
+
+			assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		})
+
+		t.Run("Missing file", func(t *testing.T) {
+			w := upload(map[string]string{"userId": user2.ID.Hex()}, nil)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Too large", func(t *testing.T) {
+			w := upload(map[string]string{"userId": user2.ID.Hex()}, make([]byte, maxVoiceNoteBytes+multipartOverhead))
+
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		})
+
+		t.Run("Unknown receiver leaves nothing in storage", func(t *testing.T) {
+			w := upload(map[string]string{"userId": primitive.NewObjectID().Hex()}, testWAV(8000))
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Voice notes can be sent to a group", func(t *testing.T) {
+			now := time.Now()
+			group := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeGroup,
+				Name:         "Band practice",
+				OwnerID:      &user2.ID,
+				Admins:       []primitive.ObjectID{user2.ID},
+				Participants: []primitive.ObjectID{user1.ID, user2.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertOne(context.Background(), group)
+
+			w := upload(map[string]string{"conversationId": group.ID.Hex()}, testWAV(8000))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.Message `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, group.ID, response.Data.ConversationID)
+		})
+
+		t.Run("Group the sender is not in", func(t *testing.T) {
+			now := time.Now()
+			group := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeGroup,
+				Name:         "Private",
+				OwnerID:      &user2.ID,
+				Admins:       []primitive.ObjectID{user2.ID},
+				Participants: []primitive.ObjectID{user2.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertOne(context.Background(), group)
+
+			w := upload(map[string]string{"conversationId": group.ID.Hex()}, testWAV(8000))
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	})
+}
@@ -0,0 +1,195 @@
+package message
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const snippetRadius = 60
+
+// SearchQuery describes a full-text lookup restricted to a set of conversations.
+type SearchQuery struct {
+	Text            string
+	ConversationIDs []primitive.ObjectID
+	SenderID        *primitive.ObjectID
+	From            *time.Time
+	To              *time.Time
+	Skip            int64
+	Limit           int64
+	// ClearedBefore hides the messages of a conversation created up to its
+	// time, see MessageService.clearedBefore
+	ClearedBefore map[primitive.ObjectID]time.Time
+}
+
+type SearchHit struct {
+	Message models.Message
+	Score   float64
+}
+
+// SearchBackend lets the message service swap Mongo text search for another engine.
+type SearchBackend interface {
+	Search(ctx context.Context, query SearchQuery) ([]SearchHit, error)
+}
+
+type MongoSearchBackend struct {
+	messageCollection *mongo.Collection
+}
+
+func NewMongoSearchBackend(messageCollection *mongo.Collection) *MongoSearchBackend {
+	return &MongoSearchBackend{
+		messageCollection: messageCollection,
+	}
+}
+
+func (b *MongoSearchBackend) Search(ctx context.Context, query SearchQuery) ([]SearchHit, error) {
+	filter := bson.M{
+		"$text":          bson.M{"$search": query.Text},
+		"conversationId": bson.M{"$in": query.ConversationIDs},
+	}
+
+	if query.SenderID != nil {
+		filter["senderId"] = *query.SenderID
+	}
+
+	if len(query.ClearedBefore) > 0 {
+		filter["$nor"] = hiddenMessages(query.ClearedBefore)
+	}
+
+	if query.From != nil || query.To != nil {
+		createdAt := bson.M{}
+		if query.From != nil {
+			createdAt["$gte"] = *query.From
+		}
+		if query.To != nil {
+			createdAt["$lte"] = *query.To
+		}
+		filter["createdAt"] = createdAt
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "createdAt", Value: -1}}).
+		SetSkip(query.Skip).
+		SetLimit(query.Limit)
+
+	cursor, err := b.messageCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		models.Message `bson:",inline"`
+		Score          float64 `bson:"score"`
+	}
+
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	hits := make([]SearchHit, 0, len(docs))
+	for _, doc := range docs {
+		hits = append(hits, SearchHit{Message: doc.Message, Score: doc.Score})
+	}
+
+	return hits, nil
+}
+
+// buildSnippet cuts a window of text around the first matched term and returns
+// the offsets of every term match inside that window.
+func buildSnippet(text, query string, radius int) (string, []models.HighlightRange) {
+	highlights := make([]models.HighlightRange, 0)
+
+	pattern := searchTermsPattern(query)
+	if pattern == nil {
+		return truncateText(text, 2*radius), highlights
+	}
+
+	matches := pattern.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return truncateText(text, 2*radius), highlights
+	}
+
+	start, end := 0, len(text)
+	if len(text) > 2*radius {
+		start = matches[0][0] - radius
+		if start < 0 {
+			start = 0
+		}
+		end = start + 2*radius
+		if end > len(text) {
+			end = len(text)
+			start = end - 2*radius
+		}
+		for start > 0 && !utf8.RuneStart(text[start]) {
+			start--
+		}
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "..."
+	}
+	if end < len(text) {
+		suffix = "..."
+	}
+
+	for _, m := range matches {
+		if m[0] < start || m[1] > end {
+			continue
+		}
+		highlights = append(highlights, models.HighlightRange{
+			Start: m[0] - start + len(prefix),
+			End:   m[1] - start + len(prefix),
+		})
+	}
+
+	return prefix + text[start:end] + suffix, highlights
+}
+
+// searchTermsPattern turns a text-search query into a case-insensitive regexp
+// matching words that start with any positive term, mirroring Mongo's stemming loosely.
+func searchTermsPattern(query string) *regexp.Regexp {
+	terms := make([]string, 0)
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		term := strings.Trim(field, `"`)
+		if term == "" {
+			continue
+		}
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+
+	if len(terms) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(terms, "|") + `)\w*`)
+}
+
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+
+	end := max
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+
+	return text[:end] + "..."
+}
@@ -0,0 +1,49 @@
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSnippet(t *testing.T) {
+	t.Run("Short text is returned whole with highlights", func(t *testing.T) {
+		snippet, highlights := buildSnippet("Let's grab lunch tomorrow", "lunch", 60)
+
+		assert.Equal(t, "Let's grab lunch tomorrow", snippet)
+		assert.Len(t, highlights, 1)
+		assert.Equal(t, "lunch", snippet[highlights[0].Start:highlights[0].End])
+	})
+
+	t.Run("Matching is case-insensitive and prefix based", func(t *testing.T) {
+		snippet, highlights := buildSnippet("Meeting moved; meetings are boring", "MEETING", 60)
+
+		assert.Len(t, highlights, 2)
+		assert.Equal(t, "Meeting", snippet[highlights[0].Start:highlights[0].End])
+		assert.Equal(t, "meetings", snippet[highlights[1].Start:highlights[1].End])
+	})
+
+	t.Run("Long text is windowed around the first match", func(t *testing.T) {
+		text := strings.Repeat("filler ", 30) + "deadline" + strings.Repeat(" filler", 30)
+		snippet, highlights := buildSnippet(text, "deadline", 20)
+
+		assert.True(t, strings.HasPrefix(snippet, "..."))
+		assert.True(t, strings.HasSuffix(snippet, "..."))
+		assert.Len(t, highlights, 1)
+		assert.Equal(t, "deadline", snippet[highlights[0].Start:highlights[0].End])
+	})
+
+	t.Run("Negated terms are not highlighted", func(t *testing.T) {
+		_, highlights := buildSnippet("coffee or tea", "coffee -tea", 60)
+
+		assert.Len(t, highlights, 1)
+	})
+
+	t.Run("No match falls back to truncated text", func(t *testing.T) {
+		snippet, highlights := buildSnippet(strings.Repeat("a", 200), "zzz", 10)
+
+		assert.Equal(t, strings.Repeat("a", 20)+"...", snippet)
+		assert.Empty(t, highlights)
+	})
+}
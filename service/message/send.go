@@ -0,0 +1,267 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"lite-chat-go/blocking"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/richtext"
+	"lite-chat-go/tenant"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const maxClientMessageIDLength = 64
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrInvalidReceiver      = errors.New("user id not valid")
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrCannotPost           = errors.New("sender can't post in this conversation")
+	ErrBlocked              = errors.New("sender and receiver blocked each other")
+)
+
+// SendMessage stores a direct message and publishes it. When the sender reuses a
+// clientMessageId the original message is returned instead and replayed is true.
+func (s *MessageService) SendMessage(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, text string, clientMessageId string) (message *models.Message, replayed bool, err error) {
+	return s.send(ctx, models.Message{
+		SenderID:        senderId,
+		ReceiverID:      receiverId,
+		Message:         text,
+		ClientMessageID: clientMessageId,
+	})
+}
+
+// SendToConversation sends text to a direct, group or channel conversation
+// senderId can post in.
+func (s *MessageService) SendToConversation(ctx context.Context, senderId primitive.ObjectID, conversationId primitive.ObjectID, text string, clientMessageId string) (message *models.Message, replayed bool, err error) {
+	return s.send(ctx, models.Message{
+		SenderID:        senderId,
+		ConversationID:  conversationId,
+		Message:         text,
+		ClientMessageID: clientMessageId,
+	})
+}
+
+// send runs draft through validation, persistence and realtime delivery. Content
+// fields are kept as given, delivery state is always reset. A draft with a
+// ConversationID goes to that conversation, otherwise to the direct conversation
+// with ReceiverID.
+func (s *MessageService) send(ctx context.Context, draft models.Message) (*models.Message, bool, error) {
+	senderId, receiverId, clientMessageId := draft.SenderID, draft.ReceiverID, draft.ClientMessageID
+
+	if clientMessageId != "" {
+		existing, err := s.findByClientMessageID(ctx, senderId, clientMessageId)
+		if err == nil {
+			return existing, true, nil
+		} else if err != mongo.ErrNoDocuments {
+			return nil, false, err
+		}
+	}
+
+	if draft.ConversationID.IsZero() {
+		if err := s.validateReceiver(ctx, senderId, receiverId); err != nil {
+			return nil, false, err
+		}
+	}
+
+	now := time.Now()
+	newMessage := draft
+	newMessage.ID = primitive.NewObjectID()
+	newMessage.IsRead = false
+	newMessage.Status = models.MessageStatusSent
+	newMessage.DeliveredAt = nil
+	newMessage.ReadAt = nil
+	newMessage.ExpiresAt = nil
+	newMessage.CreatedAt = now
+	newMessage.UpdatedAt = time.Time{}
+	if newMessage.Kind == "" {
+		newMessage.Kind = models.MessageKindUser
+	}
+	if newMessage.Poll != nil {
+		newMessage.Poll = freshPoll(*newMessage.Poll)
+	}
+
+	newMessage.PlainText, newMessage.Entities = richtext.Parse(newMessage.Message)
+
+	session, err := s.messageCollection.Database().Client().StartSession()
+	if err != nil {
+		return nil, false, err
+	}
+	defer session.EndSession(ctx)
+
+	var participants []primitive.ObjectID
+	var channel bool
+
+	// Conversation lookup/creation and the message insert succeed or fail together
+	transaction := func(sc mongo.SessionContext) (interface{}, error) {
+		conversation, err := s.resolveConversation(sc, draft, now)
+		if err != nil {
+			return nil, err
+		}
+
+		newMessage.ConversationID = conversation.ID
+		newMessage.WorkspaceID = conversation.WorkspaceID
+		if conversation.Type == "" && newMessage.ReceiverID.IsZero() {
+			newMessage.ReceiverID, _ = otherParticipant(*conversation, senderId)
+		}
+		participants = conversation.Participants
+		channel = conversation.IsChannel()
+		if conversation.MessageTimer > 0 {
+			expiresAt := now.Add(time.Duration(conversation.MessageTimer) * time.Second)
+			newMessage.ExpiresAt = &expiresAt
+		}
+		newMessage.Mentions, err = s.resolveMentions(sc, newMessage.PlainText, conversation)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.messageCollection.InsertOne(sc, newMessage); err != nil {
+			return nil, err
+		}
+
+		update := bson.M{
+			"$push": bson.M{"messages": newMessage.ID},
+			"$set":  bson.M{"updatedAt": now},
+		}
+		_, err = s.conversationCollection.UpdateByID(sc, conversation.ID, update)
+		return nil, err
+	}
+
+	_, err = session.WithTransaction(ctx, transaction)
+	if err != nil && clientMessageId != "" && mongo.IsDuplicateKeyError(err) {
+		// A concurrent retry won the race, hand back its message
+		existing, findErr := s.findByClientMessageID(ctx, senderId, clientMessageId)
+		if findErr == nil {
+			return existing, true, nil
+		} else if findErr != mongo.ErrNoDocuments {
+			return nil, false, findErr
+		}
+	}
+	if err != nil && draft.ConversationID.IsZero() && mongo.IsDuplicateKeyError(err) {
+		// A concurrent send created the direct conversation first, the retry finds it
+		_, err = session.WithTransaction(ctx, transaction)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if channel {
+		// One event on the channel's own realtime channel reaches every subscriber
+		realtime.Publish(realtime.ConversationChannel(newMessage.ConversationID.Hex()), "upcoming-message", newMessage)
+	} else {
+		// Only the participants hear about a message, never every connected client
+		for _, participant := range participants {
+			realtime.Publish(realtime.UserChannel(participant.Hex()), "upcoming-message", newMessage)
+		}
+	}
+	publishMentions(newMessage, participants)
+	s.notifyRecipients(ctx, newMessage, participants)
+	s.attachPreview(newMessage, participants)
+
+	return &newMessage, false, nil
+}
+
+func (s *MessageService) validateReceiver(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID) error {
+	var receiver models.User
+	err := s.userCollection.FindOne(ctx, bson.M{"_id": receiverId}).Decode(&receiver)
+	if err == mongo.ErrNoDocuments {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if receiver.ID == senderId {
+		return ErrInvalidReceiver
+	}
+
+	// Users outside the sender's workspace don't exist as far as the sender can
+	// tell, and senders outside it reach nobody
+	inWorkspace, err := tenant.AreMembers(ctx, s.messageCollection.Database(), senderId, receiverId)
+	if err != nil {
+		return err
+	} else if !inWorkspace {
+		return ErrUserNotFound
+	}
+
+	blocked, err := blocking.Between(ctx, s.messageCollection.Database(), senderId, receiverId)
+	if err != nil {
+		return err
+	} else if blocked {
+		return ErrBlocked
+	}
+
+	return nil
+}
+
+func (s *MessageService) findByClientMessageID(ctx context.Context, senderId primitive.ObjectID, clientMessageId string) (*models.Message, error) {
+	var message models.Message
+	err := s.messageCollection.FindOne(ctx, bson.M{"senderId": senderId, "clientMessageId": clientMessageId}).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// resolveConversation picks the conversation a draft is sent to and checks the
+// sender may post there.
+func (s *MessageService) resolveConversation(ctx context.Context, draft models.Message, now time.Time) (*models.Conversation, error) {
+	if draft.ConversationID.IsZero() {
+		return s.findOrCreateConversation(ctx, draft.SenderID, draft.ReceiverID, now)
+	}
+
+	var conversation models.Conversation
+	err := s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": draft.ConversationID})).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrConversationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !conversation.CanPost(draft.SenderID) {
+		return nil, ErrCannotPost
+	}
+
+	if conversation.Type == "" {
+		receiverId, _ := otherParticipant(conversation, draft.SenderID)
+		blocked, err := blocking.Between(ctx, s.messageCollection.Database(), draft.SenderID, receiverId)
+		if err != nil {
+			return nil, err
+		} else if blocked {
+			return nil, ErrBlocked
+		}
+	}
+
+	return &conversation, nil
+}
+
+func (s *MessageService) findOrCreateConversation(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, now time.Time) (*models.Conversation, error) {
+	var conversation models.Conversation
+	filter := tenant.Scope(ctx, bson.M{"participants": bson.M{"$all": bson.A{senderId, receiverId}}, "type": bson.M{"$exists": false}})
+	err := s.conversationCollection.FindOne(ctx, filter).Decode(&conversation)
+	if err == nil {
+		return &conversation, nil
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	conversation = models.Conversation{
+		WorkspaceID:  tenant.FromContext(ctx),
+		PairKey:      models.DirectPairKey(senderId, receiverId),
+		Participants: []primitive.ObjectID{senderId, receiverId},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	result, err := s.conversationCollection.InsertOne(ctx, conversation)
+	if err != nil {
+		return nil, err
+	}
+	conversation.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &conversation, nil
+}
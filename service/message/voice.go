@@ -0,0 +1,222 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lite-chat-go/config"
+	"lite-chat-go/media"
+	"lite-chat-go/models"
+	"lite-chat-go/storage"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxVoiceNoteBytes    = 10 << 20
+	maxVoiceNoteDuration = 5 * time.Minute
+	maxCaptionLength     = 4096
+	waveformBuckets      = 64
+
+	// Room for the multipart boundaries and the other form fields
+	multipartOverhead = 64 << 10
+)
+
+type audioFormat struct {
+	ContentType string
+	Extension   string
+}
+
+// audioFormats maps what http.DetectContentType sniffs to what we store.
+var audioFormats = map[string]audioFormat{
+	"audio/wave":      {"audio/wav", ".wav"},
+	"audio/mpeg":      {"audio/mpeg", ".mp3"},
+	"application/ogg": {"audio/ogg", ".ogg"},
+	"video/webm":      {"audio/webm", ".webm"},
+	"video/mp4":       {"audio/mp4", ".m4a"},
+}
+
+// SetAttachmentStore enables uploads such as voice notes.
+func (s *MessageService) SetAttachmentStore(store storage.Store) {
+	s.attachmentStore = store
+}
+
+func (s *MessageService) sendVoiceNote(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	if s.attachmentStore == nil {
+		utils.WriteError(w, http.StatusBadRequest, "Voice notes are not available")
+		return
+	}
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxVoiceNoteBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, "Voice note is too large")
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var receiverIdObject, conversationIdObject primitive.ObjectID
+	if conversationId := r.FormValue("conversationId"); conversationId != "" {
+		conversationIdObject, err = primitive.ObjectIDFromHex(conversationId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+			return
+		}
+	} else {
+		receiverIdObject, err = primitive.ObjectIDFromHex(r.FormValue("userId"))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
+			return
+		}
+	}
+
+	if utf8.RuneCountInString(r.FormValue("message")) > maxCaptionLength {
+		utils.WriteError(w, http.StatusBadRequest, "Caption is too long")
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxVoiceNoteBytes+1))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxVoiceNoteBytes {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, "Voice note is too large")
+		return
+	}
+
+	attachment, format, err := inspectAudio(data, r.FormValue("durationMs"))
+	if err == errUnsupportedAudio {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, "Unsupported audio format")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Check the receiver or conversation before anything is written to storage
+	if conversationIdObject.IsZero() {
+		err = s.validateReceiver(ctx, userIdObject, receiverIdObject)
+	} else {
+		_, err = s.resolveConversation(ctx, models.Message{SenderID: userIdObject, ConversationID: conversationIdObject}, time.Now())
+	}
+	if err == ErrUserNotFound {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err == ErrInvalidReceiver {
+		utils.WriteError(w, http.StatusBadRequest, "User Id not valid")
+		return
+	} else if err == ErrBlocked {
+		utils.WriteError(w, http.StatusForbidden, "You can't message this user")
+		return
+	} else if err == ErrConversationNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Conversation not found")
+		return
+	} else if err == ErrCannotPost {
+		utils.WriteError(w, http.StatusForbidden, "You can't post in this conversation")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	attachment.Key = primitive.NewObjectID().Hex() + format.Extension
+	attachment.URL = fmt.Sprintf("%s/api/attachments/%s", config.Envs.BaseUrl, attachment.Key)
+
+	if err := s.attachmentStore.Save(ctx, attachment.Key, bytes.NewReader(data)); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message, _, err := s.send(ctx, models.Message{
+		SenderID:       userIdObject,
+		ReceiverID:     receiverIdObject,
+		ConversationID: conversationIdObject,
+		Message:        r.FormValue("message"),
+		Type:           models.MessageTypeAudio,
+		Attachments:    []models.Attachment{*attachment},
+	})
+	if err != nil {
+		s.attachmentStore.Delete(context.Background(), attachment.Key)
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    message,
+	})
+}
+
+var errUnsupportedAudio = errors.New("unsupported audio format")
+
+// inspectAudio works out the attachment metadata. WAV input is decoded for its
+// duration and waveform, compressed formats have to declare their duration.
+func inspectAudio(data []byte, declaredDuration string) (*models.Attachment, audioFormat, error) {
+	format, ok := audioFormats[http.DetectContentType(data)]
+	if !ok {
+		return nil, format, errUnsupportedAudio
+	}
+
+	attachment := &models.Attachment{
+		ContentType: format.ContentType,
+		Size:        int64(len(data)),
+	}
+
+	var duration time.Duration
+	if format.ContentType == "audio/wav" {
+		wav, err := media.ParseWAV(data)
+		if err == media.ErrUnsupportedFormat || err == media.ErrNotWAV {
+			return nil, format, errUnsupportedAudio
+		} else if err != nil {
+			return nil, format, err
+		}
+		duration = wav.Duration()
+		attachment.Waveform = wav.Waveform(waveformBuckets)
+	} else {
+		ms, err := strconv.ParseInt(declaredDuration, 10, 64)
+		if err != nil {
+			return nil, format, errors.New("durationMs is required for compressed audio")
+		}
+		duration = time.Duration(ms) * time.Millisecond
+	}
+
+	if duration < time.Millisecond {
+		return nil, format, errors.New("voice note has no audio")
+	}
+	if duration > maxVoiceNoteDuration {
+		return nil, format, fmt.Errorf("voice notes can be at most %d minutes long", int(maxVoiceNoteDuration.Minutes()))
+	}
+	attachment.DurationMs = duration.Milliseconds()
+
+	return attachment, format, nil
+}
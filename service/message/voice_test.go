@@ -0,0 +1,69 @@
+package message
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testWAV builds an 8kHz 16-bit mono WAV with a rising tone.
+func testWAV(frames int) []byte {
+	b := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, 8000)
+	b = binary.LittleEndian.AppendUint32(b, 16000)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(frames*2))
+	for i := 0; i < frames; i++ {
+		b = binary.LittleEndian.AppendUint16(b, uint16(int16(i%1000*30)))
+	}
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(b)-8))
+
+	return b
+}
+
+func TestInspectAudio(t *testing.T) {
+	t.Run("WAV duration and waveform are computed", func(t *testing.T) {
+		attachment, format, err := inspectAudio(testWAV(16000), "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, ".wav", format.Extension)
+		assert.Equal(t, "audio/wav", attachment.ContentType)
+		assert.Equal(t, int64(2000), attachment.DurationMs)
+		assert.Len(t, attachment.Waveform, waveformBuckets)
+	})
+
+	t.Run("Compressed audio needs a declared duration", func(t *testing.T) {
+		ogg := append([]byte("OggS\x00"), make([]byte, 64)...)
+
+		_, _, err := inspectAudio(ogg, "")
+		assert.Error(t, err)
+
+		attachment, _, err := inspectAudio(ogg, "4200")
+		assert.NoError(t, err)
+		assert.Equal(t, "audio/ogg", attachment.ContentType)
+		assert.Equal(t, int64(4200), attachment.DurationMs)
+		assert.Empty(t, attachment.Waveform)
+	})
+
+	t.Run("Duration limits", func(t *testing.T) {
+		ogg := append([]byte("OggS\x00"), make([]byte, 64)...)
+
+		_, _, err := inspectAudio(ogg, "0")
+		assert.Error(t, err)
+
+		_, _, err = inspectAudio(ogg, "300001")
+		assert.Error(t, err)
+	})
+
+	t.Run("Non audio files are rejected", func(t *testing.T) {
+		_, _, err := inspectAudio([]byte("%PDF-1.4 not audio"), "1000")
+
+		assert.ErrorIs(t, err, errUnsupportedAudio)
+	})
+}
@@ -0,0 +1,150 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageService_WorkspaceIsolation(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		messageService := NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+		_, restore := realtime.UseRecorder()
+		defer restore()
+
+		alice, _ := testDB.CreateTestUser("alice@example.com", "alice", "Alice")
+		bob, _ := testDB.CreateTestUser("bob@example.com", "bob", "Bob")
+		carol, _ := testDB.CreateTestUser("carol@example.com", "carol", "Carol")
+
+		workspace := primitive.NewObjectID()
+		members := testDB.Database.Collection(tenant.MemberCollection)
+		for _, id := range []primitive.ObjectID{alice.ID, bob.ID} {
+			members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspace, UserID: id})
+		}
+		inWorkspace := tenant.WithWorkspace(context.Background(), workspace)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/list/{receiver_id}", messageService.getMessage).Methods(http.MethodGet)
+		router.HandleFunc("/search", messageService.searchMessage).Methods(http.MethodGet)
+		router.HandleFunc("/unread-count", messageService.unreadCount).Methods(http.MethodGet)
+
+		get := func(userID, workspaceID primitive.ObjectID, path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			if !workspaceID.IsZero() {
+				ctx = context.WithValue(ctx, types.ContextKeyWorkspaceID, workspaceID.Hex())
+			}
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		var sent *models.Message
+
+		t.Run("Messages are stored in the sender's workspace", func(t *testing.T) {
+			var err error
+			sent, _, err = messageService.SendMessage(inWorkspace, alice.ID, bob.ID, "quarterly numbers", "")
+			assert.NoError(t, err)
+			assert.Equal(t, workspace, sent.WorkspaceID)
+
+			var conversation models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": sent.ConversationID}).Decode(&conversation)
+			assert.Equal(t, workspace, conversation.WorkspaceID)
+		})
+
+		t.Run("Users outside the workspace can't be messaged", func(t *testing.T) {
+			_, _, err := messageService.SendMessage(inWorkspace, alice.ID, carol.ID, "hello", "")
+			assert.Equal(t, ErrUserNotFound, err)
+		})
+
+		t.Run("Members of a named workspace only can't be messaged from the default one", func(t *testing.T) {
+			dave, _ := testDB.CreateTestUser("dave@example.com", "dave", "Dave")
+			members.DeleteOne(context.Background(), bson.M{"workspaceId": bson.M{"$exists": false}, "userId": dave.ID})
+			members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspace, UserID: dave.ID})
+
+			_, _, err := messageService.SendMessage(context.Background(), carol.ID, dave.ID, "hello", "")
+			assert.Equal(t, ErrUserNotFound, err)
+			_, _, err = messageService.SendMessage(context.Background(), dave.ID, carol.ID, "hello", "")
+			assert.Equal(t, ErrUserNotFound, err)
+
+			_, _, err = messageService.SendMessage(inWorkspace, alice.ID, dave.ID, "welcome", "")
+			assert.NoError(t, err)
+		})
+
+		t.Run("Mentions only resolve users of the workspace", func(t *testing.T) {
+			channel := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				WorkspaceID:  workspace,
+				Type:         models.ConversationTypeChannel,
+				Name:         "Announcements",
+				OwnerID:      &alice.ID,
+				Admins:       []primitive.ObjectID{alice.ID},
+				Participants: []primitive.ObjectID{alice.ID},
+			}
+			testDB.ConvCol.InsertOne(context.Background(), channel)
+
+			message, _, err := messageService.send(inWorkspace, models.Message{
+				SenderID:       alice.ID,
+				ConversationID: channel.ID,
+				Message:        "@bob and @carol, see the numbers",
+			})
+			assert.NoError(t, err)
+			assert.Len(t, message.Mentions, 1)
+			assert.Equal(t, bob.ID, message.Mentions[0].UserID)
+		})
+
+		t.Run("History stays in its workspace", func(t *testing.T) {
+			var response struct {
+				Data []models.Message `json:"data"`
+			}
+			json.Unmarshal(get(bob.ID, workspace, "/list/"+alice.ID.Hex()).Body.Bytes(), &response)
+			assert.Len(t, response.Data, 1)
+
+			response.Data = nil
+			json.Unmarshal(get(bob.ID, primitive.NilObjectID, "/list/"+alice.ID.Hex()).Body.Bytes(), &response)
+			assert.Empty(t, response.Data)
+		})
+
+		t.Run("Search stays in its workspace", func(t *testing.T) {
+			search := func(workspaceID primitive.ObjectID) []models.MessageSearchResult {
+				var response struct {
+					Data models.MessageSearchResponse `json:"data"`
+				}
+				json.Unmarshal(get(bob.ID, workspaceID, "/search?q=quarterly").Body.Bytes(), &response)
+				return response.Data.Results
+			}
+
+			assert.Len(t, search(workspace), 1)
+			assert.Empty(t, search(primitive.NilObjectID))
+			assert.Empty(t, search(primitive.NewObjectID()))
+		})
+
+		t.Run("Unread counts stay in their workspace", func(t *testing.T) {
+			unread := func(workspaceID primitive.ObjectID) int64 {
+				var response struct {
+					Data models.UnreadCount `json:"data"`
+				}
+				json.Unmarshal(get(bob.ID, workspaceID, "/unread-count").Body.Bytes(), &response)
+				return response.Data.Total
+			}
+
+			assert.Equal(t, int64(1), unread(workspace))
+			assert.Equal(t, int64(0), unread(primitive.NilObjectID))
+		})
+	})
+}
@@ -0,0 +1,168 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var errTargetNotFound = errors.New("report target not found")
+
+// createReport files a report against a message the caller can read or a user
+// of their workspace. The target is snapshotted into the report right away.
+func (s *ModerationService) createReport(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.CreateReportPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	targetIdObject, err := primitive.ObjectIDFromHex(payload.TargetID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Target ID not valid")
+		return
+	}
+
+	now := time.Now()
+	report := models.Report{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: tenant.FromContext(ctx),
+		TargetType:  payload.TargetType,
+		TargetID:    targetIdObject,
+		ReporterID:  userIdObject,
+		Reason:      payload.Reason,
+		Details:     strings.TrimSpace(payload.Details),
+		Status:      models.ReportStatusOpen,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if payload.TargetType == models.ReportTargetMessage {
+		err = s.snapshotMessage(ctx, &report)
+	} else {
+		err = s.snapshotUser(ctx, &report)
+	}
+	if err == errTargetNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Nothing to report was found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if report.ReportedUserID == userIdObject {
+		utils.WriteError(w, http.StatusBadRequest, "You can't report yourself")
+		return
+	}
+
+	// One pending report per reporter and target keeps the queue from being
+	// flooded, the unique pending index enforces it
+	report.Pending = true
+	_, err = s.reportCollection.InsertOne(ctx, report)
+	if mongo.IsDuplicateKeyError(err) {
+		utils.WriteError(w, http.StatusConflict, "You already reported this")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Report submitted",
+		Status:  http.StatusCreated,
+		Data:    report.ID,
+	})
+}
+
+// snapshotMessage copies the reported message and its sender into report. The
+// reporter has to be able to read the message, system messages can't be reported.
+func (s *ModerationService) snapshotMessage(ctx context.Context, report *models.Report) error {
+	var message models.Message
+	err := s.messageCollection.FindOne(ctx, bson.M{"_id": report.TargetID, "kind": bson.M{"$ne": models.MessageKindSystem}}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return errTargetNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var conversation models.Conversation
+	err = s.conversationCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": message.ConversationID})).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return errTargetNotFound
+	} else if err != nil {
+		return err
+	}
+
+	member, err := membership.IsMember(ctx, s.conversationCollection.Database(), &conversation, report.ReporterID)
+	if err != nil {
+		return err
+	} else if !member {
+		return errTargetNotFound
+	}
+
+	sender, err := s.findUser(ctx, message.SenderID)
+	if err != nil {
+		return err
+	}
+
+	report.ReportedUserID = message.SenderID
+	report.ConversationID = &conversation.ID
+	report.Snapshot = models.ReportSnapshot{Message: &message, User: *sender}
+	return nil
+}
+
+// snapshotUser copies the reported user's public profile into report.
+func (s *ModerationService) snapshotUser(ctx context.Context, report *models.Report) error {
+	inWorkspace, err := tenant.AreMembers(ctx, s.userCollection.Database(), report.ReporterID, report.TargetID)
+	if err != nil {
+		return err
+	} else if !inWorkspace {
+		return errTargetNotFound
+	}
+
+	user, err := s.findUser(ctx, report.TargetID)
+	if err != nil {
+		return err
+	}
+
+	report.ReportedUserID = user.ID
+	report.Snapshot = models.ReportSnapshot{User: *user}
+	return nil
+}
+
+func (s *ModerationService) findUser(ctx context.Context, userId primitive.ObjectID) (*models.UserPublic, error) {
+	var user models.UserPublic
+	err := s.userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, errTargetNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,313 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errReportChanged = errors.New("report changed while resolving")
+
+// claimReport assigns an open report to the caller so two moderators don't
+// work the same report. Claiming a report twice is a no-op, and nobody claims a
+// report they filed or are reported in.
+func (s *ModerationService) claimReport(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	report, ok := s.findReport(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	if report.Involves(userIdObject) {
+		utils.WriteError(w, http.StatusForbidden, "You can't moderate a report you are part of")
+		return
+	}
+
+	if report.Status == models.ReportStatusClaimed && *report.ClaimedBy == userIdObject {
+		writeReport(w, "Report claimed", report)
+		return
+	}
+
+	now := time.Now()
+	var updated models.Report
+	err := s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		err := s.reportCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": report.ID, "status": models.ReportStatusOpen},
+			bson.M{"$set": bson.M{
+				"status":    models.ReportStatusClaimed,
+				"claimedBy": userIdObject,
+				"claimedAt": now,
+				"updatedAt": now,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return errReportChanged
+		} else if err != nil {
+			return err
+		}
+
+		return s.writeLog(sc, &updated, userIdObject, models.ModerationActionClaim, "", now)
+	})
+	if err == errReportChanged {
+		utils.WriteError(w, http.StatusConflict, "Report is already claimed or resolved")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeReport(w, "Report claimed", &updated)
+}
+
+// releaseReport puts a claimed report back in the queue. Admins can release
+// anyone's claim, moderators only their own.
+func (s *ModerationService) releaseReport(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	report, ok := s.findReport(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	filter := bson.M{"_id": report.ID, "status": models.ReportStatusClaimed}
+	if ctx.Value(types.ContextKeyRole) != types.RoleAdmin {
+		filter["claimedBy"] = userIdObject
+	}
+
+	now := time.Now()
+	var updated models.Report
+	err := s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		err := s.reportCollection.FindOneAndUpdate(sc,
+			filter,
+			bson.M{
+				"$set":   bson.M{"status": models.ReportStatusOpen, "updatedAt": now},
+				"$unset": bson.M{"claimedBy": "", "claimedAt": ""},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return errReportChanged
+		} else if err != nil {
+			return err
+		}
+
+		return s.writeLog(sc, &updated, userIdObject, models.ModerationActionRelease, "", now)
+	})
+	if err == errReportChanged {
+		utils.WriteError(w, http.StatusConflict, "You haven't claimed this report")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeReport(w, "Report released", &updated)
+}
+
+// resolveReport closes a report the caller claimed. Deleting the message or
+// suspending the user happens in the same transaction as the report update and
+// its audit entry, the report's snapshot keeps the evidence either way.
+// Suspension deactivates the account in every workspace, so it is left to admins.
+func (s *ModerationService) resolveReport(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.ResolveReportPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, ok := s.findReport(w, r)
+	if !ok {
+		return
+	}
+
+	userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+
+	if report.Involves(userIdObject) {
+		utils.WriteError(w, http.StatusForbidden, "You can't moderate a report you are part of")
+		return
+	}
+
+	if report.Status != models.ReportStatusClaimed || *report.ClaimedBy != userIdObject {
+		utils.WriteError(w, http.StatusConflict, "Claim the report before resolving it")
+		return
+	}
+
+	switch payload.Action {
+	case models.ModerationActionDeleteMessage:
+		if report.TargetType != models.ReportTargetMessage {
+			utils.WriteError(w, http.StatusBadRequest, "Only message reports can delete a message")
+			return
+		}
+	case models.ModerationActionSuspendUser:
+		if ctx.Value(types.ContextKeyRole) != types.RoleAdmin {
+			utils.WriteError(w, http.StatusForbidden, "Only admins can suspend an account")
+			return
+		}
+
+		var target models.User
+		err := s.userCollection.FindOne(ctx, bson.M{"_id": report.ReportedUserID}).Decode(&target)
+		if err == mongo.ErrNoDocuments {
+			utils.WriteError(w, http.StatusNotFound, "User not found")
+			return
+		} else if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if target.Role == types.RoleModerator || target.Role == types.RoleAdmin {
+			utils.WriteError(w, http.StatusForbidden, "Moderators and admins can't be suspended")
+			return
+		}
+	}
+
+	now := time.Now()
+	note := strings.TrimSpace(payload.Note)
+	var updated models.Report
+	var conversation *models.Conversation
+	err := s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		err := s.reportCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": report.ID, "status": models.ReportStatusClaimed, "claimedBy": userIdObject},
+			bson.M{"$set": bson.M{
+				"status":     models.ReportStatusResolved,
+				"resolution": payload.Action,
+				"resolvedBy": userIdObject,
+				"resolvedAt": now,
+				"updatedAt":  now,
+			}, "$unset": bson.M{"pending": ""}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return errReportChanged
+		} else if err != nil {
+			return err
+		}
+
+		switch payload.Action {
+		case models.ModerationActionDeleteMessage:
+			if conversation, err = s.deleteMessage(sc, report); err != nil {
+				return err
+			}
+		case models.ModerationActionSuspendUser:
+			_, err := s.userCollection.UpdateByID(sc, report.ReportedUserID, bson.M{
+				"$set": bson.M{"isActive": false, "updatedAt": now},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.writeLog(sc, &updated, userIdObject, payload.Action, note, now)
+	})
+	if err == errReportChanged {
+		utils.WriteError(w, http.StatusConflict, "Claim the report before resolving it")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if conversation != nil {
+		publishRemoved(conversation, report.TargetID)
+	}
+
+	writeReport(w, "Report resolved", &updated)
+}
+
+// deleteMessage removes the reported message and detaches it from its
+// conversation. A message that is already gone is not an error, nil is returned
+// for the conversation then. Attachment files are left in the store for the
+// report's snapshot.
+func (s *ModerationService) deleteMessage(ctx context.Context, report *models.Report) (*models.Conversation, error) {
+	result, err := s.messageCollection.DeleteOne(ctx, bson.M{"_id": report.TargetID})
+	if err != nil || result.DeletedCount == 0 || report.ConversationID == nil {
+		return nil, err
+	}
+
+	var conversation models.Conversation
+	err = s.conversationCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": *report.ConversationID},
+		bson.M{"$pull": bson.M{
+			"messages":       report.TargetID,
+			"pinnedMessages": bson.M{"messageId": report.TargetID},
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &conversation, nil
+}
+
+func publishRemoved(conversation *models.Conversation, messageId primitive.ObjectID) {
+	event := models.MessageRemoved{ConversationID: conversation.ID, MessageID: messageId}
+	if conversation.IsChannel() {
+		realtime.Publish(realtime.ConversationChannel(conversation.ID.Hex()), "message-removed", event)
+		return
+	}
+	for _, participant := range conversation.Participants {
+		realtime.Publish(realtime.UserChannel(participant.Hex()), "message-removed", event)
+	}
+}
+
+func (s *ModerationService) writeLog(ctx context.Context, report *models.Report, moderatorId primitive.ObjectID, action models.ModerationAction, note string, now time.Time) error {
+	_, err := s.logCollection().InsertOne(ctx, models.ModerationLogEntry{
+		ID:           primitive.NewObjectID(),
+		WorkspaceID:  report.WorkspaceID,
+		ReportID:     report.ID,
+		ModeratorID:  moderatorId,
+		Action:       action,
+		TargetUserID: report.ReportedUserID,
+		Note:         note,
+		CreatedAt:    now,
+	})
+	return err
+}
+
+func (s *ModerationService) inTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := s.reportCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+func writeReport(w http.ResponseWriter, message string, report *models.Report) {
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: message,
+		Status:  http.StatusOK,
+		Data:    report,
+	})
+}
@@ -0,0 +1,284 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ModerationService struct {
+	reportCollection       *mongo.Collection
+	messageCollection      *mongo.Collection
+	conversationCollection *mongo.Collection
+	userCollection         *mongo.Collection
+}
+
+func NewModerationService(reportCollection *mongo.Collection, messageCollection *mongo.Collection, conversationCollection *mongo.Collection, userCollection *mongo.Collection) *ModerationService {
+	return &ModerationService{
+		reportCollection:       reportCollection,
+		messageCollection:      messageCollection,
+		conversationCollection: conversationCollection,
+		userCollection:         userCollection,
+	}
+}
+
+// logCollection holds the audit trail of moderator decisions.
+func (s *ModerationService) logCollection() *mongo.Collection {
+	return s.reportCollection.Database().Collection("moderation_log")
+}
+
+// PendingReportIndex allows one unresolved report per reporter and target.
+func PendingReportIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{{Key: "reporterId", Value: 1}, {Key: "targetId", Value: 1}},
+		Options: options.Index().
+			SetName("reporterId_targetId_pending").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"pending": true}),
+	}
+}
+
+func (s *ModerationService) EnsureIndexes(ctx context.Context) error {
+	// Replaced by the unique pending index on the same keys
+	if _, err := s.reportCollection.Indexes().DropOne(ctx, "reporterId_targetId"); err != nil && !isIndexNotFound(err) {
+		return err
+	}
+
+	_, err := s.reportCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("status_createdAt"),
+		},
+		PendingReportIndex(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.logCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "reportId", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("reportId_createdAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "workspaceId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("workspaceId_createdAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "moderatorId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("moderatorId_createdAt"),
+		},
+	})
+	return err
+}
+
+// isIndexNotFound reports whether dropping an index failed because it, or its
+// collection, doesn't exist.
+func isIndexNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && (commandErr.Code == 27 || commandErr.Code == 26)
+}
+
+// RegisterReportRoutes mounts the endpoint every user files reports through.
+func (s *ModerationService) RegisterReportRoutes(router *mux.Router) {
+	router.HandleFunc("", utils.WithJwtAuth(s.createReport)).Methods(http.MethodPost)
+}
+
+// RegisterRoutes mounts the moderation queue for moderators and admins. The
+// audit trail across all reports is for admins only.
+func (s *ModerationService) RegisterRoutes(router *mux.Router) {
+	staff := func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return utils.WithJwtAuth(utils.WithRole(handlerFunc, types.RoleModerator, types.RoleAdmin))
+	}
+
+	router.HandleFunc("/reports", staff(s.listReports)).Methods(http.MethodGet)
+	router.HandleFunc("/reports/{id}", staff(s.getReport)).Methods(http.MethodGet)
+	router.HandleFunc("/reports/{id}/claim", staff(s.claimReport)).Methods(http.MethodPost)
+	router.HandleFunc("/reports/{id}/release", staff(s.releaseReport)).Methods(http.MethodPost)
+	router.HandleFunc("/reports/{id}/resolve", staff(s.resolveReport)).Methods(http.MethodPost)
+	router.HandleFunc("/log", utils.WithJwtAuth(utils.WithRole(s.listLog, types.RoleAdmin))).Methods(http.MethodGet)
+}
+
+// listReports is the moderation queue, oldest first. Without a status it holds
+// every report not resolved yet, claimed=me narrows it to the caller's claims.
+func (s *ModerationService) listReports(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	params := r.URL.Query()
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := tenant.Scope(ctx, bson.M{"status": bson.M{"$ne": models.ReportStatusResolved}})
+	switch status := models.ReportStatus(params.Get("status")); status {
+	case "":
+	case models.ReportStatusOpen, models.ReportStatusClaimed, models.ReportStatusResolved:
+		filter["status"] = status
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Status not valid")
+		return
+	}
+
+	if params.Get("claimed") == "me" {
+		userIdObject, _ := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+		filter["claimedBy"] = userIdObject
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := s.reportCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reports := []models.Report{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := len(reports) > limit
+	if hasMore {
+		reports = reports[:limit]
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.ReportListResponse{
+			Results: reports,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
+
+func (s *ModerationService) getReport(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	report, ok := s.findReport(w, r)
+	if !ok {
+		return
+	}
+
+	cursor, err := s.logCollection().Find(ctx,
+		bson.M{"reportId": report.ID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	history := []models.ModerationLogEntry{}
+	if err := cursor.All(ctx, &history); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    models.ReportDetail{Report: *report, History: history},
+	})
+}
+
+// listLog pages through the workspace's audit trail newest first, optionally for
+// one moderator.
+func (s *ModerationService) listLog(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	params := r.URL.Query()
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := tenant.Filter(ctx)
+	if moderatorId := params.Get("moderatorId"); moderatorId != "" {
+		moderatorIdObject, err := primitive.ObjectIDFromHex(moderatorId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Moderator ID not valid")
+			return
+		}
+		filter["moderatorId"] = moderatorIdObject
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := s.logCollection().Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	entries := []models.ModerationLogEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.ModerationLogResponse{
+			Results: entries,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
+
+func (s *ModerationService) findReport(w http.ResponseWriter, r *http.Request) (*models.Report, bool) {
+	var ctx = r.Context()
+
+	reportIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Report ID not valid")
+		return nil, false
+	}
+
+	var report models.Report
+	err = s.reportCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": reportIdObject})).Decode(&report)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Report not found")
+		return nil, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	return &report, true
+}
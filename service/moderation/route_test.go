@@ -0,0 +1,329 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestModerationService(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		moderationService := NewModerationService(testDB.Database.Collection("reports"), testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, moderationService.EnsureIndexes(context.Background()))
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		reporter, _ := testDB.CreateTestUser("reporter@example.com", "reporter", "Reporter")
+		spammer, _ := testDB.CreateTestUser("spammer@example.com", "spammer", "Spammer")
+		outsider, _ := testDB.CreateTestUser("outsider@example.com", "outsider", "Outsider")
+		moderator, _ := testDB.CreateTestUser("moderator@example.com", "moderator", "Moderator")
+		other, _ := testDB.CreateTestUser("other@example.com", "othermod", "Other Moderator")
+		admin, _ := testDB.CreateTestUser("admin@example.com", "admin", "Admin")
+		testDB.UserCol.UpdateByID(context.Background(), moderator.ID, bson.M{"$set": bson.M{"role": types.RoleModerator}})
+
+		spam, _ := testDB.CreateTestMessage(spammer.ID, reporter.ID, "Buy cheap followers")
+		conversation, _ := testDB.CreateTestConversation([]primitive.ObjectID{spammer.ID, reporter.ID}, []primitive.ObjectID{spam.ID})
+
+		router := mux.NewRouter()
+		moderationService.RegisterReportRoutes(router.PathPrefix("/reports").Subrouter())
+		moderationService.RegisterRoutes(router.PathPrefix("/moderation").Subrouter())
+
+		roles := map[primitive.ObjectID]types.Role{moderator.ID: types.RoleModerator, other.ID: types.RoleModerator, admin.ID: types.RoleAdmin}
+		do := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+			token, _ := utils.GenerateJWTWithClaims(utils.Claims{ID: user.ID.Hex(), Email: user.Email, Role: roles[user.ID]})
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		report := func(user *models.User, body string) (*httptest.ResponseRecorder, primitive.ObjectID) {
+			w := do(user, http.MethodPost, "/reports", body)
+			var response struct {
+				Data primitive.ObjectID `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return w, response.Data
+		}
+		detail := func(reportId primitive.ObjectID) models.ReportDetail {
+			var response struct {
+				Data models.ReportDetail `json:"data"`
+			}
+			json.Unmarshal(do(moderator, http.MethodGet, "/moderation/reports/"+reportId.Hex(), "").Body.Bytes(), &response)
+			return response.Data
+		}
+		queue := func(query string) []models.Report {
+			var response struct {
+				Data models.ReportListResponse `json:"data"`
+			}
+			json.Unmarshal(do(moderator, http.MethodGet, "/moderation/reports"+query, "").Body.Bytes(), &response)
+			return response.Data.Results
+		}
+
+		var messageReport, userReport primitive.ObjectID
+
+		t.Run("Report a message", func(t *testing.T) {
+			w, id := report(reporter, `{"targetType": "message", "targetId": "`+spam.ID.Hex()+`", "reason": "spam", "details": "  keeps sending this  "}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			messageReport = id
+
+			stored := detail(messageReport).Report
+			assert.Equal(t, models.ReportStatusOpen, stored.Status)
+			assert.Equal(t, spammer.ID, stored.ReportedUserID)
+			assert.Equal(t, "keeps sending this", stored.Details)
+			assert.Equal(t, "Buy cheap followers", stored.Snapshot.Message.Message)
+			assert.Equal(t, "spammer", stored.Snapshot.User.Username)
+		})
+
+		t.Run("Reports are validated", func(t *testing.T) {
+			w, _ := report(reporter, `{"targetType": "message", "targetId": "`+spam.ID.Hex()+`", "reason": "spam"}`)
+			assert.Equal(t, http.StatusConflict, w.Code)
+
+			w, _ = report(outsider, `{"targetType": "message", "targetId": "`+spam.ID.Hex()+`", "reason": "spam"}`)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			w, _ = report(spammer, `{"targetType": "message", "targetId": "`+spam.ID.Hex()+`", "reason": "spam"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			w, _ = report(reporter, `{"targetType": "message", "targetId": "`+spam.ID.Hex()+`", "reason": "boring"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			w, _ = report(reporter, `{"targetType": "user", "targetId": "`+reporter.ID.Hex()+`", "reason": "other"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Report a user", func(t *testing.T) {
+			w, id := report(outsider, `{"targetType": "user", "targetId": "`+spammer.ID.Hex()+`", "reason": "impersonation"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			userReport = id
+
+			stored := detail(userReport).Report
+			assert.Nil(t, stored.Snapshot.Message)
+			assert.Equal(t, spammer.ID, stored.Snapshot.User.ID)
+		})
+
+		t.Run("Only staff see the queue", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(reporter, http.MethodGet, "/moderation/reports", "").Code)
+			assert.Len(t, queue(""), 2)
+			assert.Equal(t, messageReport, queue("")[0].ID)
+		})
+
+		t.Run("Claims keep moderators apart", func(t *testing.T) {
+			w := do(moderator, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/resolve", `{"action": "dismiss"}`)
+			assert.Equal(t, http.StatusConflict, w.Code)
+
+			w = do(moderator, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/claim", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			w = do(moderator, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/claim", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			w = do(other, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/claim", "")
+			assert.Equal(t, http.StatusConflict, w.Code)
+			w = do(other, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/resolve", `{"action": "dismiss"}`)
+			assert.Equal(t, http.StatusConflict, w.Code)
+			w = do(other, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/release", "")
+			assert.Equal(t, http.StatusConflict, w.Code)
+
+			assert.Len(t, queue("?claimed=me"), 1)
+			assert.Len(t, queue("?status=open"), 1)
+		})
+
+		t.Run("Deleting the message keeps the evidence", func(t *testing.T) {
+			w := do(moderator, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/resolve", `{"action": "delete_message", "note": "Obvious spam"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"_id": spam.ID})
+			assert.Equal(t, int64(0), count)
+
+			var stored models.Conversation
+			testDB.ConvCol.FindOne(context.Background(), bson.M{"_id": conversation.ID}).Decode(&stored)
+			assert.NotContains(t, stored.Messages, spam.ID)
+			assert.Len(t, recorder.Events("message-removed"), 2)
+
+			resolved := detail(messageReport)
+			assert.Equal(t, models.ReportStatusResolved, resolved.Report.Status)
+			assert.Equal(t, models.ModerationActionDeleteMessage, resolved.Report.Resolution)
+			assert.Equal(t, "Buy cheap followers", resolved.Report.Snapshot.Message.Message)
+
+			assert.Len(t, resolved.History, 2)
+			assert.Equal(t, models.ModerationActionClaim, resolved.History[0].Action)
+			assert.Equal(t, models.ModerationActionDeleteMessage, resolved.History[1].Action)
+			assert.Equal(t, "Obvious spam", resolved.History[1].Note)
+
+			w = do(moderator, http.MethodPost, "/moderation/reports/"+messageReport.Hex()+"/claim", "")
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+
+		t.Run("Suspend the reported user", func(t *testing.T) {
+			w := do(other, http.MethodPost, "/moderation/reports/"+userReport.Hex()+"/claim", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			w = do(other, http.MethodPost, "/moderation/reports/"+userReport.Hex()+"/resolve", `{"action": "delete_message"}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			// Suspension reaches every workspace, moderators can't take it
+			w = do(other, http.MethodPost, "/moderation/reports/"+userReport.Hex()+"/resolve", `{"action": "suspend_user"}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			// Admins can hand a claim back to the queue
+			w = do(admin, http.MethodPost, "/moderation/reports/"+userReport.Hex()+"/release", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			do(admin, http.MethodPost, "/moderation/reports/"+userReport.Hex()+"/claim", "")
+
+			w = do(admin, http.MethodPost, "/moderation/reports/"+userReport.Hex()+"/resolve", `{"action": "suspend_user"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var user models.User
+			testDB.UserCol.FindOne(context.Background(), bson.M{"_id": spammer.ID}).Decode(&user)
+			assert.False(t, user.IsActive)
+			assert.Empty(t, queue(""))
+		})
+
+		t.Run("Staff can't be suspended", func(t *testing.T) {
+			_, id := report(reporter, `{"targetType": "user", "targetId": "`+moderator.ID.Hex()+`", "reason": "harassment"}`)
+			do(admin, http.MethodPost, "/moderation/reports/"+id.Hex()+"/claim", "")
+
+			w := do(admin, http.MethodPost, "/moderation/reports/"+id.Hex()+"/resolve", `{"action": "suspend_user"}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+
+		t.Run("Staff can't moderate reports they are part of", func(t *testing.T) {
+			_, about := report(reporter, `{"targetType": "user", "targetId": "`+other.ID.Hex()+`", "reason": "harassment"}`)
+			assert.Equal(t, http.StatusForbidden, do(other, http.MethodPost, "/moderation/reports/"+about.Hex()+"/claim", "").Code)
+
+			_, filed := report(other, `{"targetType": "user", "targetId": "`+outsider.ID.Hex()+`", "reason": "spam"}`)
+			assert.Equal(t, http.StatusForbidden, do(other, http.MethodPost, "/moderation/reports/"+filed.Hex()+"/claim", "").Code)
+
+			// A claim made before is no way around it
+			testDB.Database.Collection("reports").UpdateByID(context.Background(), filed, bson.M{"$set": bson.M{"status": models.ReportStatusClaimed, "claimedBy": other.ID}})
+			assert.Equal(t, http.StatusForbidden, do(other, http.MethodPost, "/moderation/reports/"+filed.Hex()+"/resolve", `{"action": "dismiss"}`).Code)
+		})
+
+		t.Run("Admins read the audit trail", func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, do(moderator, http.MethodGet, "/moderation/log", "").Code)
+
+			var response struct {
+				Data models.ModerationLogResponse `json:"data"`
+			}
+			w := do(admin, http.MethodGet, "/moderation/log?moderatorId="+moderator.ID.Hex(), "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.Len(t, response.Data.Results, 2)
+			assert.Equal(t, models.ModerationActionDeleteMessage, response.Data.Results[0].Action)
+
+			// Release, claim and suspend, then the claim of the report on a moderator
+			json.Unmarshal(do(admin, http.MethodGet, "/moderation/log?moderatorId="+admin.ID.Hex(), "").Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 4)
+			assert.Equal(t, models.ModerationActionSuspendUser, response.Data.Results[1].Action)
+		})
+
+		t.Run("Resolved reports can be filed again", func(t *testing.T) {
+			assert.Equal(t, models.ReportStatusResolved, detail(userReport).Report.Status)
+
+			w, _ := report(outsider, `{"targetType": "user", "targetId": "`+spammer.ID.Hex()+`", "reason": "impersonation"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			w, _ = report(outsider, `{"targetType": "user", "targetId": "`+spammer.ID.Hex()+`", "reason": "spam"}`)
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+	})
+}
+
+func TestModerationService_Workspaces(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		reportCol := testDB.Database.Collection("reports")
+		moderationService := NewModerationService(reportCol, testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, moderationService.EnsureIndexes(context.Background()))
+
+		reporter, _ := testDB.CreateTestUser("reporter@example.com", "reporter", "Reporter")
+		target, _ := testDB.CreateTestUser("target@example.com", "target", "Target")
+		moderator, _ := testDB.CreateTestUser("moderator@example.com", "moderator", "Moderator")
+		admin, _ := testDB.CreateTestUser("admin@example.com", "admin", "Admin")
+
+		router := mux.NewRouter()
+		moderationService.RegisterRoutes(router.PathPrefix("/moderation").Subrouter())
+
+		roles := map[primitive.ObjectID]types.Role{moderator.ID: types.RoleModerator, admin.ID: types.RoleAdmin}
+		do := func(user *models.User, workspaceID primitive.ObjectID, method, path string) *httptest.ResponseRecorder {
+			claims := utils.Claims{ID: user.ID.Hex(), Email: user.Email, Role: roles[user.ID]}
+			if !workspaceID.IsZero() {
+				claims.WorkspaceID = workspaceID.Hex()
+			}
+			token, _ := utils.GenerateJWTWithClaims(claims)
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		workspaceA, workspaceB := primitive.NewObjectID(), primitive.NewObjectID()
+		fileReport := func(workspaceID primitive.ObjectID) models.Report {
+			now := time.Now()
+			report := models.Report{
+				ID:             primitive.NewObjectID(),
+				WorkspaceID:    workspaceID,
+				TargetType:     models.ReportTargetUser,
+				TargetID:       primitive.NewObjectID(),
+				ReportedUserID: target.ID,
+				ReporterID:     reporter.ID,
+				Reason:         models.ReportReasonSpam,
+				Status:         models.ReportStatusOpen,
+				Pending:        true,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			reportCol.InsertOne(context.Background(), report)
+			return report
+		}
+		inA, inB := fileReport(workspaceA), fileReport(workspaceB)
+
+		t.Run("The queue only holds the workspace's reports", func(t *testing.T) {
+			var response struct {
+				Data models.ReportListResponse `json:"data"`
+			}
+			json.Unmarshal(do(moderator, workspaceA, http.MethodGet, "/moderation/reports").Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 1)
+			assert.Equal(t, inA.ID, response.Data.Results[0].ID)
+
+			json.Unmarshal(do(moderator, primitive.NilObjectID, http.MethodGet, "/moderation/reports").Body.Bytes(), &response)
+			assert.Empty(t, response.Data.Results)
+		})
+
+		t.Run("Reports of another workspace can't be opened or claimed", func(t *testing.T) {
+			assert.Equal(t, http.StatusNotFound, do(moderator, workspaceA, http.MethodGet, "/moderation/reports/"+inB.ID.Hex()).Code)
+			assert.Equal(t, http.StatusNotFound, do(moderator, workspaceA, http.MethodPost, "/moderation/reports/"+inB.ID.Hex()+"/claim").Code)
+		})
+
+		t.Run("The audit trail is kept per workspace", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(moderator, workspaceA, http.MethodPost, "/moderation/reports/"+inA.ID.Hex()+"/claim").Code)
+
+			var response struct {
+				Data models.ModerationLogResponse `json:"data"`
+			}
+			json.Unmarshal(do(admin, workspaceA, http.MethodGet, "/moderation/log").Body.Bytes(), &response)
+			assert.Len(t, response.Data.Results, 1)
+			assert.Equal(t, workspaceA, response.Data.Results[0].WorkspaceID)
+
+			json.Unmarshal(do(admin, workspaceB, http.MethodGet, "/moderation/log").Body.Bytes(), &response)
+			assert.Empty(t, response.Data.Results)
+		})
+	})
+}
@@ -0,0 +1,474 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// typingTimeout tells clients when to drop a typing indicator that never got a stop signal.
+const typingTimeout = 6 * time.Second
+
+var errConversationNotFound = errors.New("Conversation not found")
+
+type PresenceService struct {
+	userCollection         *mongo.Collection
+	conversationCollection *mongo.Collection
+	store                  *Store
+}
+
+func NewPresenceService(userCollection *mongo.Collection, conversationCollection *mongo.Collection, ttl time.Duration) *PresenceService {
+	return &PresenceService{
+		userCollection:         userCollection,
+		conversationCollection: conversationCollection,
+		store:                  NewStore(userCollection.Database().Collection("presence"), ttl),
+	}
+}
+
+func (s *PresenceService) EnsureIndexes(ctx context.Context) error {
+	return s.store.EnsureIndexes(ctx)
+}
+
+func (s *PresenceService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("", utils.WithJwtAuth(s.getPresence)).Methods(http.MethodGet)
+	router.HandleFunc("/heartbeat", utils.WithJwtAuth(s.heartbeat)).Methods(http.MethodPost)
+	router.HandleFunc("/typing", utils.WithJwtAuth(s.typing)).Methods(http.MethodPost)
+	router.HandleFunc("/settings", utils.WithJwtAuth(s.updateSettings)).Methods(http.MethodPut)
+}
+
+// Run expires presence of clients that stopped sending heartbeats until ctx is done.
+func (s *PresenceService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.store.Expire(ctx)
+			if err != nil {
+				log.Printf("failed to expire presence: %v", err)
+			}
+			for _, userId := range expired {
+				if err := s.markOffline(ctx, userId); err != nil {
+					log.Printf("failed to expire presence of %s: %v", userId, err)
+				}
+			}
+		}
+	}
+}
+
+func (s *PresenceService) getPresence(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userId := ctx.Value(types.ContextKeyUserID).(string)
+
+	param := r.URL.Query().Get("userIds")
+	if param == "" {
+		utils.WriteError(w, http.StatusBadRequest, "userIds is required")
+		return
+	}
+
+	ids := strings.Split(param, ",")
+	if len(ids) > 100 {
+		utils.WriteError(w, http.StatusBadRequest, "At most 100 users can be queried")
+		return
+	}
+
+	userIds := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		userIdObject, err := primitive.ObjectIDFromHex(strings.TrimSpace(id))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "User ID not valid")
+			return
+		}
+		userIds = append(userIds, userIdObject)
+	}
+
+	filter, err := s.visibleFilter(ctx, userId, userIds)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	opts := options.Find().SetProjection(bson.M{"lastSeenAt": 1, "hideLastSeen": 1})
+	cursor, err := s.userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hexIds := make([]string, 0, len(users))
+	for _, user := range users {
+		hexIds = append(hexIds, user.ID.Hex())
+	}
+
+	statuses, err := s.store.GetMany(ctx, hexIds)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	presences := make([]models.Presence, 0, len(users))
+	for _, user := range users {
+		presence := models.Presence{
+			UserID: user.ID,
+			Status: statuses[user.ID.Hex()],
+		}
+		if !user.HideLastSeen || user.ID.Hex() == userId {
+			presence.LastSeenAt = user.LastSeenAt
+		}
+		presences = append(presences, presence)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    presences,
+	})
+}
+
+func (s *PresenceService) heartbeat(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userId := ctx.Value(types.ContextKeyUserID).(string)
+
+	var payload models.PresenceHeartbeatPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.setStatus(ctx, userId, payload.Status); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status, err := s.store.Get(ctx, userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    map[string]interface{}{"status": status, "ttl": s.store.ttl.Seconds()},
+	})
+}
+
+func (s *PresenceService) typing(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.TypingPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversationIdObject, err := primitive.ObjectIDFromHex(payload.ConversationID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.sendTyping(ctx, userIdObject, conversationIdObject, payload.Typing)
+	if err == errConversationNotFound {
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+	})
+}
+
+func (s *PresenceService) updateSettings(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.PresenceSettingsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = s.userCollection.UpdateByID(ctx, userIdObject, bson.M{
+		"$set": bson.M{"hideLastSeen": *payload.HideLastSeen, "updatedAt": time.Now()},
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    payload,
+	})
+}
+
+// HandleHeartbeatEvent refreshes presence from a client event relayed by the realtime webhook.
+func (s *PresenceService) HandleHeartbeatEvent(ctx context.Context, userId string, data []byte) error {
+	var payload models.PresenceHeartbeatPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		return err
+	}
+
+	return s.setStatus(ctx, userId, payload.Status)
+}
+
+// HandleTypingEvent relays a typing signal sent as a client event on the user's channel.
+func (s *PresenceService) HandleTypingEvent(ctx context.Context, userId string, data []byte) error {
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	var payload models.TypingPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		return err
+	}
+
+	conversationIdObject, err := primitive.ObjectIDFromHex(payload.ConversationID)
+	if err != nil {
+		return err
+	}
+
+	return s.sendTyping(ctx, userIdObject, conversationIdObject, payload.Typing)
+}
+
+// HandleChannelVacated marks a user offline as soon as their last connection is gone.
+func (s *PresenceService) HandleChannelVacated(ctx context.Context, userId string) error {
+	return s.setStatus(ctx, userId, models.PresenceOffline)
+}
+
+func (s *PresenceService) setStatus(ctx context.Context, userId string, status models.PresenceStatus) error {
+	if status == "" {
+		status = models.PresenceOnline
+	}
+
+	if status == models.PresenceOffline {
+		removed, err := s.store.Remove(ctx, userId)
+		if err != nil || !removed {
+			return err
+		}
+		return s.markOffline(ctx, userId)
+	}
+
+	changed, err := s.store.Touch(ctx, userId, status)
+	if err != nil || !changed {
+		return err
+	}
+
+	return s.publishPresence(ctx, userId, status, nil)
+}
+
+// markOffline persists the last-seen time and tells the user's contacts they left.
+func (s *PresenceService) markOffline(ctx context.Context, userId string) error {
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	lastSeenAt := time.Now()
+	_, err = s.userCollection.UpdateByID(ctx, userIdObject, bson.M{
+		"$set": bson.M{"lastSeenAt": lastSeenAt},
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.publishPresence(ctx, userId, models.PresenceOffline, &lastSeenAt)
+}
+
+// visibleFilter matches those of userIds whose presence userId may see in the
+// request's workspace: in a named workspace its members, in the default one the
+// user themselves and anyone they share a conversation with.
+func (s *PresenceService) visibleFilter(ctx context.Context, userId string, userIds []primitive.ObjectID) (bson.M, error) {
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tenant.FromContext(ctx).IsZero() {
+		members, err := tenant.UserFilter(ctx, s.userCollection.Database())
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$and": bson.A{bson.M{"_id": bson.M{"$in": userIds}}, members}}, nil
+	}
+
+	contacts, err := s.conversationCollection.Distinct(ctx, "participants", tenant.Scope(ctx, bson.M{
+		"participants": bson.M{"$all": bson.A{userIdObject}, "$in": userIds},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	visible := map[primitive.ObjectID]bool{userIdObject: true}
+	for _, contact := range contacts {
+		visible[contact.(primitive.ObjectID)] = true
+	}
+
+	allowed := make([]primitive.ObjectID, 0, len(userIds))
+	for _, id := range userIds {
+		if visible[id] {
+			allowed = append(allowed, id)
+		}
+	}
+
+	return bson.M{"_id": bson.M{"$in": allowed}}, nil
+}
+
+func (s *PresenceService) publishPresence(ctx context.Context, userId string, status models.PresenceStatus, lastSeenAt *time.Time) error {
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"hideLastSeen": 1})
+	if err := s.userCollection.FindOne(ctx, bson.M{"_id": userIdObject}, opts).Decode(&user); err != nil {
+		return err
+	}
+
+	presence := models.Presence{UserID: userIdObject, Status: status}
+	if !user.HideLastSeen {
+		presence.LastSeenAt = lastSeenAt
+	}
+
+	contacts, err := s.contacts(ctx, userIdObject)
+	if err != nil {
+		return err
+	}
+
+	for _, contactId := range contacts {
+		realtime.Publish(realtime.UserChannel(contactId.Hex()), "presence-changed", presence)
+	}
+
+	return nil
+}
+
+// contacts returns everyone sharing a conversation with userId in the default
+// workspace or a workspace userId still belongs to. Status changes also come from
+// the background sweep, so this covers every workspace rather than the request's.
+func (s *PresenceService) contacts(ctx context.Context, userId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	workspaceIds, err := s.userCollection.Database().Collection(tenant.MemberCollection).Distinct(ctx, "workspaceId", bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	if workspaceIds == nil {
+		workspaceIds = bson.A{}
+	}
+
+	participants, err := s.conversationCollection.Distinct(ctx, "participants", bson.M{
+		"participants": userId,
+		"$or": bson.A{
+			bson.M{"workspaceId": bson.M{"$exists": false}},
+			bson.M{"workspaceId": bson.M{"$in": workspaceIds}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := make([]primitive.ObjectID, 0, len(participants))
+	for _, participant := range participants {
+		if participantId := participant.(primitive.ObjectID); participantId != userId {
+			contacts = append(contacts, participantId)
+		}
+	}
+
+	return contacts, nil
+}
+
+func (s *PresenceService) sendTyping(ctx context.Context, userId primitive.ObjectID, conversationId primitive.ObjectID, typing bool) error {
+	var conversation models.Conversation
+	err := s.conversationCollection.FindOne(ctx, bson.M{"_id": conversationId, "participants": userId}).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return errConversationNotFound
+	} else if err != nil {
+		return err
+	}
+
+	event := models.TypingEvent{
+		ConversationID: conversation.ID,
+		UserID:         userId,
+		Typing:         typing,
+		ExpiresAt:      time.Now().Add(typingTimeout),
+	}
+
+	for _, participant := range conversation.Participants {
+		if participant != userId {
+			realtime.Publish(realtime.UserChannel(participant.Hex()), "typing", event)
+		}
+	}
+
+	return nil
+}
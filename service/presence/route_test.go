@@ -0,0 +1,271 @@
+package presence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func withUser(req *http.Request, userID primitive.ObjectID) *http.Request {
+	ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+	return req.WithContext(ctx)
+}
+
+func TestPresenceService_Heartbeat(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		presenceService := NewPresenceService(testDB.UserCol, testDB.ConvCol, time.Minute)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, nil)
+
+		heartbeat := func(status models.PresenceStatus) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(models.PresenceHeartbeatPayload{Status: status})
+			req := withUser(httptest.NewRequest(http.MethodPost, "/heartbeat", bytes.NewBuffer(body)), user1.ID)
+
+			w := httptest.NewRecorder()
+			presenceService.heartbeat(w, req)
+			return w
+		}
+
+		t.Run("Going online notifies contacts", func(t *testing.T) {
+			w := heartbeat("")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			status, _ := presenceService.store.Get(context.Background(), user1.ID.Hex())
+			assert.Equal(t, models.PresenceOnline, status)
+
+			events := recorder.Events("presence-changed")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user2.ID.Hex()), events[0].Channel)
+		})
+
+		t.Run("Repeated heartbeats do not publish", func(t *testing.T) {
+			heartbeat(models.PresenceOnline)
+
+			assert.Len(t, recorder.Events("presence-changed"), 1)
+		})
+
+		t.Run("Going offline persists last seen", func(t *testing.T) {
+			w := heartbeat(models.PresenceOffline)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var user models.User
+			testDB.UserCol.FindOne(context.Background(), bson.M{"_id": user1.ID}).Decode(&user)
+			assert.NotNil(t, user.LastSeenAt)
+
+			events := recorder.Events("presence-changed")
+			assert.Len(t, events, 2)
+			assert.Equal(t, models.PresenceOffline, events[1].Data.(models.Presence).Status)
+			assert.NotNil(t, events[1].Data.(models.Presence).LastSeenAt)
+		})
+
+		t.Run("Channel vacated marks the user offline", func(t *testing.T) {
+			heartbeat(models.PresenceAway)
+
+			err := presenceService.HandleChannelVacated(context.Background(), user1.ID.Hex())
+			assert.NoError(t, err)
+			status, _ := presenceService.store.Get(context.Background(), user1.ID.Hex())
+			assert.Equal(t, models.PresenceOffline, status)
+		})
+
+		t.Run("Contacts are notified in the user's workspaces only", func(t *testing.T) {
+			user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+			user4, _ := testDB.CreateTestUser("user4@example.com", "user4", "User Four")
+
+			member, former := primitive.NewObjectID(), primitive.NewObjectID()
+			testDB.Database.Collection(tenant.MemberCollection).InsertOne(context.Background(), bson.M{"workspaceId": member, "userId": user1.ID})
+			testDB.ConvCol.InsertOne(context.Background(), models.Conversation{ID: primitive.NewObjectID(), WorkspaceID: member, Participants: []primitive.ObjectID{user1.ID, user3.ID}})
+			testDB.ConvCol.InsertOne(context.Background(), models.Conversation{ID: primitive.NewObjectID(), WorkspaceID: former, Participants: []primitive.ObjectID{user1.ID, user4.ID}})
+
+			before := len(recorder.Events("presence-changed"))
+			heartbeat(models.PresenceOnline)
+
+			channels := make([]string, 0)
+			for _, event := range recorder.Events("presence-changed")[before:] {
+				channels = append(channels, event.Channel)
+			}
+			assert.ElementsMatch(t, []string{
+				realtime.UserChannel(user2.ID.Hex()),
+				realtime.UserChannel(user3.ID.Hex()),
+			}, channels)
+		})
+
+		t.Run("Invalid status", func(t *testing.T) {
+			w := heartbeat("busy")
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
+
+func TestPresenceService_GetPresence(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		presenceService := NewPresenceService(testDB.UserCol, testDB.ConvCol, time.Minute)
+		_, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+		testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, nil)
+
+		lastSeen := time.Now().Add(-time.Hour)
+		testDB.UserCol.UpdateByID(context.Background(), user2.ID, bson.M{"$set": bson.M{"lastSeenAt": lastSeen, "hideLastSeen": true}})
+		presenceService.store.Touch(context.Background(), user1.ID.Hex(), models.PresenceOnline)
+		presenceService.store.Touch(context.Background(), user3.ID.Hex(), models.PresenceOnline)
+
+		getPresenceIn := func(workspaceId primitive.ObjectID, query string) []interface{} {
+			req := withUser(httptest.NewRequest(http.MethodGet, "/?userIds="+query, nil), user1.ID)
+			req = req.WithContext(tenant.WithWorkspace(req.Context(), workspaceId))
+
+			w := httptest.NewRecorder()
+			presenceService.getPresence(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data.([]interface{})
+		}
+		getPresence := func(query string) []interface{} {
+			return getPresenceIn(primitive.NilObjectID, query)
+		}
+
+		t.Run("Returns status and hides last seen when requested", func(t *testing.T) {
+			presences := getPresence(user1.ID.Hex() + "," + user2.ID.Hex())
+			assert.Len(t, presences, 2)
+
+			for _, p := range presences {
+				presence := p.(map[string]interface{})
+				if presence["userId"] == user1.ID.Hex() {
+					assert.Equal(t, "online", presence["status"])
+				} else {
+					assert.Equal(t, "offline", presence["status"])
+					assert.NotContains(t, presence, "lastSeenAt")
+				}
+			}
+		})
+
+		t.Run("Users without a shared conversation or workspace are left out", func(t *testing.T) {
+			presences := getPresence(user2.ID.Hex() + "," + user3.ID.Hex())
+			assert.Len(t, presences, 1)
+			assert.Equal(t, user2.ID.Hex(), presences[0].(map[string]interface{})["userId"])
+		})
+
+		t.Run("Workspace members are visible inside that workspace only", func(t *testing.T) {
+			workspaceId := primitive.NewObjectID()
+			members := testDB.Database.Collection(tenant.MemberCollection)
+			members.InsertOne(context.Background(), bson.M{"workspaceId": workspaceId, "userId": user1.ID})
+			members.InsertOne(context.Background(), bson.M{"workspaceId": workspaceId, "userId": user3.ID})
+
+			presences := getPresenceIn(workspaceId, user3.ID.Hex())
+			assert.Len(t, presences, 1)
+			assert.Equal(t, "online", presences[0].(map[string]interface{})["status"])
+
+			assert.Empty(t, getPresence(user3.ID.Hex()))
+
+			// The direct chat with user2 lives in the default workspace
+			presences = getPresenceIn(workspaceId, user2.ID.Hex()+","+user3.ID.Hex())
+			assert.Len(t, presences, 1)
+			assert.Equal(t, user3.ID.Hex(), presences[0].(map[string]interface{})["userId"])
+		})
+
+		t.Run("Invalid user ID", func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodGet, "/?userIds=invalid", nil), user1.ID)
+
+			w := httptest.NewRecorder()
+			presenceService.getPresence(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
+
+func TestPresenceService_Typing(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		presenceService := NewPresenceService(testDB.UserCol, testDB.ConvCol, time.Minute)
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+		conv, _ := testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, nil)
+
+		typing := func(userID primitive.ObjectID, payload models.TypingPayload) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(payload)
+			req := withUser(httptest.NewRequest(http.MethodPost, "/typing", bytes.NewBuffer(body)), userID)
+
+			w := httptest.NewRecorder()
+			presenceService.typing(w, req)
+			return w
+		}
+
+		t.Run("Typing is relayed to the other participants", func(t *testing.T) {
+			w := typing(user1.ID, models.TypingPayload{ConversationID: conv.ID.Hex(), Typing: true})
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			events := recorder.Events("typing")
+			assert.Len(t, events, 1)
+			assert.Equal(t, realtime.UserChannel(user2.ID.Hex()), events[0].Channel)
+			assert.True(t, events[0].Data.(models.TypingEvent).Typing)
+		})
+
+		t.Run("Typing over the realtime channel", func(t *testing.T) {
+			data, _ := json.Marshal(models.TypingPayload{ConversationID: conv.ID.Hex(), Typing: false})
+
+			err := presenceService.HandleTypingEvent(context.Background(), user2.ID.Hex(), data)
+			assert.NoError(t, err)
+
+			events := recorder.Events("typing")
+			assert.Len(t, events, 2)
+			assert.Equal(t, realtime.UserChannel(user1.ID.Hex()), events[1].Channel)
+		})
+
+		t.Run("Non participant cannot signal typing", func(t *testing.T) {
+			w := typing(user3.ID, models.TypingPayload{ConversationID: conv.ID.Hex(), Typing: true})
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	})
+}
+
+func TestPresenceService_UpdateSettings(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		presenceService := NewPresenceService(testDB.UserCol, testDB.ConvCol, time.Minute)
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+
+		body := bytes.NewBufferString(`{"hideLastSeen": true}`)
+		req := withUser(httptest.NewRequest(http.MethodPut, "/settings", body), user1.ID)
+
+		w := httptest.NewRecorder()
+		presenceService.updateSettings(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var user models.User
+		testDB.UserCol.FindOne(context.Background(), bson.M{"_id": user1.ID}).Decode(&user)
+		assert.True(t, user.HideLastSeen)
+
+		req = withUser(httptest.NewRequest(http.MethodPut, "/settings", bytes.NewBufferString(`{}`)), user1.ID)
+		w = httptest.NewRecorder()
+		presenceService.updateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
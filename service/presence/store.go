@@ -0,0 +1,138 @@
+package presence
+
+import (
+	"context"
+	"lite-chat-go/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// expiredGrace is how long Mongo keeps an expired entry before its TTL monitor
+// removes it. Expire normally gets to it first, the TTL only cleans up after
+// instances that went away.
+const expiredGrace = 5 * time.Minute
+
+type entry struct {
+	UserID    string                `bson:"_id"`
+	Status    models.PresenceStatus `bson:"status"`
+	ExpiresAt time.Time             `bson:"expiresAt"`
+}
+
+// Store keeps presence in Mongo so every API instance sees the same state;
+// entries not refreshed within the TTL are expired.
+type Store struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+func NewStore(collection *mongo.Collection, ttl time.Duration) *Store {
+	return &Store{
+		collection: collection,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(int32(expiredGrace.Seconds())),
+	})
+	return err
+}
+
+// Touch refreshes a user's presence and reports whether their status changed.
+func (s *Store) Touch(ctx context.Context, userId string, status models.PresenceStatus) (bool, error) {
+	var previous entry
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userId},
+		bson.M{"$set": bson.M{"status": status, "expiresAt": s.now().Add(s.ttl)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return previous.Status != status, nil
+}
+
+func (s *Store) Get(ctx context.Context, userId string) (models.PresenceStatus, error) {
+	statuses, err := s.GetMany(ctx, []string{userId})
+	if err != nil {
+		return "", err
+	}
+	return statuses[userId], nil
+}
+
+// GetMany returns the status of every user, offline for those not tracked.
+func (s *Store) GetMany(ctx context.Context, userIds []string) (map[string]models.PresenceStatus, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"_id":       bson.M{"$in": userIds},
+		"expiresAt": bson.M{"$gt": s.now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]models.PresenceStatus, len(userIds))
+	for _, userId := range userIds {
+		statuses[userId] = models.PresenceOffline
+	}
+	for _, e := range entries {
+		statuses[e.UserID] = e.Status
+	}
+
+	return statuses, nil
+}
+
+// Remove drops a user's presence and reports whether they were tracked.
+func (s *Store) Remove(ctx context.Context, userId string) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": userId})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+// Expire drops every entry past its TTL and returns the affected users. Each
+// entry is deleted conditionally, so when several instances sweep at once only
+// one of them reports a user.
+func (s *Store) Expire(ctx context.Context) ([]string, error) {
+	cursor, err := s.collection.Find(ctx,
+		bson.M{"expiresAt": bson.M{"$lte": s.now()}},
+		options.Find().SetSort(bson.D{{Key: "expiresAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	expired := make([]string, 0)
+	for _, e := range entries {
+		result, err := s.collection.DeleteOne(ctx, bson.M{"_id": e.UserID, "expiresAt": e.ExpiresAt})
+		if err != nil {
+			return expired, err
+		}
+		if result.DeletedCount > 0 {
+			expired = append(expired, e.UserID)
+		}
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,82 @@
+package presence
+
+import (
+	"context"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		store := NewStore(testDB.Database.Collection("presence"), time.Minute)
+		store.now = func() time.Time { return now }
+
+		get := func(userId string) models.PresenceStatus {
+			status, err := store.Get(ctx, userId)
+			assert.NoError(t, err)
+			return status
+		}
+
+		expire := func() []string {
+			expired, err := store.Expire(ctx)
+			assert.NoError(t, err)
+			return expired
+		}
+
+		t.Run("Unknown users are offline", func(t *testing.T) {
+			assert.Equal(t, models.PresenceOffline, get("nobody"))
+		})
+
+		t.Run("Touch reports status changes only", func(t *testing.T) {
+			changed, _ := store.Touch(ctx, "user-1", models.PresenceOnline)
+			assert.True(t, changed)
+			changed, _ = store.Touch(ctx, "user-1", models.PresenceOnline)
+			assert.False(t, changed)
+			changed, _ = store.Touch(ctx, "user-1", models.PresenceAway)
+			assert.True(t, changed)
+			assert.Equal(t, models.PresenceAway, get("user-1"))
+		})
+
+		t.Run("Entries expire after the TTL", func(t *testing.T) {
+			store.Touch(ctx, "user-2", models.PresenceOnline)
+			now = now.Add(30 * time.Second)
+			store.Touch(ctx, "user-1", models.PresenceAway)
+
+			now = now.Add(45 * time.Second)
+			assert.Equal(t, models.PresenceOffline, get("user-2"))
+			assert.Equal(t, models.PresenceAway, get("user-1"))
+			assert.Equal(t, []string{"user-2"}, expire())
+
+			now = now.Add(time.Minute)
+			assert.Equal(t, []string{"user-1"}, expire())
+			assert.Empty(t, expire())
+		})
+
+		t.Run("Stores sharing a collection see the same presence", func(t *testing.T) {
+			other := NewStore(testDB.Database.Collection("presence"), time.Minute)
+			other.now = store.now
+
+			other.Touch(ctx, "user-4", models.PresenceOnline)
+			assert.Equal(t, models.PresenceOnline, get("user-4"))
+
+			now = now.Add(2 * time.Minute)
+			assert.Equal(t, []string{"user-4"}, expire())
+			expired, _ := other.Expire(ctx)
+			assert.Empty(t, expired)
+		})
+
+		t.Run("Remove reports whether the user was tracked", func(t *testing.T) {
+			store.Touch(ctx, "user-3", models.PresenceOnline)
+			removed, _ := store.Remove(ctx, "user-3")
+			assert.True(t, removed)
+			removed, _ = store.Remove(ctx, "user-3")
+			assert.False(t, removed)
+		})
+	})
+}
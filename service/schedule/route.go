@@ -0,0 +1,207 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MessageSender is the normal send pipeline due messages are delivered through.
+type MessageSender interface {
+	SendMessage(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, text string, clientMessageId string) (*models.Message, bool, error)
+	SendToConversation(ctx context.Context, senderId primitive.ObjectID, conversationId primitive.ObjectID, text string, clientMessageId string) (*models.Message, bool, error)
+}
+
+type ScheduleService struct {
+	scheduledCollection *mongo.Collection
+	sender              MessageSender
+	instanceId          string
+	leaseDuration       time.Duration
+}
+
+func NewScheduleService(scheduledCollection *mongo.Collection, sender MessageSender, instanceId string) *ScheduleService {
+	return &ScheduleService{
+		scheduledCollection: scheduledCollection,
+		sender:              sender,
+		instanceId:          instanceId,
+		leaseDuration:       defaultLeaseDuration,
+	}
+}
+
+func (s *ScheduleService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/scheduled", utils.WithJwtAuth(s.listScheduled)).Methods(http.MethodGet)
+	router.HandleFunc("/scheduled/{id}", utils.WithJwtAuth(s.updateScheduled)).Methods(http.MethodPut)
+	router.HandleFunc("/scheduled/{id}", utils.WithJwtAuth(s.cancelScheduled)).Methods(http.MethodDelete)
+}
+
+func (s *ScheduleService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.scheduledCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "scheduledAt", Value: 1}},
+			Options: options.Index().SetName("status_scheduledAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "senderId", Value: 1}, {Key: "status", Value: 1}, {Key: "scheduledAt", Value: 1}},
+			Options: options.Index().SetName("senderId_status_scheduledAt"),
+		},
+	})
+
+	return err
+}
+
+// Schedule persists a direct message for later delivery by the background scheduler.
+func (s *ScheduleService) Schedule(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, text string, scheduledAt time.Time) (*models.ScheduledMessage, error) {
+	return s.schedule(ctx, models.ScheduledMessage{SenderID: senderId, ReceiverID: receiverId, Message: text, ScheduledAt: scheduledAt})
+}
+
+// ScheduleInConversation is Schedule for a group, channel or existing direct conversation.
+func (s *ScheduleService) ScheduleInConversation(ctx context.Context, senderId primitive.ObjectID, conversationId primitive.ObjectID, text string, scheduledAt time.Time) (*models.ScheduledMessage, error) {
+	return s.schedule(ctx, models.ScheduledMessage{SenderID: senderId, ConversationID: conversationId, Message: text, ScheduledAt: scheduledAt})
+}
+
+func (s *ScheduleService) schedule(ctx context.Context, scheduled models.ScheduledMessage) (*models.ScheduledMessage, error) {
+	now := time.Now()
+	scheduled.ID = primitive.NewObjectID()
+	scheduled.WorkspaceID = tenant.FromContext(ctx)
+	scheduled.Status = models.ScheduledMessagePending
+	scheduled.CreatedAt = now
+	scheduled.UpdatedAt = now
+
+	if _, err := s.scheduledCollection.InsertOne(ctx, scheduled); err != nil {
+		return nil, err
+	}
+
+	return &scheduled, nil
+}
+
+func (s *ScheduleService) listScheduled(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	filter := tenant.Scope(ctx, bson.M{"senderId": userIdObject, "status": models.ScheduledMessagePending})
+	opts := options.Find().SetSort(bson.D{{Key: "scheduledAt", Value: 1}})
+
+	cursor, err := s.scheduledCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	scheduled := make([]models.ScheduledMessage, 0)
+	if err := cursor.All(ctx, &scheduled); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    scheduled,
+	})
+}
+
+func (s *ScheduleService) updateScheduled(w http.ResponseWriter, r *http.Request) {
+	var payload models.UpdateScheduledMessagePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	if payload.Message != nil {
+		set["message"] = *payload.Message
+	}
+	if payload.ScheduledAt != nil {
+		if !payload.ScheduledAt.After(time.Now()) {
+			utils.WriteError(w, http.StatusBadRequest, "scheduledAt must be in the future")
+			return
+		}
+		set["scheduledAt"] = *payload.ScheduledAt
+	}
+
+	s.modifyPending(w, r, bson.M{"$set": set}, "Scheduled message updated")
+}
+
+func (s *ScheduleService) cancelScheduled(w http.ResponseWriter, r *http.Request) {
+	update := bson.M{"$set": bson.M{"status": models.ScheduledMessageCancelled, "updatedAt": time.Now()}}
+	s.modifyPending(w, r, update, "Scheduled message cancelled")
+}
+
+// modifyPending applies an update to one of the caller's pending messages unless
+// an instance currently holds its delivery lease.
+func (s *ScheduleService) modifyPending(w http.ResponseWriter, r *http.Request, update bson.M, message string) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	idObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Scheduled message ID not valid")
+		return
+	}
+
+	var existing models.ScheduledMessage
+	err = s.scheduledCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": idObject, "senderId": userIdObject})).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Scheduled message not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if existing.Status != models.ScheduledMessagePending {
+		utils.WriteError(w, http.StatusConflict, "Scheduled message is no longer pending")
+		return
+	}
+
+	filter := tenant.Scope(ctx, bson.M{
+		"_id":    idObject,
+		"status": models.ScheduledMessagePending,
+		"$or":    leaseFree(time.Now()),
+	})
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.ScheduledMessage
+	err = s.scheduledCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusConflict, "Scheduled message is being delivered")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: message,
+		Status:  http.StatusOK,
+		Data:    updated,
+	})
+}
@@ -0,0 +1,310 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/realtime"
+	"lite-chat-go/service/message"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type failingSender struct {
+	err   error
+	calls int
+}
+
+func (f *failingSender) SendMessage(ctx context.Context, senderId primitive.ObjectID, receiverId primitive.ObjectID, text string, clientMessageId string) (*models.Message, bool, error) {
+	f.calls++
+	return nil, false, f.err
+}
+
+func (f *failingSender) SendToConversation(ctx context.Context, senderId primitive.ObjectID, conversationId primitive.ObjectID, text string, clientMessageId string) (*models.Message, bool, error) {
+	f.calls++
+	return nil, false, f.err
+}
+
+func TestScheduleService_DeliverDue(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		recorder, restore := realtime.UseRecorder()
+		defer restore()
+
+		scheduledCol := testDB.Database.Collection("scheduled_messages")
+		messageService := message.NewMessageService(testDB.MsgCol, testDB.ConvCol, testDB.UserCol)
+		assert.NoError(t, messageService.EnsureIndexes(context.Background()))
+
+		instanceA := NewScheduleService(scheduledCol, messageService, "instance-a")
+		instanceB := NewScheduleService(scheduledCol, messageService, "instance-b")
+		assert.NoError(t, instanceA.EnsureIndexes(context.Background()))
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+
+		t.Run("Due messages are sent through the normal pipeline", func(t *testing.T) {
+			due, _ := instanceA.Schedule(context.Background(), user1.ID, user2.ID, "Happy birthday!", time.Now().Add(-time.Second))
+			instanceA.Schedule(context.Background(), user1.ID, user2.ID, "Not yet", time.Now().Add(time.Hour))
+
+			delivered, err := instanceA.DeliverDue(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, delivered)
+
+			var scheduled models.ScheduledMessage
+			scheduledCol.FindOne(context.Background(), bson.M{"_id": due.ID}).Decode(&scheduled)
+			assert.Equal(t, models.ScheduledMessageSent, scheduled.Status)
+			assert.NotNil(t, scheduled.MessageID)
+
+			var sent models.Message
+			err = testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": *scheduled.MessageID}).Decode(&sent)
+			assert.NoError(t, err)
+			assert.Equal(t, "Happy birthday!", sent.Message)
+			assert.Len(t, recorder.Events("upcoming-message"), 2)
+		})
+
+		t.Run("A leased message is not delivered by another instance", func(t *testing.T) {
+			scheduled, _ := instanceA.Schedule(context.Background(), user1.ID, user2.ID, "Once only", time.Now().Add(-time.Second))
+
+			claimed, err := instanceA.claimNext(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, scheduled.ID, claimed.ID)
+
+			delivered, err := instanceB.DeliverDue(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 0, delivered)
+
+			assert.NoError(t, instanceA.deliver(context.Background(), claimed))
+		})
+
+		t.Run("Expired leases are taken over without duplicating the message", func(t *testing.T) {
+			scheduled, _ := instanceA.Schedule(context.Background(), user1.ID, user2.ID, "Crash recovery", time.Now().Add(-time.Second))
+
+			claimed, _ := instanceA.claimNext(context.Background())
+			// Instance A sends but dies before recording the result
+			messageService.SendMessage(context.Background(), user1.ID, user2.ID, claimed.Message, "scheduled-"+claimed.ID.Hex())
+			scheduledCol.UpdateByID(context.Background(), scheduled.ID, bson.M{"$set": bson.M{"leaseExpiresAt": time.Now().Add(-time.Second)}})
+
+			delivered, err := instanceB.DeliverDue(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, delivered)
+
+			count, _ := testDB.MsgCol.CountDocuments(context.Background(), bson.M{"message": "Crash recovery"})
+			assert.Equal(t, int64(1), count)
+		})
+
+		t.Run("Group messages are delivered to their conversation", func(t *testing.T) {
+			now := time.Now()
+			group := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				Type:         models.ConversationTypeGroup,
+				Name:         "Standup",
+				OwnerID:      &user1.ID,
+				Admins:       []primitive.ObjectID{user1.ID},
+				Participants: []primitive.ObjectID{user1.ID, user2.ID},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			testDB.ConvCol.InsertOne(context.Background(), group)
+
+			due, _ := instanceA.ScheduleInConversation(context.Background(), user1.ID, group.ID, "Standup in 5", now.Add(-time.Second))
+
+			delivered, err := instanceA.DeliverDue(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, delivered)
+
+			var scheduled models.ScheduledMessage
+			scheduledCol.FindOne(context.Background(), bson.M{"_id": due.ID}).Decode(&scheduled)
+			assert.Equal(t, models.ScheduledMessageSent, scheduled.Status)
+
+			var sent models.Message
+			testDB.MsgCol.FindOne(context.Background(), bson.M{"_id": *scheduled.MessageID}).Decode(&sent)
+			assert.Equal(t, group.ID, sent.ConversationID)
+		})
+
+		t.Run("Permanent failures are not retried", func(t *testing.T) {
+			sender := &failingSender{err: message.ErrUserNotFound}
+			failing := NewScheduleService(scheduledCol, sender, "instance-c")
+			scheduled, _ := failing.Schedule(context.Background(), user1.ID, primitive.NewObjectID(), "Gone", time.Now().Add(-time.Second))
+
+			failing.DeliverDue(context.Background())
+
+			var stored models.ScheduledMessage
+			scheduledCol.FindOne(context.Background(), bson.M{"_id": scheduled.ID}).Decode(&stored)
+			assert.Equal(t, models.ScheduledMessageFailed, stored.Status)
+			assert.NotEmpty(t, stored.LastError)
+		})
+
+		t.Run("Transient failures back off", func(t *testing.T) {
+			sender := &failingSender{err: errors.New("connection reset")}
+			failing := NewScheduleService(scheduledCol, sender, "instance-d")
+			scheduled, _ := failing.Schedule(context.Background(), user1.ID, user2.ID, "Retry me", time.Now().Add(-time.Second))
+
+			failing.DeliverDue(context.Background())
+			failing.DeliverDue(context.Background())
+			assert.Equal(t, 1, sender.calls)
+
+			var stored models.ScheduledMessage
+			scheduledCol.FindOne(context.Background(), bson.M{"_id": scheduled.ID}).Decode(&stored)
+			assert.Equal(t, models.ScheduledMessagePending, stored.Status)
+			assert.Equal(t, 1, stored.Attempts)
+		})
+	})
+}
+
+func TestScheduleService_Routes(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		scheduledCol := testDB.Database.Collection("scheduled_messages")
+		scheduleService := NewScheduleService(scheduledCol, &failingSender{}, "instance-a")
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/scheduled", scheduleService.listScheduled).Methods(http.MethodGet)
+		router.HandleFunc("/scheduled/{id}", scheduleService.updateScheduled).Methods(http.MethodPut)
+		router.HandleFunc("/scheduled/{id}", scheduleService.cancelScheduled).Methods(http.MethodDelete)
+
+		serve := func(method, path string, body []byte, userID primitive.ObjectID) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		first, _ := scheduleService.Schedule(context.Background(), user1.ID, user2.ID, "First", time.Now().Add(time.Hour))
+		second, _ := scheduleService.Schedule(context.Background(), user1.ID, user2.ID, "Second", time.Now().Add(2*time.Hour))
+
+		t.Run("List pending scheduled messages", func(t *testing.T) {
+			w := serve(http.MethodGet, "/scheduled", nil, user1.ID)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response types.CustomSuccessResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			scheduled := response.Data.([]interface{})
+			assert.Len(t, scheduled, 2)
+			assert.Equal(t, first.ID.Hex(), scheduled[0].(map[string]interface{})["_id"])
+		})
+
+		t.Run("Edit text and time", func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{
+				"message":     "Edited",
+				"scheduledAt": time.Now().Add(3 * time.Hour),
+			})
+			w := serve(http.MethodPut, "/scheduled/"+first.ID.Hex(), body, user1.ID)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var stored models.ScheduledMessage
+			scheduledCol.FindOne(context.Background(), bson.M{"_id": first.ID}).Decode(&stored)
+			assert.Equal(t, "Edited", stored.Message)
+			assert.True(t, stored.ScheduledAt.After(second.ScheduledAt))
+		})
+
+		t.Run("Edit to a past time is rejected", func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{"scheduledAt": time.Now().Add(-time.Hour)})
+			w := serve(http.MethodPut, "/scheduled/"+first.ID.Hex(), body, user1.ID)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		t.Run("Other users cannot touch the message", func(t *testing.T) {
+			w := serve(http.MethodDelete, "/scheduled/"+first.ID.Hex(), nil, user2.ID)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Cancel removes it from the pending list", func(t *testing.T) {
+			w := serve(http.MethodDelete, "/scheduled/"+second.ID.Hex(), nil, user1.ID)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			w = serve(http.MethodDelete, "/scheduled/"+second.ID.Hex(), nil, user1.ID)
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+
+		t.Run("Leased messages cannot be edited", func(t *testing.T) {
+			scheduledCol.UpdateByID(context.Background(), first.ID, bson.M{"$set": bson.M{
+				"leaseOwner":     "instance-b",
+				"leaseExpiresAt": time.Now().Add(time.Minute),
+			}})
+
+			body, _ := json.Marshal(map[string]interface{}{"message": "Too late"})
+			w := serve(http.MethodPut, "/scheduled/"+first.ID.Hex(), body, user1.ID)
+
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+	})
+}
+
+func TestScheduleService_WorkspaceIsolation(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		scheduledCol := testDB.Database.Collection("scheduled_messages")
+		scheduleService := NewScheduleService(scheduledCol, &failingSender{}, "instance-a")
+
+		user1, _ := testDB.CreateTestUser("sender@example.com", "sender", "Sender User")
+		user2, _ := testDB.CreateTestUser("receiver@example.com", "receiver", "Receiver User")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/scheduled", scheduleService.listScheduled).Methods(http.MethodGet)
+		router.HandleFunc("/scheduled/{id}", scheduleService.updateScheduled).Methods(http.MethodPut)
+		router.HandleFunc("/scheduled/{id}", scheduleService.cancelScheduled).Methods(http.MethodDelete)
+
+		serve := func(workspaceID primitive.ObjectID, method, path string, body []byte) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user1.ID.Hex())
+			req = req.WithContext(tenant.WithWorkspace(ctx, workspaceID))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		list := func(workspaceID primitive.ObjectID) []models.ScheduledMessage {
+			var response struct {
+				Data []models.ScheduledMessage `json:"data"`
+			}
+			json.Unmarshal(serve(workspaceID, http.MethodGet, "/scheduled", nil).Body.Bytes(), &response)
+			return response.Data
+		}
+
+		workspaceA, workspaceB := primitive.NewObjectID(), primitive.NewObjectID()
+		inA, _ := scheduleService.Schedule(tenant.WithWorkspace(context.Background(), workspaceA), user1.ID, user2.ID, "For A", time.Now().Add(time.Hour))
+		inB, _ := scheduleService.Schedule(tenant.WithWorkspace(context.Background(), workspaceB), user1.ID, user2.ID, "For B", time.Now().Add(time.Hour))
+
+		t.Run("Each workspace lists its own scheduled messages", func(t *testing.T) {
+			listed := list(workspaceA)
+			assert.Len(t, listed, 1)
+			assert.Equal(t, inA.ID, listed[0].ID)
+
+			listed = list(workspaceB)
+			assert.Len(t, listed, 1)
+			assert.Equal(t, inB.ID, listed[0].ID)
+
+			assert.Empty(t, list(primitive.NilObjectID))
+		})
+
+		t.Run("Messages of another workspace can't be edited or cancelled", func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{"message": "Moved"})
+			assert.Equal(t, http.StatusNotFound, serve(workspaceA, http.MethodPut, "/scheduled/"+inB.ID.Hex(), body).Code)
+			assert.Equal(t, http.StatusNotFound, serve(workspaceA, http.MethodDelete, "/scheduled/"+inB.ID.Hex(), nil).Code)
+
+			var stored models.ScheduledMessage
+			scheduledCol.FindOne(context.Background(), bson.M{"_id": inB.ID}).Decode(&stored)
+			assert.Equal(t, "For B", stored.Message)
+			assert.Equal(t, models.ScheduledMessagePending, stored.Status)
+		})
+	})
+}
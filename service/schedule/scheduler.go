@@ -0,0 +1,138 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"lite-chat-go/models"
+	"lite-chat-go/service/message"
+	"lite-chat-go/tenant"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultLeaseDuration = 30 * time.Second
+	retryBackoff         = 30 * time.Second
+	maxAttempts          = 5
+)
+
+// Run delivers due messages every interval until ctx is done.
+func (s *ScheduleService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DeliverDue(ctx); err != nil {
+				log.Printf("failed to deliver scheduled messages: %v", err)
+			}
+		}
+	}
+}
+
+// DeliverDue claims and sends every due message and returns how many were sent.
+func (s *ScheduleService) DeliverDue(ctx context.Context) (int, error) {
+	delivered := 0
+
+	for {
+		scheduled, err := s.claimNext(ctx)
+		if err == mongo.ErrNoDocuments {
+			return delivered, nil
+		} else if err != nil {
+			return delivered, err
+		}
+
+		if err := s.deliver(ctx, scheduled); err != nil {
+			log.Printf("failed to deliver scheduled message %s: %v", scheduled.ID.Hex(), err)
+			continue
+		}
+		delivered++
+	}
+}
+
+// claimNext atomically takes the lease of the oldest due message so that only
+// one instance delivers it; expired leases of crashed instances are taken over.
+func (s *ScheduleService) claimNext(ctx context.Context) (*models.ScheduledMessage, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":      models.ScheduledMessagePending,
+		"scheduledAt": bson.M{"$lte": now},
+		"$or":         leaseFree(now),
+	}
+
+	update := bson.M{
+		"$set": bson.M{"leaseOwner": s.instanceId, "leaseExpiresAt": now.Add(s.leaseDuration)},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "scheduledAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var scheduled models.ScheduledMessage
+	if err := s.scheduledCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&scheduled); err != nil {
+		return nil, err
+	}
+
+	return &scheduled, nil
+}
+
+func (s *ScheduleService) deliver(ctx context.Context, scheduled *models.ScheduledMessage) error {
+	owned := bson.M{"_id": scheduled.ID, "leaseOwner": s.instanceId}
+
+	// The scheduled ID doubles as idempotency key, so a retry after a crash
+	// between sending and recording success returns the original message
+	sendCtx, clientMessageId := tenant.WithWorkspace(ctx, scheduled.WorkspaceID), "scheduled-"+scheduled.ID.Hex()
+
+	var sent *models.Message
+	var err error
+	if scheduled.ConversationID.IsZero() {
+		sent, _, err = s.sender.SendMessage(sendCtx, scheduled.SenderID, scheduled.ReceiverID, scheduled.Message, clientMessageId)
+	} else {
+		sent, _, err = s.sender.SendToConversation(sendCtx, scheduled.SenderID, scheduled.ConversationID, scheduled.Message, clientMessageId)
+	}
+	if err != nil {
+		set := bson.M{"lastError": err.Error(), "updatedAt": time.Now()}
+		if permanentFailure(err) || scheduled.Attempts >= maxAttempts {
+			set["status"] = models.ScheduledMessageFailed
+		} else {
+			// Keep the lease until the backoff elapses so the next attempt waits
+			set["leaseExpiresAt"] = time.Now().Add(retryBackoff)
+		}
+
+		if _, updateErr := s.scheduledCollection.UpdateOne(ctx, owned, bson.M{"$set": set}); updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+
+	_, err = s.scheduledCollection.UpdateOne(ctx, owned, bson.M{
+		"$set": bson.M{
+			"status":    models.ScheduledMessageSent,
+			"messageId": sent.ID,
+			"updatedAt": time.Now(),
+		},
+		"$unset": bson.M{"leaseOwner": "", "leaseExpiresAt": "", "lastError": ""},
+	})
+
+	return err
+}
+
+func permanentFailure(err error) bool {
+	return errors.Is(err, message.ErrUserNotFound) || errors.Is(err, message.ErrInvalidReceiver) || errors.Is(err, message.ErrBlocked) ||
+		errors.Is(err, message.ErrConversationNotFound) || errors.Is(err, message.ErrCannotPost)
+}
+
+func leaseFree(now time.Time) bson.A {
+	return bson.A{
+		bson.M{"leaseExpiresAt": bson.M{"$exists": false}},
+		bson.M{"leaseExpiresAt": bson.M{"$lte": now}},
+	}
+}
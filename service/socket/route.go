@@ -0,0 +1,156 @@
+package socket
+
+import (
+	"context"
+	"io"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// ClientEventHandler processes a client event a user sent on their own private channel.
+type ClientEventHandler func(ctx context.Context, userId string, data []byte) error
+
+// ChannelEventHandler processes a lifecycle event (e.g. channel_vacated) of a user's private channel.
+type ChannelEventHandler func(ctx context.Context, userId string) error
+
+// ChannelAuthorizer decides whether a user may subscribe to a channel that isn't their own.
+type ChannelAuthorizer func(ctx context.Context, userId string, channel string) (bool, error)
+
+type SocketService struct {
+	clientEventHandlers  map[string]ClientEventHandler
+	channelEventHandlers map[string]ChannelEventHandler
+	authorizers          []ChannelAuthorizer
+}
+
+func NewSocketService() *SocketService {
+	return &SocketService{
+		clientEventHandlers:  make(map[string]ClientEventHandler),
+		channelEventHandlers: make(map[string]ChannelEventHandler),
+	}
+}
+
+func (s *SocketService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/auth", utils.WithJwtAuth(s.authorizeChannel)).Methods(http.MethodPost)
+	router.HandleFunc("/webhook", s.handleWebhook).Methods(http.MethodPost)
+}
+
+// OnClientEvent registers the handler invoked when Pusher relays the named client event.
+func (s *SocketService) OnClientEvent(eventName string, handler ClientEventHandler) {
+	s.clientEventHandlers[eventName] = handler
+}
+
+// OnChannelEvent registers the handler invoked for a channel lifecycle webhook on a user channel.
+func (s *SocketService) OnChannelEvent(name string, handler ChannelEventHandler) {
+	s.channelEventHandlers[name] = handler
+}
+
+// AddAuthorizer lets another service grant access to its own private channels.
+func (s *SocketService) AddAuthorizer(authorizer ChannelAuthorizer) {
+	s.authorizers = append(s.authorizers, authorizer)
+}
+
+func (s *SocketService) authorizeChannel(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(types.ContextKeyUserID).(string)
+
+	params, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	values, err := url.ParseQuery(string(params))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	allowed, err := s.canSubscribe(r.Context(), userId, values.Get("channel_name"))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, "Access Denied")
+		return
+	}
+
+	response, err := realtime.Pusher.AuthorizePrivateChannel(params)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Content-Type", "Application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+func (s *SocketService) canSubscribe(ctx context.Context, userId string, channel string) (bool, error) {
+	if channel == realtime.UserChannel(userId) {
+		return true, nil
+	}
+
+	for _, authorizer := range s.authorizers {
+		allowed, err := authorizer(ctx, userId, channel)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	return false, nil
+}
+
+func (s *SocketService) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhook, err := realtime.Pusher.Webhook(r.Header, body)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	for _, event := range webhook.Events {
+		// Only the channel owner can subscribe to a user channel, so it identifies the sender
+		userId, ok := realtime.UserIDFromChannel(event.Channel)
+		if !ok {
+			continue
+		}
+
+		if event.Name != "client_event" {
+			if handler, ok := s.channelEventHandlers[event.Name]; ok {
+				if err := handler(ctx, userId); err != nil {
+					log.Printf("failed to handle %s for %s: %v", event.Name, userId, err)
+				}
+			}
+			continue
+		}
+
+		handler, ok := s.clientEventHandlers[event.Event]
+		if !ok {
+			continue
+		}
+
+		if err := handler(ctx, userId, []byte(event.Data)); err != nil {
+			log.Printf("failed to handle %s from %s: %v", event.Event, userId, err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+	})
+}
@@ -0,0 +1,162 @@
+package socket
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"lite-chat-go/realtime"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func signedWebhookRequest(body []byte) *http.Request {
+	mac := hmac.New(sha256.New, []byte(realtime.Pusher.Secret))
+	mac.Write(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBuffer(body))
+	req.Header.Set("X-Pusher-Key", realtime.Pusher.Key)
+	req.Header.Set("X-Pusher-Signature", hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestSocketService_HandleWebhook(t *testing.T) {
+	realtime.Pusher.Key = "test-pusher-key"
+	realtime.Pusher.Secret = "test-pusher-secret"
+
+	socketService := NewSocketService()
+
+	var receivedUser string
+	var receivedData []byte
+	socketService.OnClientEvent("client-message-delivered", func(ctx context.Context, userId string, data []byte) error {
+		receivedUser = userId
+		receivedData = data
+		return nil
+	})
+
+	t.Run("Dispatches client events to the registered handler", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"time_ms": 1,
+			"events": []map[string]string{
+				{
+					"name":    "client_event",
+					"channel": realtime.UserChannel("user-1"),
+					"event":   "client-message-delivered",
+					"data":    `{"messageIds":["abc"]}`,
+				},
+			},
+		})
+
+		w := httptest.NewRecorder()
+		socketService.handleWebhook(w, signedWebhookRequest(body))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user-1", receivedUser)
+		assert.JSONEq(t, `{"messageIds":["abc"]}`, string(receivedData))
+	})
+
+	t.Run("Ignores events outside user channels", func(t *testing.T) {
+		receivedUser = ""
+		body, _ := json.Marshal(map[string]interface{}{
+			"time_ms": 1,
+			"events": []map[string]string{
+				{
+					"name":    "client_event",
+					"channel": realtime.BroadcastChannel,
+					"event":   "client-message-delivered",
+					"data":    `{}`,
+				},
+			},
+		})
+
+		w := httptest.NewRecorder()
+		socketService.handleWebhook(w, signedWebhookRequest(body))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, receivedUser)
+	})
+
+	t.Run("Dispatches channel lifecycle events", func(t *testing.T) {
+		var vacated string
+		socketService.OnChannelEvent("channel_vacated", func(ctx context.Context, userId string) error {
+			vacated = userId
+			return nil
+		})
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"time_ms": 1,
+			"events": []map[string]string{
+				{"name": "channel_vacated", "channel": realtime.UserChannel("user-2")},
+			},
+		})
+
+		w := httptest.NewRecorder()
+		socketService.handleWebhook(w, signedWebhookRequest(body))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user-2", vacated)
+	})
+
+	t.Run("Rejects unsigned webhooks", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"events":[]}`))
+		req.Header.Set("X-Pusher-Key", realtime.Pusher.Key)
+		req.Header.Set("X-Pusher-Signature", "deadbeef")
+
+		w := httptest.NewRecorder()
+		socketService.handleWebhook(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestSocketService_AuthorizeChannel(t *testing.T) {
+	realtime.Pusher.Key = "test-pusher-key"
+	realtime.Pusher.Secret = "test-pusher-secret"
+
+	socketService := NewSocketService()
+
+	authorize := func(userId, channel string) *httptest.ResponseRecorder {
+		body := "socket_id=123.456&channel_name=" + channel
+		req := httptest.NewRequest(http.MethodPost, "/auth", strings.NewReader(body))
+		ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userId)
+		req = req.WithContext(ctx)
+
+		w := httptest.NewRecorder()
+		socketService.authorizeChannel(w, req)
+		return w
+	}
+
+	t.Run("Authorizes the caller's own channel", func(t *testing.T) {
+		w := authorize("user-1", realtime.UserChannel("user-1"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Contains(t, response["auth"], "test-pusher-key:")
+	})
+
+	t.Run("Denies another user's channel", func(t *testing.T) {
+		w := authorize("user-1", realtime.UserChannel("user-2"))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Registered authorizers grant other channels", func(t *testing.T) {
+		socketService.AddAuthorizer(func(ctx context.Context, userId string, channel string) (bool, error) {
+			return userId == "user-1" && channel == realtime.ConversationChannel("conv-1"), nil
+		})
+
+		assert.Equal(t, http.StatusOK, authorize("user-1", realtime.ConversationChannel("conv-1")).Code)
+		assert.Equal(t, http.StatusForbidden, authorize("user-2", realtime.ConversationChannel("conv-1")).Code)
+		assert.Equal(t, http.StatusForbidden, authorize("user-1", realtime.UserChannel("user-2")).Code)
+	})
+}
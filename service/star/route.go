@@ -0,0 +1,314 @@
+package star
+
+import (
+	"context"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StarService struct {
+	starCollection         *mongo.Collection
+	messageCollection      *mongo.Collection
+	conversationCollection *mongo.Collection
+}
+
+func NewStarService(starCollection *mongo.Collection, messageCollection *mongo.Collection, conversationCollection *mongo.Collection) *StarService {
+	return &StarService{
+		starCollection:         starCollection,
+		messageCollection:      messageCollection,
+		conversationCollection: conversationCollection,
+	}
+}
+
+func (s *StarService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/starred", utils.WithJwtAuth(s.listStarred)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/star", utils.WithJwtAuth(s.starMessage)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/star", utils.WithJwtAuth(s.unstarMessage)).Methods(http.MethodDelete)
+}
+
+func (s *StarService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.starCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "messageId", Value: 1}},
+			Options: options.Index().SetName("userId_messageId").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("userId_createdAt"),
+		},
+	})
+
+	return err
+}
+
+func (s *StarService) settingsCollection() *mongo.Collection {
+	return s.messageCollection.Database().Collection("conversation_settings")
+}
+
+func (s *StarService) starMessage(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, messageIdObject, ok := parseIds(w, r)
+	if !ok {
+		return
+	}
+
+	var message models.Message
+	err := s.messageCollection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": messageIdObject})).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Only members of the message's conversation may bookmark it
+	conversationFilter, err := membership.Filter(ctx, s.conversationCollection.Database(), userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	conversationFilter["_id"] = message.ConversationID
+
+	count, err := s.conversationCollection.CountDocuments(ctx, tenant.Scope(ctx, conversationFilter))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	star := models.Star{
+		UserID:         userIdObject,
+		MessageID:      messageIdObject,
+		ConversationID: message.ConversationID,
+		CreatedAt:      time.Now(),
+	}
+
+	// Upsert keeps starring idempotent under the unique index
+	_, err = s.starCollection.UpdateOne(ctx,
+		bson.M{"userId": userIdObject, "messageId": messageIdObject},
+		bson.M{"$setOnInsert": star},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Message starred",
+		Status:  http.StatusOK,
+		Data:    nil,
+	})
+}
+
+func (s *StarService) unstarMessage(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, messageIdObject, ok := parseIds(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.starCollection.DeleteOne(ctx, bson.M{"userId": userIdObject, "messageId": messageIdObject})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.DeletedCount == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Message is not starred")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Message unstarred",
+		Status:  http.StatusOK,
+		Data:    nil,
+	})
+}
+
+func (s *StarService) listStarred(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+	params := r.URL.Query()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(params.Get("page"), params.Get("limit"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Stars stay behind in conversations of other workspaces and ones the user left
+	conversationFilter, err := membership.Filter(ctx, s.conversationCollection.Database(), userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	conversationIds, err := s.conversationCollection.Distinct(ctx, "_id", tenant.Scope(ctx, conversationFilter))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if conversationIds == nil {
+		conversationIds = bson.A{}
+	}
+
+	conversation := bson.M{"$in": conversationIds}
+	if conversationId := params.Get("conversationId"); conversationId != "" {
+		conversationIdObject, err := primitive.ObjectIDFromHex(conversationId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Conversation ID not valid")
+			return
+		}
+		conversation["$eq"] = conversationIdObject
+	}
+
+	hidden, err := s.clearedHistory(ctx, userIdObject, conversationIds)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filter := bson.M{"userId": userIdObject, "conversationId": conversation}
+	if len(hidden) > 0 {
+		// A star is never older than its message, so this drops stars on cleared history
+		filter["$nor"] = hidden
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := s.starCollection.Find(ctx, filter, opts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var stars []models.Star
+	if err := cursor.All(ctx, &stars); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hasMore := false
+	if len(stars) > limit {
+		stars = stars[:limit]
+		hasMore = true
+	}
+
+	results := make([]models.StarredMessage, 0, len(stars))
+	if len(stars) > 0 {
+		messageIds := make([]primitive.ObjectID, 0, len(stars))
+		for _, star := range stars {
+			messageIds = append(messageIds, star.MessageID)
+		}
+
+		messageFilter := tenant.Scope(ctx, bson.M{"_id": bson.M{"$in": messageIds}})
+		if len(hidden) > 0 {
+			messageFilter["$nor"] = hidden
+		}
+
+		cursor, err := s.messageCollection.Find(ctx, messageFilter)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		var messages []models.Message
+		if err := cursor.All(ctx, &messages); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		byId := make(map[primitive.ObjectID]models.Message, len(messages))
+		for _, m := range messages {
+			byId[m.ID] = m
+		}
+
+		// Stars on messages that have since expired or were cleared are skipped
+		for _, star := range stars {
+			if m, ok := byId[star.MessageID]; ok {
+				results = append(results, models.StarredMessage{StarredAt: star.CreatedAt, Message: m})
+			}
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data: models.StarredMessagesResponse{
+			Results: results,
+			Page:    page,
+			Limit:   limit,
+			HasMore: hasMore,
+		},
+	})
+}
+
+// clearedHistory matches what userId cleared in conversationIds. Stars and
+// messages both carry conversationId and createdAt, so it filters either.
+func (s *StarService) clearedHistory(ctx context.Context, userId primitive.ObjectID, conversationIds []interface{}) (bson.A, error) {
+	cursor, err := s.settingsCollection().Find(ctx, bson.M{
+		"userId":         userId,
+		"conversationId": bson.M{"$in": conversationIds},
+		"clearedAt":      bson.M{"$exists": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cleared []models.ConversationSettings
+	if err := cursor.All(ctx, &cleared); err != nil {
+		return nil, err
+	}
+
+	hidden := make(bson.A, 0, len(cleared))
+	for _, settings := range cleared {
+		hidden = append(hidden, bson.M{"conversationId": settings.ConversationID, "createdAt": bson.M{"$lte": settings.ClearedAt}})
+	}
+
+	return hidden, nil
+}
+
+func parseIds(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userIdObject, err := primitive.ObjectIDFromHex(r.Context().Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	messageIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Message ID not valid")
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return userIdObject, messageIdObject, true
+}
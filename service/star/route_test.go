@@ -0,0 +1,119 @@
+package star
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/membership"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStarService(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		starCol := testDB.Database.Collection("stars")
+		starService := NewStarService(starCol, testDB.MsgCol, testDB.ConvCol)
+		assert.NoError(t, starService.EnsureIndexes(context.Background()))
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+		user3, _ := testDB.CreateTestUser("user3@example.com", "user3", "User Three")
+
+		msg1, _ := testDB.CreateTestMessage(user1.ID, user2.ID, "First")
+		msg2, _ := testDB.CreateTestMessage(user1.ID, user3.ID, "Second")
+		testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user2.ID}, []primitive.ObjectID{msg1.ID})
+		testDB.CreateTestConversation([]primitive.ObjectID{user1.ID, user3.ID}, []primitive.ObjectID{msg2.ID})
+
+		router := mux.NewRouter()
+		router.HandleFunc("/starred", starService.listStarred).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/star", starService.starMessage).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/star", starService.unstarMessage).Methods(http.MethodDelete)
+
+		do := func(userID primitive.ObjectID, method, path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		t.Run("Star messages across conversations", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPost, "/"+msg1.ID.Hex()+"/star").Code)
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPost, "/"+msg2.ID.Hex()+"/star").Code)
+
+			// Starring again is a no-op
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPost, "/"+msg1.ID.Hex()+"/star").Code)
+
+			count, _ := starCol.CountDocuments(context.Background(), bson.M{"userId": user1.ID})
+			assert.Equal(t, int64(2), count)
+		})
+
+		t.Run("Non participant cannot star", func(t *testing.T) {
+			w := do(user3.ID, http.MethodPost, "/"+msg1.ID.Hex()+"/star")
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+
+		t.Run("Channel subscribers can star and list channel messages", func(t *testing.T) {
+			post, _ := testDB.CreateTestMessage(user2.ID, primitive.NilObjectID, "Announcement")
+			channel, _ := testDB.CreateTestConversation([]primitive.ObjectID{user2.ID}, []primitive.ObjectID{post.ID})
+			testDB.ConvCol.UpdateByID(context.Background(), channel.ID, bson.M{"$set": bson.M{"type": models.ConversationTypeChannel}})
+
+			assert.Equal(t, http.StatusNotFound, do(user3.ID, http.MethodPost, "/"+post.ID.Hex()+"/star").Code)
+
+			testDB.Database.Collection(membership.SubscriptionCollection).InsertOne(context.Background(), models.ChannelSubscription{
+				ID:        primitive.NewObjectID(),
+				ChannelID: channel.ID,
+				UserID:    user3.ID,
+				CreatedAt: time.Now(),
+			})
+
+			assert.Equal(t, http.StatusOK, do(user3.ID, http.MethodPost, "/"+post.ID.Hex()+"/star").Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(do(user3.ID, http.MethodGet, "/starred").Body.Bytes(), &response)
+			assert.Len(t, response["data"].(map[string]interface{})["results"], 1)
+		})
+
+		t.Run("Starred listing is per user and newest first", func(t *testing.T) {
+			w := do(user1.ID, http.MethodGet, "/starred?limit=1")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			data := response["data"].(map[string]interface{})
+			results := data["results"].([]interface{})
+			assert.Len(t, results, 1)
+			assert.Equal(t, true, data["hasMore"])
+			message := results[0].(map[string]interface{})["message"].(map[string]interface{})
+			assert.Equal(t, msg2.ID.Hex(), message["_id"])
+
+			w = do(user2.ID, http.MethodGet, "/starred")
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Len(t, response["data"].(map[string]interface{})["results"], 0)
+		})
+
+		t.Run("Unstar", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodDelete, "/"+msg1.ID.Hex()+"/star").Code)
+			assert.Equal(t, http.StatusNotFound, do(user1.ID, http.MethodDelete, "/"+msg1.ID.Hex()+"/star").Code)
+		})
+
+		t.Run("Invalid message id", func(t *testing.T) {
+			w := do(user1.ID, http.MethodPost, "/invalid/star")
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	})
+}
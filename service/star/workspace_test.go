@@ -0,0 +1,123 @@
+package star
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStarService_ListIsScoped(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		ctx := context.Background()
+		starCol := testDB.Database.Collection("stars")
+		starService := NewStarService(starCol, testDB.MsgCol, testDB.ConvCol)
+		assert.NoError(t, starService.EnsureIndexes(ctx))
+
+		alice, _ := testDB.CreateTestUser("alice@example.com", "alice", "Alice")
+		bob, _ := testDB.CreateTestUser("bob@example.com", "bob", "Bob")
+
+		workspaceA, workspaceB := primitive.NewObjectID(), primitive.NewObjectID()
+		members := testDB.Database.Collection(tenant.MemberCollection)
+		for _, workspace := range []primitive.ObjectID{workspaceA, workspaceB} {
+			for _, id := range []primitive.ObjectID{alice.ID, bob.ID} {
+				members.InsertOne(ctx, models.WorkspaceMember{WorkspaceID: workspace, UserID: id})
+			}
+		}
+
+		// One conversation and message per workspace, both starred by alice
+		postIn := func(workspace primitive.ObjectID, participants []primitive.ObjectID, text string) models.Message {
+			now := time.Now()
+			conversation := models.Conversation{
+				ID:           primitive.NewObjectID(),
+				WorkspaceID:  workspace,
+				Participants: participants,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			message := models.Message{
+				ID:             primitive.NewObjectID(),
+				ConversationID: conversation.ID,
+				WorkspaceID:    workspace,
+				SenderID:       bob.ID,
+				Message:        text,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			conversation.Messages = []primitive.ObjectID{message.ID}
+			testDB.ConvCol.InsertOne(ctx, conversation)
+			testDB.MsgCol.InsertOne(ctx, message)
+			return message
+		}
+		inA := postIn(workspaceA, []primitive.ObjectID{alice.ID, bob.ID}, "Plans for A")
+		inB := postIn(workspaceB, []primitive.ObjectID{alice.ID, bob.ID}, "Plans for B")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/starred", starService.listStarred).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/star", starService.starMessage).Methods(http.MethodPost)
+
+		do := func(workspaceID primitive.ObjectID, method, path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, alice.ID.Hex())
+			ctx = context.WithValue(ctx, types.ContextKeyWorkspaceID, workspaceID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		starred := func(workspaceID primitive.ObjectID) []primitive.ObjectID {
+			var response struct {
+				Data models.StarredMessagesResponse `json:"data"`
+			}
+			json.Unmarshal(do(workspaceID, http.MethodGet, "/starred").Body.Bytes(), &response)
+
+			ids := make([]primitive.ObjectID, 0, len(response.Data.Results))
+			for _, result := range response.Data.Results {
+				ids = append(ids, result.Message.ID)
+			}
+			return ids
+		}
+
+		assert.Equal(t, http.StatusOK, do(workspaceA, http.MethodPost, "/"+inA.ID.Hex()+"/star").Code)
+		assert.Equal(t, http.StatusOK, do(workspaceB, http.MethodPost, "/"+inB.ID.Hex()+"/star").Code)
+
+		t.Run("Messages of another workspace can't be starred", func(t *testing.T) {
+			assert.Equal(t, http.StatusNotFound, do(workspaceA, http.MethodPost, "/"+inB.ID.Hex()+"/star").Code)
+		})
+
+		t.Run("Each workspace lists its own stars", func(t *testing.T) {
+			assert.Equal(t, []primitive.ObjectID{inA.ID}, starred(workspaceA))
+			assert.Equal(t, []primitive.ObjectID{inB.ID}, starred(workspaceB))
+		})
+
+		t.Run("Cleared history drops its stars", func(t *testing.T) {
+			clearedAt := time.Now()
+			starService.settingsCollection().InsertOne(ctx, models.ConversationSettings{
+				UserID:         alice.ID,
+				ConversationID: inA.ConversationID,
+				ClearedAt:      &clearedAt,
+				UpdatedAt:      clearedAt,
+			})
+
+			assert.Empty(t, starred(workspaceA))
+		})
+
+		t.Run("Leaving a conversation drops its stars", func(t *testing.T) {
+			testDB.ConvCol.UpdateByID(ctx, inB.ConversationID, bson.M{"$pull": bson.M{"participants": alice.ID}})
+
+			assert.Empty(t, starred(workspaceB))
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package user
+
+import (
+	"context"
+	"lite-chat-go/blocking"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *UserService) blockCollection() *mongo.Collection {
+	return s.userCollection.Database().Collection(blocking.Collection)
+}
+
+func (s *UserService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.blockCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "blockerId", Value: 1}, {Key: "blockedId", Value: 1}},
+			Options: options.Index().SetName("blockerId_blockedId").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "blockedId", Value: 1}},
+			Options: options.Index().SetName("blockedId"),
+		},
+	})
+
+	return err
+}
+
+// listBlocked returns the users the caller blocked, most recent first.
+func (s *UserService) listBlocked(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	cursor, err := s.blockCollection().Find(ctx,
+		bson.M{"blockerId": userIdObject},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var blocks []models.Block
+	if err := cursor.All(ctx, &blocks); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	blockedIds := make([]primitive.ObjectID, 0, len(blocks))
+	for _, block := range blocks {
+		blockedIds = append(blockedIds, block.BlockedID)
+	}
+
+	cursor, err = s.userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": blockedIds}})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var found []models.UserPublic
+	if err := cursor.All(ctx, &found); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	byId := make(map[primitive.ObjectID]models.UserPublic, len(found))
+	for _, user := range found {
+		byId[user.ID] = user
+	}
+
+	users := make([]models.UserPublic, 0, len(found))
+	for _, blockedId := range blockedIds {
+		if user, ok := byId[blockedId]; ok {
+			users = append(users, user)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    users,
+	})
+}
+
+// blockUser stops the user in the path from messaging the caller and from
+// sharing groups with them. Blocking someone twice is a no-op.
+func (s *UserService) blockUser(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, blockedIdObject, ok := parseBlockIds(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := s.userCollection.CountDocuments(ctx, bson.M{"_id": blockedIdObject})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count == 0 {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	_, err = s.blockCollection().UpdateOne(ctx,
+		bson.M{"blockerId": userIdObject, "blockedId": blockedIdObject},
+		bson.M{"$setOnInsert": bson.M{"createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "User blocked",
+		Status:  http.StatusOK,
+	})
+}
+
+func (s *UserService) unblockUser(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, blockedIdObject, ok := parseBlockIds(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := s.blockCollection().DeleteOne(ctx, bson.M{"blockerId": userIdObject, "blockedId": blockedIdObject}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "User unblocked",
+		Status:  http.StatusOK,
+	})
+}
+
+func parseBlockIds(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userIdObject, err := primitive.ObjectIDFromHex(r.Context().Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	blockedIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil || blockedIdObject == userIdObject {
+		utils.WriteError(w, http.StatusBadRequest, "User ID not valid")
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return userIdObject, blockedIdObject, true
+}
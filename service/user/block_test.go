@@ -0,0 +1,71 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/blocking"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserService_Blocks(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		userService := NewUserService(testDB.UserCol)
+		assert.NoError(t, userService.EnsureIndexes(context.Background()))
+
+		user1, _ := testDB.CreateTestUser("user1@example.com", "user1", "User One")
+		user2, _ := testDB.CreateTestUser("user2@example.com", "user2", "User Two")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/blocks", userService.listBlocked).Methods(http.MethodGet)
+		router.HandleFunc("/blocks/{id}", userService.blockUser).Methods(http.MethodPut)
+		router.HandleFunc("/blocks/{id}", userService.unblockUser).Methods(http.MethodDelete)
+
+		do := func(userID primitive.ObjectID, method, path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, userID.Hex())
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		blocked := func(userID primitive.ObjectID) []interface{} {
+			var response types.CustomSuccessResponse
+			json.Unmarshal(do(userID, http.MethodGet, "/blocks").Body.Bytes(), &response)
+			return response.Data.([]interface{})
+		}
+
+		t.Run("Block works both ways", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPut, "/blocks/"+user2.ID.Hex()).Code)
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodPut, "/blocks/"+user2.ID.Hex()).Code)
+
+			assert.Len(t, blocked(user1.ID), 1)
+			assert.Empty(t, blocked(user2.ID))
+
+			between, err := blocking.Between(context.Background(), testDB.Database, user2.ID, user1.ID)
+			assert.NoError(t, err)
+			assert.True(t, between)
+		})
+
+		t.Run("Unblock", func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(user1.ID, http.MethodDelete, "/blocks/"+user2.ID.Hex()).Code)
+
+			assert.Empty(t, blocked(user1.ID))
+			between, _ := blocking.Between(context.Background(), testDB.Database, user1.ID, user2.ID)
+			assert.False(t, between)
+		})
+
+		t.Run("Yourself or an unknown user", func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, do(user1.ID, http.MethodPut, "/blocks/"+user1.ID.Hex()).Code)
+			assert.Equal(t, http.StatusNotFound, do(user1.ID, http.MethodPut, "/blocks/"+primitive.NewObjectID().Hex()).Code)
+		})
+	})
+}
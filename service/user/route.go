@@ -1,10 +1,12 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"lite-chat-go/config"
 	"lite-chat-go/models"
+	"lite-chat-go/tenant"
 	"lite-chat-go/types"
 	"lite-chat-go/utils"
 	"log"
@@ -35,10 +37,52 @@ func (s *UserService) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/register", s.handleRegister).Methods(http.MethodPost)
 	router.HandleFunc("/profile", utils.WithJwtAuth(s.profile)).Methods(http.MethodGet)
 	router.HandleFunc("/search/{query}", utils.WithJwtAuth(s.handleSearch)).Methods(http.MethodGet)
+	router.HandleFunc("/blocks", utils.WithJwtAuth(s.listBlocked)).Methods(http.MethodGet)
+	router.HandleFunc("/blocks/{id}", utils.WithJwtAuth(s.blockUser)).Methods(http.MethodPut)
+	router.HandleFunc("/blocks/{id}", utils.WithJwtAuth(s.unblockUser)).Methods(http.MethodDelete)
 	router.HandleFunc("/auth/{provider}", gothic.BeginAuthHandler)
 	router.HandleFunc("/auth/{provider}/callback", s.handleAuthProviderCallback).Methods(http.MethodGet, http.MethodPost)
 }
 
+// Account reports whether userId can still sign in, their current role and
+// whether they still belong to workspaceId. It backs utils.SetAccountCheck so a
+// deactivated account or removed member is locked out, and a changed role
+// applies, before the token expires.
+func (s *UserService) Account(ctx context.Context, userId, workspaceId string) (utils.Account, error) {
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return utils.Account{}, nil
+	}
+
+	var user models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": userIdObject}, options.FindOne().SetProjection(bson.M{"isActive": 1, "role": 1, "tokenVersion": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return utils.Account{}, nil
+	} else if err != nil {
+		return utils.Account{}, err
+	}
+
+	account := utils.Account{Active: user.IsActive, Role: user.Role, Member: true, TokenVersion: user.TokenVersion}
+	if workspaceId != "" {
+		workspaceIdObject, err := primitive.ObjectIDFromHex(workspaceId)
+		if err != nil {
+			account.Member = false
+			return account, nil
+		}
+
+		count, err := s.userCollection.Database().Collection(tenant.MemberCollection).CountDocuments(ctx, bson.M{
+			"workspaceId": workspaceIdObject,
+			"userId":      userIdObject,
+		})
+		if err != nil {
+			return utils.Account{}, err
+		}
+		account.Member = count > 0
+	}
+
+	return account, nil
+}
+
 func (s *UserService) profile(w http.ResponseWriter, r *http.Request) {
 
 	var ctx = r.Context()
@@ -99,6 +143,11 @@ func (s *UserService) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !user.IsActive {
+		utils.WriteError(w, http.StatusForbidden, "This account has been deactivated")
+		return
+	}
+
 	userPublic := models.UserPublic{
 		ID:       user.ID,
 		Fullname: user.Fullname,
@@ -107,7 +156,7 @@ func (s *UserService) handleLogin(w http.ResponseWriter, r *http.Request) {
 		Avatar:   user.Avatar,
 	}
 
-	token, err := utils.GenerateJWT(user.ID.Hex(), user.Email)
+	token, err := utils.GenerateJWTWithClaims(utils.Claims{ID: user.ID.Hex(), Email: user.Email, Role: user.Role, TokenVersion: user.TokenVersion})
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -190,6 +239,11 @@ func (s *UserService) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := tenant.JoinDefault(ctx, s.userCollection.Database(), res.InsertedID.(primitive.ObjectID)); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	projection := bson.M{
 		"fullname": 1,
 		"username": 1,
@@ -245,6 +299,14 @@ func (s *UserService) handleSearch(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	// Only members of the caller's workspace can be found
+	members, err := tenant.UserFilter(ctx, s.userCollection.Database())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	filter = bson.M{"$and": bson.A{filter, members}}
+
 	cursor, err := s.userCollection.Find(ctx, filter)
 
 	if err != nil {
@@ -329,6 +391,11 @@ func (s *UserService) handleAuthProviderCallback(w http.ResponseWriter, r *http.
 			return
 		}
 
+		if err := tenant.JoinDefault(ctx, s.userCollection.Database(), res.InsertedID.(primitive.ObjectID)); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		projection := bson.M{
 			"fullname": 1,
 			"username": 1,
@@ -368,6 +435,11 @@ func (s *UserService) handleAuthProviderCallback(w http.ResponseWriter, r *http.
 
 	} else {
 
+		if !existingUser.IsActive {
+			utils.WriteError(w, http.StatusForbidden, "This account has been deactivated")
+			return
+		}
+
 		updated := false
 
 		if existingUser.Provider != (*models.AuthProvider)(&userGoth.Provider) {
@@ -401,7 +473,7 @@ func (s *UserService) handleAuthProviderCallback(w http.ResponseWriter, r *http.
 			}
 
 			// Generate JWT token
-			token, err := utils.GenerateJWT(existingUser.ID.Hex(), existingUser.Email)
+			token, err := utils.GenerateJWTWithClaims(utils.Claims{ID: existingUser.ID.Hex(), Email: existingUser.Email, Role: existingUser.Role, TokenVersion: existingUser.TokenVersion})
 			if err != nil {
 				utils.WriteError(w, http.StatusInternalServerError, err.Error())
 				return
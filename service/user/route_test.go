@@ -6,13 +6,16 @@ import (
 	"encoding/json"
 	"lite-chat-go/internal/testutils"
 	"lite-chat-go/models"
+	"lite-chat-go/tenant"
 	"lite-chat-go/types"
+	"lite-chat-go/utils"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -266,6 +269,42 @@ func TestUserService_Login(t *testing.T) {
 
 			assert.Equal(t, http.StatusBadRequest, w.Code)
 		})
+
+		t.Run("Role is carried in the token", func(t *testing.T) {
+			testDB.UserCol.UpdateByID(context.Background(), testUser.ID, bson.M{"$set": bson.M{"role": types.RoleModerator}})
+			defer testDB.UserCol.UpdateByID(context.Background(), testUser.ID, bson.M{"$unset": bson.M{"role": ""}})
+
+			body, _ := json.Marshal(models.UserLoginPayload{Email: "login@example.com", Password: "testpassword"})
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			userService.handleLogin(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			claims, err := utils.ValidateJWT(response["token"].(string))
+			assert.NoError(t, err)
+			assert.Equal(t, types.RoleModerator, claims.Role)
+		})
+
+		t.Run("Deactivated accounts can't log in", func(t *testing.T) {
+			testDB.UserCol.UpdateByID(context.Background(), testUser.ID, bson.M{"$set": bson.M{"isActive": false}})
+			defer testDB.UserCol.UpdateByID(context.Background(), testUser.ID, bson.M{"$set": bson.M{"isActive": true}})
+
+			body, _ := json.Marshal(models.UserLoginPayload{Email: "login@example.com", Password: "testpassword"})
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			userService.handleLogin(w, req)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			account, err := userService.Account(context.Background(), testUser.ID.Hex(), "")
+			assert.NoError(t, err)
+			assert.False(t, account.Active)
+		})
 	})
 }
 
@@ -476,3 +515,101 @@ func TestUserService_Search(t *testing.T) {
 		})
 	})
 }
+
+func TestUserService_SearchWorkspace(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		userService := NewUserService(testDB.UserCol)
+
+		searcher, _ := testDB.CreateTestUser("searcher@example.com", "searcher", "Searcher")
+		colleague, _ := testDB.CreateTestUser("teammate@example.com", "teammate", "Team Mate")
+		testDB.CreateTestUser("stranger@example.com", "teamless", "Team Less")
+
+		workspaceId := primitive.NewObjectID()
+		members := testDB.Database.Collection(tenant.MemberCollection)
+		for _, id := range []primitive.ObjectID{searcher.ID, colleague.ID} {
+			members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspaceId, UserID: id})
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/search/{query}", userService.handleSearch).Methods(http.MethodGet)
+
+		search := func(workspace primitive.ObjectID) []models.UserPublic {
+			req := httptest.NewRequest(http.MethodGet, "/search/team", nil)
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, searcher.ID.Hex())
+			if !workspace.IsZero() {
+				ctx = context.WithValue(ctx, types.ContextKeyWorkspaceID, workspace.Hex())
+			}
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data []models.UserPublic `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return response.Data
+		}
+
+		t.Run("Only members of the workspace are found", func(t *testing.T) {
+			users := search(workspaceId)
+
+			assert.Len(t, users, 1)
+			assert.Equal(t, colleague.ID, users[0].ID)
+		})
+
+		t.Run("Another workspace finds nobody", func(t *testing.T) {
+			assert.Empty(t, search(primitive.NewObjectID()))
+		})
+
+		t.Run("The default workspace sees its own members", func(t *testing.T) {
+			assert.Len(t, search(primitive.NilObjectID), 2)
+		})
+
+		t.Run("Members of a named workspace only stay out of the default one", func(t *testing.T) {
+			outsider, _ := testDB.CreateTestUser("teamonly@example.com", "teamonly", "Team Only")
+			members.DeleteOne(context.Background(), bson.M{"workspaceId": bson.M{"$exists": false}, "userId": outsider.ID})
+			members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspaceId, UserID: outsider.ID})
+
+			for _, user := range search(primitive.NilObjectID) {
+				assert.NotEqual(t, outsider.ID, user.ID)
+			}
+			assert.Len(t, search(workspaceId), 2)
+		})
+	})
+}
+
+func TestUserService_AccountWorkspace(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		userService := NewUserService(testDB.UserCol)
+
+		user, _ := testDB.CreateTestUser("member@example.com", "member", "Member")
+		workspaceId := primitive.NewObjectID()
+		members := testDB.Database.Collection(tenant.MemberCollection)
+		members.InsertOne(context.Background(), models.WorkspaceMember{WorkspaceID: workspaceId, UserID: user.ID})
+
+		member := func(workspace string) bool {
+			account, err := userService.Account(context.Background(), user.ID.Hex(), workspace)
+			assert.NoError(t, err)
+			assert.True(t, account.Active)
+			return account.Member
+		}
+
+		t.Run("Members pass in their workspace and the default one", func(t *testing.T) {
+			assert.True(t, member(workspaceId.Hex()))
+			assert.True(t, member(""))
+		})
+
+		t.Run("Other workspaces fail", func(t *testing.T) {
+			assert.False(t, member(primitive.NewObjectID().Hex()))
+			assert.False(t, member("not-an-id"))
+		})
+
+		t.Run("Removed members fail", func(t *testing.T) {
+			members.DeleteOne(context.Background(), bson.M{"workspaceId": workspaceId, "userId": user.ID})
+
+			assert.False(t, member(workspaceId.Hex()))
+		})
+	})
+}
@@ -0,0 +1,411 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"lite-chat-go/models"
+	"lite-chat-go/tenant"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WorkspaceService struct {
+	workspaceCollection *mongo.Collection
+	userCollection      *mongo.Collection
+}
+
+func NewWorkspaceService(workspaceCollection *mongo.Collection, userCollection *mongo.Collection) *WorkspaceService {
+	return &WorkspaceService{
+		workspaceCollection: workspaceCollection,
+		userCollection:      userCollection,
+	}
+}
+
+func (s *WorkspaceService) memberCollection() *mongo.Collection {
+	return s.workspaceCollection.Database().Collection(tenant.MemberCollection)
+}
+
+func (s *WorkspaceService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.memberCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "workspaceId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetName("workspaceId_userId").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetName("userId"),
+		},
+	})
+	return err
+}
+
+func (s *WorkspaceService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("", utils.WithJwtAuth(s.listWorkspaces)).Methods(http.MethodGet)
+	router.HandleFunc("", utils.WithJwtAuth(s.createWorkspace)).Methods(http.MethodPost)
+	router.HandleFunc("/switch", utils.WithJwtAuth(s.switchWorkspace)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/members", utils.WithJwtAuth(s.listMembers)).Methods(http.MethodGet)
+	router.HandleFunc("/{id}/members", utils.WithJwtAuth(s.addMember)).Methods(http.MethodPost)
+	router.HandleFunc("/{id}/members/{userId}", utils.WithJwtAuth(s.removeMember)).Methods(http.MethodDelete)
+}
+
+// createWorkspace starts a workspace owned by the caller, who becomes its first member.
+func (s *WorkspaceService) createWorkspace(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.CreateWorkspacePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Workspace name is required")
+		return
+	}
+
+	now := time.Now()
+	workspace := models.Workspace{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		OwnerID:   userIdObject,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	session, err := s.workspaceCollection.Database().Client().StartSession()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := s.workspaceCollection.InsertOne(sc, workspace); err != nil {
+			return nil, err
+		}
+		_, err := s.memberCollection().InsertOne(sc, models.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      userIdObject,
+			JoinedAt:    now,
+		})
+		return nil, err
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Workspace created",
+		Status:  http.StatusCreated,
+		Data:    workspace,
+	})
+}
+
+func (s *WorkspaceService) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	workspaceIds, err := s.memberCollection().Distinct(ctx, "workspaceId", bson.M{"userId": userIdObject})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	workspaces := make([]models.Workspace, 0, len(workspaceIds))
+	if len(workspaceIds) > 0 {
+		cursor, err := s.workspaceCollection.Find(ctx,
+			bson.M{"_id": bson.M{"$in": workspaceIds}},
+			options.Find().SetSort(bson.D{{Key: "name", Value: 1}}),
+		)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err := cursor.All(ctx, &workspaces); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    workspaces,
+	})
+}
+
+// switchWorkspace issues a token scoped to another workspace the caller belongs to.
+func (s *WorkspaceService) switchWorkspace(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	userId := ctx.Value(types.ContextKeyUserID).(string)
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return
+	}
+
+	var payload models.SwitchWorkspacePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The new token carries the role the account has now, not the one being replaced
+	var user models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"_id": userIdObject}, options.FindOne().SetProjection(bson.M{"role": 1, "tokenVersion": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	claims := utils.Claims{ID: userId, Email: ctx.Value(types.ContextKeyEmail).(string), Role: user.Role, TokenVersion: user.TokenVersion}
+	response := models.WorkspaceToken{}
+
+	if payload.WorkspaceID != "" {
+		workspaceIdObject, err := primitive.ObjectIDFromHex(payload.WorkspaceID)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Workspace ID not valid")
+			return
+		}
+
+		member, err := s.isMember(ctx, workspaceIdObject, userIdObject)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !member {
+			utils.WriteError(w, http.StatusForbidden, "You are not a member of this workspace")
+			return
+		}
+
+		claims.WorkspaceID = workspaceIdObject.Hex()
+		response.WorkspaceID = &workspaceIdObject
+	}
+
+	response.Token, err = utils.GenerateJWTWithClaims(claims)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    response,
+	})
+}
+
+func (s *WorkspaceService) listMembers(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	workspace, _, ok := s.memberWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	userIds, err := s.memberCollection().Distinct(ctx, "userId", bson.M{"workspaceId": workspace.ID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cursor, err := s.userCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": userIds}},
+		options.Find().SetSort(bson.D{{Key: "fullname", Value: 1}}),
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	members := make([]models.UserPublic, 0, len(userIds))
+	if err := cursor.All(ctx, &members); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Success",
+		Status:  http.StatusOK,
+		Data:    members,
+	})
+}
+
+// addMember lets the owner bring a user in by email. User search is scoped to
+// the workspace, so outsiders can't be looked up any other way.
+func (s *WorkspaceService) addMember(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	var payload models.AddWorkspaceMemberPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	workspace, userIdObject, ok := s.memberWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	if workspace.OwnerID != userIdObject {
+		utils.WriteError(w, http.StatusForbidden, "Only the workspace owner can add members")
+		return
+	}
+
+	var user models.UserPublic
+	err := s.userCollection.FindOne(ctx, bson.M{"email": payload.Email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	_, err = s.memberCollection().InsertOne(ctx, models.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID,
+		JoinedAt:    time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		utils.WriteError(w, http.StatusConflict, "User is already a member")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Member added",
+		Status:  http.StatusCreated,
+		Data:    user,
+	})
+}
+
+// removeMember lets the owner remove anyone but themselves, and members leave.
+func (s *WorkspaceService) removeMember(w http.ResponseWriter, r *http.Request) {
+	var ctx = r.Context()
+
+	memberIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["userId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "User ID not valid")
+		return
+	}
+
+	workspace, userIdObject, ok := s.memberWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	if workspace.OwnerID != userIdObject && memberIdObject != userIdObject {
+		utils.WriteError(w, http.StatusForbidden, "Only the workspace owner can remove members")
+		return
+	}
+	if memberIdObject == workspace.OwnerID {
+		utils.WriteError(w, http.StatusBadRequest, "The workspace owner can't be removed")
+		return
+	}
+
+	result, err := s.memberCollection().DeleteOne(ctx, bson.M{"workspaceId": workspace.ID, "userId": memberIdObject})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.DeletedCount == 0 {
+		utils.WriteError(w, http.StatusNotFound, "User is not a member")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.CustomSuccessResponse{
+		Success: true,
+		Message: "Member removed",
+		Status:  http.StatusOK,
+	})
+}
+
+// memberWorkspace loads the {id} workspace, writing 404 unless the caller is a
+// member so outsiders can't tell which workspaces exist.
+func (s *WorkspaceService) memberWorkspace(w http.ResponseWriter, r *http.Request) (*models.Workspace, primitive.ObjectID, bool) {
+	var ctx = r.Context()
+
+	userIdObject, err := primitive.ObjectIDFromHex(ctx.Value(types.ContextKeyUserID).(string))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "User ID not found")
+		return nil, primitive.NilObjectID, false
+	}
+
+	workspaceIdObject, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Workspace ID not valid")
+		return nil, primitive.NilObjectID, false
+	}
+
+	member, err := s.isMember(ctx, workspaceIdObject, userIdObject)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, primitive.NilObjectID, false
+	}
+	if !member {
+		utils.WriteError(w, http.StatusNotFound, "Workspace not found")
+		return nil, primitive.NilObjectID, false
+	}
+
+	var workspace models.Workspace
+	err = s.workspaceCollection.FindOne(ctx, bson.M{"_id": workspaceIdObject}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		utils.WriteError(w, http.StatusNotFound, "Workspace not found")
+		return nil, primitive.NilObjectID, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, primitive.NilObjectID, false
+	}
+
+	return &workspace, userIdObject, true
+}
+
+func (s *WorkspaceService) isMember(ctx context.Context, workspaceId primitive.ObjectID, userId primitive.ObjectID) (bool, error) {
+	count, err := s.memberCollection().CountDocuments(ctx, bson.M{"workspaceId": workspaceId, "userId": userId})
+	return count > 0, err
+}
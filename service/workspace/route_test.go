@@ -0,0 +1,166 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lite-chat-go/internal/testutils"
+	"lite-chat-go/models"
+	"lite-chat-go/types"
+	"lite-chat-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWorkspaceService(t *testing.T) {
+	testutils.RunTestWithDB(t, func(testDB *testutils.TestDB) {
+		workspaceService := NewWorkspaceService(testDB.Database.Collection("workspaces"), testDB.UserCol)
+		assert.NoError(t, workspaceService.EnsureIndexes(context.Background()))
+
+		owner, _ := testDB.CreateTestUser("owner@example.com", "owner", "Workspace Owner")
+		member, _ := testDB.CreateTestUser("member@example.com", "member", "Workspace Member")
+		outsider, _ := testDB.CreateTestUser("outsider@example.com", "outsider", "Outsider")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", workspaceService.listWorkspaces).Methods(http.MethodGet)
+		router.HandleFunc("/", workspaceService.createWorkspace).Methods(http.MethodPost)
+		router.HandleFunc("/switch", workspaceService.switchWorkspace).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/members", workspaceService.listMembers).Methods(http.MethodGet)
+		router.HandleFunc("/{id}/members", workspaceService.addMember).Methods(http.MethodPost)
+		router.HandleFunc("/{id}/members/{userId}", workspaceService.removeMember).Methods(http.MethodDelete)
+
+		do := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, user.ID.Hex())
+			ctx = context.WithValue(ctx, types.ContextKeyEmail, user.Email)
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		var workspace models.Workspace
+
+		t.Run("Create a workspace", func(t *testing.T) {
+			w := do(owner, http.MethodPost, "/", `{"name": "  Acme  "}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var response struct {
+				Data models.Workspace `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			workspace = response.Data
+			assert.Equal(t, "Acme", workspace.Name)
+			assert.Equal(t, owner.ID, workspace.OwnerID)
+
+			w = do(owner, http.MethodPost, "/", `{"name": "   "}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+
+		membersPath := func() string { return "/" + workspace.ID.Hex() + "/members" }
+		listMembers := func(user *models.User) []models.UserPublic {
+			var response struct {
+				Data []models.UserPublic `json:"data"`
+			}
+			json.Unmarshal(do(user, http.MethodGet, membersPath(), "").Body.Bytes(), &response)
+			return response.Data
+		}
+
+		t.Run("Only the owner adds members", func(t *testing.T) {
+			w := do(owner, http.MethodPost, membersPath(), `{"email": "member@example.com"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			w = do(owner, http.MethodPost, membersPath(), `{"email": "member@example.com"}`)
+			assert.Equal(t, http.StatusConflict, w.Code)
+
+			w = do(member, http.MethodPost, membersPath(), `{"email": "outsider@example.com"}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			assert.Len(t, listMembers(owner), 2)
+		})
+
+		t.Run("Outsiders can't see the workspace", func(t *testing.T) {
+			w := do(outsider, http.MethodGet, membersPath(), "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			var response struct {
+				Data []models.Workspace `json:"data"`
+			}
+			json.Unmarshal(do(outsider, http.MethodGet, "/", "").Body.Bytes(), &response)
+			assert.Empty(t, response.Data)
+
+			json.Unmarshal(do(member, http.MethodGet, "/", "").Body.Bytes(), &response)
+			assert.Len(t, response.Data, 1)
+		})
+
+		t.Run("Switching issues a token for the workspace", func(t *testing.T) {
+			w := do(outsider, http.MethodPost, "/switch", `{"workspaceId": "`+workspace.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			w = do(member, http.MethodPost, "/switch", `{"workspaceId": "`+workspace.ID.Hex()+`"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.WorkspaceToken `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			claims, err := utils.ValidateJWT(response.Data.Token)
+			assert.NoError(t, err)
+			assert.Equal(t, member.ID.Hex(), claims.ID)
+			assert.Equal(t, workspace.ID.Hex(), claims.WorkspaceID)
+
+			// An empty workspaceId goes back to the default workspace
+			w = do(member, http.MethodPost, "/switch", `{}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			json.Unmarshal(w.Body.Bytes(), &response)
+			claims, _ = utils.ValidateJWT(response.Data.Token)
+			assert.Empty(t, claims.WorkspaceID)
+		})
+
+		t.Run("Switching issues the account's current role", func(t *testing.T) {
+			testDB.UserCol.UpdateByID(context.Background(), member.ID, bson.M{"$set": bson.M{"role": types.RoleModerator}})
+			defer testDB.UserCol.UpdateByID(context.Background(), member.ID, bson.M{"$unset": bson.M{"role": ""}})
+
+			// The caller's old token still said admin
+			req := httptest.NewRequest(http.MethodPost, "/switch", bytes.NewBufferString(`{"workspaceId": "`+workspace.ID.Hex()+`"}`))
+			ctx := context.WithValue(req.Context(), types.ContextKeyUserID, member.ID.Hex())
+			ctx = context.WithValue(ctx, types.ContextKeyEmail, member.Email)
+			ctx = context.WithValue(ctx, types.ContextKeyRole, types.RoleAdmin)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req.WithContext(ctx))
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Data models.WorkspaceToken `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			claims, _ := utils.ValidateJWT(response.Data.Token)
+			assert.Equal(t, types.RoleModerator, claims.Role)
+		})
+
+		t.Run("Remove members", func(t *testing.T) {
+			w := do(member, http.MethodDelete, membersPath()+"/"+owner.ID.Hex(), "")
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			w = do(owner, http.MethodDelete, membersPath()+"/"+owner.ID.Hex(), "")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			w = do(owner, http.MethodDelete, membersPath()+"/"+primitive.NewObjectID().Hex(), "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			w = do(owner, http.MethodDelete, membersPath()+"/"+member.ID.Hex(), "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Len(t, listMembers(owner), 1)
+
+			w = do(member, http.MethodGet, membersPath(), "")
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	})
+}
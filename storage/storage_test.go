@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskStore(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	key := "0123456789abcdef01234567.wav"
+
+	t.Run("Save, open and delete", func(t *testing.T) {
+		assert.NoError(t, store.Save(ctx, key, strings.NewReader("audio")))
+
+		f, err := store.Open(ctx, key)
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(f)
+		f.Close()
+		assert.Equal(t, "audio", string(b))
+
+		assert.NoError(t, store.Delete(ctx, key))
+		_, err = store.Open(ctx, key)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Keys cannot escape the directory", func(t *testing.T) {
+		for _, bad := range []string{"../etc/passwd", "/etc/passwd", "0123456789abcdef01234567/../x", ""} {
+			assert.ErrorIs(t, store.Save(ctx, bad, strings.NewReader("x")), ErrInvalidKey, bad)
+
+			_, err := store.Open(ctx, bad)
+			assert.ErrorIs(t, err, ErrInvalidKey, bad)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	key := "0123456789abcdef01234567.ogg"
+
+	assert.NoError(t, store.Save(ctx, key, strings.NewReader("audio")))
+
+	f, err := store.Open(ctx, key)
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(f)
+	assert.Equal(t, "audio", string(b))
+
+	store.Delete(ctx, key)
+	_, err = store.Open(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
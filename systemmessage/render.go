@@ -0,0 +1,49 @@
+// Package systemmessage renders the text of system messages for readers.
+package systemmessage
+
+import (
+	"context"
+	"lite-chat-go/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Render rewrites the text of system messages from their event, so every client
+// shows the same line whatever wording was stored at the time. Actor names are
+// looked up in users.
+func Render(ctx context.Context, users *mongo.Collection, messages []models.Message) error {
+	actorIds := make([]primitive.ObjectID, 0)
+	for _, m := range messages {
+		if m.Kind == models.MessageKindSystem && m.System != nil {
+			actorIds = append(actorIds, m.System.ActorID)
+		}
+	}
+	if len(actorIds) == 0 {
+		return nil
+	}
+
+	cursor, err := users.Find(ctx, bson.M{"_id": bson.M{"$in": actorIds}}, options.Find().SetProjection(bson.M{"fullname": 1}))
+	if err != nil {
+		return err
+	}
+
+	var actors []models.UserPublic
+	if err := cursor.All(ctx, &actors); err != nil {
+		return err
+	}
+
+	names := make(map[primitive.ObjectID]string, len(actors))
+	for _, actor := range actors {
+		names[actor.ID] = actor.Fullname
+	}
+
+	for i := range messages {
+		if messages[i].Kind == models.MessageKindSystem && messages[i].System != nil {
+			messages[i].Message = messages[i].System.Text(names[messages[i].System.ActorID])
+		}
+	}
+	return nil
+}
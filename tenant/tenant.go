@@ -0,0 +1,101 @@
+// Package tenant keeps requests inside their workspace. Users can belong to
+// several workspaces, while conversations and messages belong to exactly one.
+// Data written before workspaces existed has no workspaceId and forms the
+// default workspace. Users join it when they sign up, which is recorded as a
+// membership without a workspaceId, so members of named workspaces who never
+// signed up there stay out of it.
+package tenant
+
+import (
+	"context"
+	"lite-chat-go/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemberCollection holds one document per user and workspace, without a
+// workspaceId for the default workspace.
+const MemberCollection = "workspace_members"
+
+// FromContext returns the request's workspace, NilObjectID for the default one.
+func FromContext(ctx context.Context) primitive.ObjectID {
+	value, _ := ctx.Value(types.ContextKeyWorkspaceID).(string)
+	id, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return primitive.NilObjectID
+	}
+	return id
+}
+
+// WithWorkspace scopes ctx to a workspace, for work started outside a request.
+func WithWorkspace(ctx context.Context, workspaceId primitive.ObjectID) context.Context {
+	if workspaceId.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, types.ContextKeyWorkspaceID, workspaceId.Hex())
+}
+
+// Filter matches documents of the request's workspace.
+func Filter(ctx context.Context) bson.M {
+	return bson.M{"workspaceId": value(FromContext(ctx))}
+}
+
+// Scope adds the workspace condition to filter and returns it.
+func Scope(ctx context.Context, filter bson.M) bson.M {
+	filter["workspaceId"] = value(FromContext(ctx))
+	return filter
+}
+
+func value(workspaceId primitive.ObjectID) interface{} {
+	if workspaceId.IsZero() {
+		return bson.M{"$exists": false}
+	}
+	return workspaceId
+}
+
+// AreMembers reports whether all users belong to the request's workspace.
+func AreMembers(ctx context.Context, db *mongo.Database, userIds ...primitive.ObjectID) (bool, error) {
+	if len(userIds) == 0 {
+		return true, nil
+	}
+
+	count, err := db.Collection(MemberCollection).CountDocuments(ctx, bson.M{
+		"workspaceId": value(FromContext(ctx)),
+		"userId":      bson.M{"$in": userIds},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	unique := make(map[primitive.ObjectID]struct{}, len(userIds))
+	for _, id := range userIds {
+		unique[id] = struct{}{}
+	}
+	return int(count) == len(unique), nil
+}
+
+// UserFilter matches the users of the request's workspace.
+func UserFilter(ctx context.Context, db *mongo.Database) (bson.M, error) {
+	userIds, err := db.Collection(MemberCollection).Distinct(ctx, "userId", bson.M{"workspaceId": value(FromContext(ctx))})
+	if err != nil {
+		return nil, err
+	}
+	if userIds == nil {
+		userIds = bson.A{}
+	}
+	return bson.M{"_id": bson.M{"$in": userIds}}, nil
+}
+
+// JoinDefault records userId as a member of the default workspace.
+func JoinDefault(ctx context.Context, db *mongo.Database, userId primitive.ObjectID) error {
+	_, err := db.Collection(MemberCollection).UpdateOne(ctx,
+		bson.M{"workspaceId": bson.M{"$exists": false}, "userId": userId},
+		bson.M{"$setOnInsert": bson.M{"userId": userId, "joinedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,39 @@
+package tenant
+
+import (
+	"context"
+	"lite-chat-go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilter(t *testing.T) {
+	workspaceId := primitive.NewObjectID()
+
+	t.Run("Default workspace matches documents without a workspace", func(t *testing.T) {
+		assert.Equal(t, bson.M{"workspaceId": bson.M{"$exists": false}}, Filter(context.Background()))
+	})
+
+	t.Run("Named workspace matches its own documents", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), types.ContextKeyWorkspaceID, workspaceId.Hex())
+
+		assert.Equal(t, workspaceId, FromContext(ctx))
+		assert.Equal(t, bson.M{"workspaceId": workspaceId}, Filter(ctx))
+		assert.Equal(t, bson.M{"senderId": "x", "workspaceId": workspaceId}, Scope(ctx, bson.M{"senderId": "x"}))
+	})
+
+	t.Run("WithWorkspace round trips", func(t *testing.T) {
+		ctx := WithWorkspace(context.Background(), workspaceId)
+		assert.Equal(t, workspaceId, FromContext(ctx))
+
+		assert.True(t, FromContext(WithWorkspace(context.Background(), primitive.NilObjectID)).IsZero())
+	})
+
+	t.Run("Malformed workspace falls back to the default", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), types.ContextKeyWorkspaceID, "nope")
+		assert.True(t, FromContext(ctx).IsZero())
+	})
+}
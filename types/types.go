@@ -26,4 +26,20 @@ type contextKey string
 const (
 	ContextKeyUserID contextKey = "userID"
 	ContextKeyEmail  contextKey = "email"
+	// ContextKeyWorkspaceID is absent for the default workspace
+	ContextKeyWorkspaceID contextKey = "workspaceID"
+	ContextKeyRole        contextKey = "role"
 )
+
+// Role grants access to moderation and administration. An empty role is RoleUser.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	return r == RoleUser || r == RoleModerator || r == RoleAdmin
+}
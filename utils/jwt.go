@@ -30,21 +30,48 @@ func CheckPasswordHash(password, hash string) bool {
 type Claims struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
+	// WorkspaceID is empty for the default workspace
+	WorkspaceID string     `json:"workspaceId,omitempty"`
+	Role        types.Role `json:"role,omitempty"`
+	// TokenVersion is the account's version when the token was issued
+	TokenVersion int64 `json:"tokenVersion,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Account is the current state of the account behind a token.
+type Account struct {
+	Active bool
+	Role   types.Role
+	// Member is false once the account no longer belongs to the token's workspace
+	Member bool
+	// TokenVersion has to match the token's, see models.User
+	TokenVersion int64
+}
+
+// accountCheck looks up the account of a token and its membership of the
+// token's workspace, empty for the default one. Tokens stay valid until they
+// expire, so deactivation, role changes, password resets and removal from a
+// workspace are enforced here on every request.
+var accountCheck func(ctx context.Context, userId, workspaceId string) (Account, error)
+
+// SetAccountCheck installs the lookup WithJwtAuth uses to reject deactivated
+// accounts and removed members, and to read the caller's current role.
+func SetAccountCheck(check func(ctx context.Context, userId, workspaceId string) (Account, error)) {
+	accountCheck = check
+}
+
 func GenerateJWT(id, email string) (string, error) {
-	expirationTime := time.Now().Add(1 * time.Hour)
-
-	claims := &Claims{
-		ID:    id,
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	return GenerateJWTWithClaims(Claims{ID: id, Email: email})
+}
+
+// GenerateJWTWithClaims signs claims, expiring them after an hour unless they
+// already carry an expiry.
+func GenerateJWTWithClaims(claims Claims) (string, error) {
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(1 * time.Hour))
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
 	return token.SignedString(jwtSecret)
 }
 
@@ -77,13 +104,60 @@ func WithJwtAuth(handlerFunc http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		role := token.Role
+		if accountCheck != nil {
+			account, err := accountCheck(r.Context(), token.ID, token.WorkspaceID)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !account.Active {
+				WriteError(w, http.StatusForbidden, "This account has been deactivated")
+				return
+			}
+			if token.TokenVersion != account.TokenVersion {
+				WriteError(w, http.StatusForbidden, "The password was changed, sign in again")
+				return
+			}
+			if !account.Member {
+				WriteError(w, http.StatusForbidden, "You are not a member of this workspace")
+				return
+			}
+			// The role in the token may be stale, the account's is authoritative
+			role = account.Role
+		}
+
+		if role == "" {
+			role = types.RoleUser
+		}
+
 		ctx := context.WithValue(r.Context(), types.ContextKeyUserID, token.ID)
 		ctx = context.WithValue(ctx, types.ContextKeyEmail, token.Email)
+		ctx = context.WithValue(ctx, types.ContextKeyRole, role)
+		if token.WorkspaceID != "" {
+			ctx = context.WithValue(ctx, types.ContextKeyWorkspaceID, token.WorkspaceID)
+		}
 
 		handlerFunc(w, r.WithContext(ctx))
 	}
 }
 
+// WithRole only lets callers with one of roles through. It runs inside
+// WithJwtAuth, which puts the caller's role on the context.
+func WithRole(handlerFunc http.HandlerFunc, roles ...types.Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(types.ContextKeyRole).(types.Role)
+		for _, allowed := range roles {
+			if role == allowed {
+				handlerFunc(w, r)
+				return
+			}
+		}
+
+		permissionDenied(w)
+	}
+}
+
 func getTokenFromRequest(r *http.Request) string {
 	tokenAuth := r.Header.Get("Authorization")
 	splitToken := strings.Split(tokenAuth, "Bearer ")
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"context"
+	"lite-chat-go/types"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -235,6 +239,111 @@ func TestGenerateJWT(t *testing.T) {
 	})
 }
 
+func TestGenerateJWTWithClaims(t *testing.T) {
+	setupTestEnv()
+
+	t.Run("Workspace survives the round trip", func(t *testing.T) {
+		token, err := GenerateJWTWithClaims(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", Email: "test@example.com", WorkspaceID: "60c72b2f9b1d8b3a4c8e4f1b"})
+		assert.NoError(t, err)
+
+		claims, err := ValidateJWT(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "60c72b2f9b1d8b3a4c8e4f1b", claims.WorkspaceID)
+		assert.NotNil(t, claims.ExpiresAt)
+	})
+
+	t.Run("Default workspace tokens carry no workspace", func(t *testing.T) {
+		token, err := GenerateJWT("60c72b2f9b1d8b3a4c8e4f1a", "test@example.com")
+		assert.NoError(t, err)
+
+		claims, err := ValidateJWT(token)
+		assert.NoError(t, err)
+		assert.Empty(t, claims.WorkspaceID)
+	})
+}
+
+func TestWithJwtAuthRoles(t *testing.T) {
+	setupTestEnv()
+
+	request := func(claims Claims, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		token, _ := GenerateJWTWithClaims(claims)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		WithJwtAuth(handler)(w, req)
+		return w
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	adminOnly := WithRole(ok, types.RoleAdmin)
+
+	t.Run("Tokens without a role act as users", func(t *testing.T) {
+		var role interface{}
+		request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a"}, func(w http.ResponseWriter, r *http.Request) {
+			role = r.Context().Value(types.ContextKeyRole)
+		})
+		assert.Equal(t, types.RoleUser, role)
+
+		assert.Equal(t, http.StatusForbidden, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a"}, adminOnly).Code)
+	})
+
+	t.Run("Only listed roles pass", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", Role: types.RoleAdmin}, adminOnly).Code)
+		assert.Equal(t, http.StatusForbidden, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", Role: types.RoleModerator}, adminOnly).Code)
+
+		staff := WithRole(ok, types.RoleModerator, types.RoleAdmin)
+		assert.Equal(t, http.StatusOK, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", Role: types.RoleModerator}, staff).Code)
+	})
+
+	t.Run("Deactivated accounts are rejected", func(t *testing.T) {
+		SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (Account, error) {
+			return Account{Active: userId != "60c72b2f9b1d8b3a4c8e4f1b", Role: types.RoleAdmin, Member: true}, nil
+		})
+		defer SetAccountCheck(nil)
+
+		assert.Equal(t, http.StatusOK, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a"}, ok).Code)
+		assert.Equal(t, http.StatusForbidden, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1b", Role: types.RoleAdmin}, adminOnly).Code)
+	})
+
+	t.Run("Members removed from the token's workspace are rejected", func(t *testing.T) {
+		SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (Account, error) {
+			return Account{Active: true, Role: types.RoleUser, Member: workspaceId != "60c72b2f9b1d8b3a4c8e4f1c"}, nil
+		})
+		defer SetAccountCheck(nil)
+
+		assert.Equal(t, http.StatusOK, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", WorkspaceID: "60c72b2f9b1d8b3a4c8e4f1b"}, ok).Code)
+		assert.Equal(t, http.StatusForbidden, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", WorkspaceID: "60c72b2f9b1d8b3a4c8e4f1c"}, ok).Code)
+	})
+
+	t.Run("Tokens issued before a password reset are rejected", func(t *testing.T) {
+		SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (Account, error) {
+			return Account{Active: true, Role: types.RoleUser, Member: true, TokenVersion: 2}, nil
+		})
+		defer SetAccountCheck(nil)
+
+		assert.Equal(t, http.StatusForbidden, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", TokenVersion: 1}, ok).Code)
+		assert.Equal(t, http.StatusOK, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", TokenVersion: 2}, ok).Code)
+	})
+
+	t.Run("The account's current role wins over the token's", func(t *testing.T) {
+		roles := map[string]types.Role{
+			"60c72b2f9b1d8b3a4c8e4f1a": types.RoleUser,
+			"60c72b2f9b1d8b3a4c8e4f1b": types.RoleAdmin,
+		}
+		SetAccountCheck(func(ctx context.Context, userId, workspaceId string) (Account, error) {
+			return Account{Active: true, Role: roles[userId], Member: true}, nil
+		})
+		defer SetAccountCheck(nil)
+
+		// Demoted after the token was issued
+		assert.Equal(t, http.StatusForbidden, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1a", Role: types.RoleAdmin}, adminOnly).Code)
+		// Promoted after the token was issued
+		assert.Equal(t, http.StatusOK, request(Claims{ID: "60c72b2f9b1d8b3a4c8e4f1b"}, adminOnly).Code)
+	})
+}
+
 // Benchmark tests
 func BenchmarkHashPassword(b *testing.B) {
 	setupTestEnv()
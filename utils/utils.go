@@ -6,6 +6,7 @@ import (
 	"lite-chat-go/types"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -13,7 +14,7 @@ import (
 )
 
 var Validate = validator.New()
-var logger *zap.Logger
+var logger = zap.NewNop()
 
 func InitLogger(l *zap.Logger) {
 	logger = l
@@ -55,6 +56,29 @@ func ParseJSON(r *http.Request, payload any) error {
 	return json.NewDecoder(r.Body).Decode(payload)
 }
 
+// ParsePagination reads page/limit query values, defaulting to the first page of 20.
+func ParsePagination(pageParam, limitParam string) (int, int, error) {
+	page, limit := 1, 20
+
+	if pageParam != "" {
+		p, err := strconv.Atoi(pageParam)
+		if err != nil || p < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+		page = p
+	}
+
+	if limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l < 1 || l > 50 {
+			return 0, 0, fmt.Errorf("limit must be between 1 and 50")
+		}
+		limit = l
+	}
+
+	return page, limit, nil
+}
+
 func EmailToUsername(email string) string {
 	parts := strings.Split(email, "@")
 	localPart := parts[0]
@@ -77,6 +101,10 @@ func logging(status int, v any) {
 	if status >= 400 {
 		logger.Error("Response", zap.Int("status", status), zap.Any("body", v))
 	} else {
-		logger.Info("Response", zap.Int("status", status), zap.Any("body", v.(types.CustomSuccessResponse).Message))
+		if response, ok := v.(types.CustomSuccessResponse); ok {
+			logger.Info("Response", zap.Int("status", status), zap.Any("body", response.Message))
+			return
+		}
+		logger.Info("Response", zap.Int("status", status))
 	}
 }
@@ -190,4 +190,27 @@ func BenchmarkMapToJSON(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		MapToJSON(data)
 	}
-}
\ No newline at end of file
+}
+
+func TestParsePagination(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		page, limit, err := ParsePagination("", "")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, page)
+		assert.Equal(t, 20, limit)
+	})
+
+	t.Run("Explicit values", func(t *testing.T) {
+		page, limit, err := ParsePagination("3", "50")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, page)
+		assert.Equal(t, 50, limit)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		for _, params := range [][2]string{{"0", ""}, {"abc", ""}, {"", "0"}, {"", "51"}} {
+			_, _, err := ParsePagination(params[0], params[1])
+			assert.Error(t, err)
+		}
+	})
+}